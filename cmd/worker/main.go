@@ -0,0 +1,37 @@
+package main
+
+import (
+	"context"
+	"flag"
+
+	"go.uber.org/zap"
+	"jobqueue/internal/app"
+	"jobqueue/internal/config"
+)
+
+func main() {
+	queues := flag.String("queues", "", "comma-separated queues to run pools for (default: WORKER_QUEUES)")
+	flag.Parse()
+
+	app.Main(func(ctx context.Context, a *app.App) error {
+		queueNames := a.Config.WorkerQueues
+		if *queues != "" {
+			queueNames = config.ParseList(*queues)
+		}
+
+		// Worker Pools & Autoscalers
+		w := a.StartWorkers(ctx, queueNames)
+		a.Logger.Info("workers started", zap.Strings("queues", queueNames))
+
+		// Metrics only; the API runs in cmd/server.
+		srv := a.Serve(a.Config.MetricsPort, a.MetricsHandler())
+
+		// Wait for shutdown signal
+		<-ctx.Done()
+
+		a.Logger.Info("shutting down workers gracefully")
+		a.ShutdownServer(srv)
+		w.Shutdown()
+		return nil
+	})
+}
@@ -3,10 +3,10 @@ package ai
 import "github.com/go-redis/redis/v8"
 
 type AI struct {
-	rdb *redis.Client
+	rdb redis.UniversalClient
 	// Potentially an LLM client would go here in a real app
 }
 
-func New(rdb *redis.Client) *AI {
+func New(rdb redis.UniversalClient) *AI {
 	return &AI{rdb: rdb}
 }
\ No newline at end of file
@@ -0,0 +1,111 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"go.uber.org/zap"
+	"jobqueue/internal/control"
+	"jobqueue/internal/models"
+	"jobqueue/internal/queue"
+)
+
+type ControlResponse struct {
+	control.Entry
+	Length    *int64 `json:"length,omitempty"`
+	Scheduled *int64 `json:"scheduled,omitempty"`
+}
+
+// ListControlsHandler returns every paused or draining queue and job type.
+func (a *API) ListControlsHandler(w http.ResponseWriter, r *http.Request) {
+	entries, err := a.controls.List(r.Context())
+	if err != nil {
+		a.logger.Error("failed to list controls", zap.Error(err))
+		http.Error(w, "failed to list controls", http.StatusInternalServerError)
+		return
+	}
+
+	resp := make([]ControlResponse, 0, len(entries))
+	for _, entry := range entries {
+		item := ControlResponse{Entry: entry}
+		if entry.Kind == control.KindQueue {
+			if n, err := queue.Len(r.Context(), a.rdb, entry.Name); err == nil {
+				item.Length = &n
+			}
+			if n, err := a.rdb.ZCard(r.Context(), queue.ScheduledKey(entry.Name)).Result(); err == nil {
+				item.Scheduled = &n
+			}
+		}
+		resp = append(resp, item)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// SetQueueControlHandler pauses, resumes or drains a queue.
+func (a *API) SetQueueControlHandler(w http.ResponseWriter, r *http.Request) {
+	a.setControl(w, r, control.KindQueue)
+}
+
+// SetTypeControlHandler pauses, resumes or drains a job type.
+func (a *API) SetTypeControlHandler(w http.ResponseWriter, r *http.Request) {
+	a.setControl(w, r, control.KindType)
+}
+
+func (a *API) setControl(w http.ResponseWriter, r *http.Request, kind string) {
+	name := chi.URLParam(r, "name")
+
+	var state string
+	switch chi.URLParam(r, "action") {
+	case "pause":
+		state = control.StatePaused
+	case "drain":
+		state = control.StateDraining
+	default:
+		state = control.StateActive
+	}
+
+	if err := a.controls.Set(r.Context(), kind, name, state); err != nil {
+		a.logger.Error("failed to set control state", zap.Error(err), zap.String("kind", kind), zap.String("name", name))
+		http.Error(w, "failed to set control state", http.StatusInternalServerError)
+		return
+	}
+	a.logger.Info("control state changed", zap.String("kind", kind), zap.String("name", name), zap.String("state", state))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(control.Entry{Kind: kind, Name: name, State: state})
+}
+
+type PlanRequest struct {
+	Plan string `json:"plan"`
+}
+
+// SetUserPlanHandler moves a user to another plan, which selects their API
+// rate limit.
+func (a *API) SetUserPlanHandler(w http.ResponseWriter, r *http.Request) {
+	userID := chi.URLParam(r, "userID")
+	var req PlanRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	if !a.limiter.Limits().HasPlan(req.Plan) {
+		http.Error(w, "unknown plan", http.StatusBadRequest)
+		return
+	}
+
+	res := a.db.Model(&models.User{}).Where("id = ?", userID).Update("plan", req.Plan)
+	if res.Error != nil {
+		a.logger.Error("failed to set plan", zap.Error(res.Error), zap.String("user_id", userID))
+		http.Error(w, "failed to set plan", http.StatusInternalServerError)
+		return
+	}
+	if res.RowsAffected == 0 {
+		http.Error(w, "user not found", http.StatusNotFound)
+		return
+	}
+	a.logger.Info("user plan changed", zap.String("user_id", userID), zap.String("plan", req.Plan))
+	w.WriteHeader(http.StatusNoContent)
+}
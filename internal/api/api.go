@@ -1,21 +1,52 @@
 package api
 
 import (
+	"time"
+
 	"github.com/go-redis/redis/v8"
 	"go.uber.org/zap"
 	"gorm.io/gorm"
+	"jobqueue/internal/auth"
+	"jobqueue/internal/control"
+	"jobqueue/internal/monitoring"
+	"jobqueue/internal/tasks"
+	"jobqueue/internal/throttle"
+	"jobqueue/internal/usage"
+	"jobqueue/internal/workers"
 )
 
 type API struct {
-	db     *gorm.DB
-	rdb    *redis.Client
-	logger *zap.Logger
+	db       *gorm.DB
+	rdb      redis.UniversalClient
+	controls *control.Store
+	backlog  *throttle.Backlog
+	limiter  *throttle.APILimiter
+	meter    *usage.Meter
+	remote   *workers.RemoteLeases
+	registry *tasks.Registry
+	// tokens signs the access tokens of login sessions. Access tokens last
+	// accessTTL; a session can be refreshed for refreshTTL after login.
+	tokens     *auth.KeySet
+	accessTTL  time.Duration
+	refreshTTL time.Duration
+	metrics    *monitoring.Metrics
+	logger     *zap.Logger
 }
 
-func New(db *gorm.DB, rdb *redis.Client, logger *zap.Logger) *API {
+func New(db *gorm.DB, rdb redis.UniversalClient, controls *control.Store, backlog *throttle.Backlog, limiter *throttle.APILimiter, meter *usage.Meter, remote *workers.RemoteLeases, registry *tasks.Registry, tokens *auth.KeySet, accessTTL, refreshTTL time.Duration, metrics *monitoring.Metrics, logger *zap.Logger) *API {
 	return &API{
-		db:     db,
-		rdb:    rdb,
-		logger: logger,
+		db:         db,
+		rdb:        rdb,
+		controls:   controls,
+		backlog:    backlog,
+		limiter:    limiter,
+		meter:      meter,
+		remote:     remote,
+		registry:   registry,
+		tokens:     tokens,
+		accessTTL:  accessTTL,
+		refreshTTL: refreshTTL,
+		metrics:    metrics,
+		logger:     logger,
 	}
-} 
\ No newline at end of file
+}
@@ -0,0 +1,357 @@
+package api
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+	"jobqueue/internal/config"
+	"jobqueue/internal/heuristics"
+	"jobqueue/internal/middleware"
+	"jobqueue/internal/models"
+	"jobqueue/internal/queue"
+	"jobqueue/internal/throttle"
+	"jobqueue/internal/usage"
+)
+
+// BulkSubmitResult is the outcome of one job of a bulk submit, by its
+// position in the request.
+type BulkSubmitResult struct {
+	Index int    `json:"index"`
+	JobID string `json:"job_id,omitempty"`
+	Error string `json:"error,omitempty"`
+}
+
+type BulkSubmitResponse struct {
+	// BatchID is shared by the accepted jobs; list them with ?batch_id=.
+	BatchID  string             `json:"batch_id"`
+	Accepted int                `json:"accepted"`
+	Rejected int                `json:"rejected"`
+	Results  []BulkSubmitResult `json:"results"`
+}
+
+// bulkItem is a job of a bulk submit on its way through the checks.
+type bulkItem struct {
+	index   int
+	req     SubmitRequest
+	queue   string
+	payload string
+}
+
+// BulkSubmitHandler submits up to config.MaxBulkSubmitJobs jobs at once, as a
+// JSON array of submit requests or, with Content-Type application/x-ndjson,
+// one per line. Each job goes through the same checks as SubmitHandler and
+// is accepted or rejected on its own; rate limits count jobs rather than
+// requests. Accepted jobs are inserted in batches and queued in one Redis
+// pipeline.
+func (a *API) BulkSubmitHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUser(r)
+	if !ok {
+		http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, config.MaxBulkSubmitBytes)
+	raws, err := decodeBulk(r)
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) || errors.Is(err, errTooManyJobs) {
+			http.Error(w, fmt.Sprintf("a bulk submit takes at most %d jobs and %d bytes", config.MaxBulkSubmitJobs, config.MaxBulkSubmitBytes), http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.Error(w, "invalid request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(raws) == 0 {
+		http.Error(w, "no jobs to submit", http.StatusBadRequest)
+		return
+	}
+
+	resp := BulkSubmitResponse{BatchID: uuid.NewString(), Results: make([]BulkSubmitResult, len(raws))}
+	var retryAfter time.Duration
+	reject := func(items []bulkItem, msg string) {
+		for _, item := range items {
+			resp.Results[item.index].Error = msg
+		}
+	}
+
+	var pending []bulkItem
+	for i, raw := range raws {
+		resp.Results[i].Index = i
+		var req SubmitRequest
+		if err := json.Unmarshal(raw, &req); err != nil {
+			resp.Results[i].Error = "invalid job: " + err.Error()
+			continue
+		}
+		if req.Type == "" {
+			resp.Results[i].Error = "type is required"
+			continue
+		}
+		payloadJSON, err := json.Marshal(req.Payload)
+		if err != nil {
+			resp.Results[i].Error = "failed to marshal payload"
+			continue
+		}
+		pending = append(pending, bulkItem{index: i, req: req, queue: heuristics.GetPriorityQueue(req.Type), payload: string(payloadJSON)})
+	}
+
+	// RateLimit counted the request itself once, which pays for the first
+	// job; the rest are counted here.
+	if len(pending) > 1 {
+		taken, wait := a.takeRate(r, "user:"+user.ID, a.limiter.Limits().ForUser(user), len(pending)-1)
+		reject(pending[taken+1:], "rate limit exceeded")
+		pending = pending[:taken+1]
+		retryAfter = max(retryAfter, wait)
+	}
+
+	draining := make(map[string]bool)
+	reserved := make(map[string]int)
+	var accepted []bulkItem
+	for _, group := range groupItems(pending, func(item bulkItem) string { return item.req.ProjectID }) {
+		projectID := group[0].req.ProjectID
+		if _, status, msg := a.checkRole(r, projectID, models.RoleMember); status != http.StatusOK {
+			reject(group, msg)
+			continue
+		}
+		if limit, ok := a.limiter.Limits().ForProject(projectID); ok {
+			taken, wait := a.takeRate(r, "project:"+projectID, limit, len(group))
+			reject(group[taken:], "project rate limit exceeded")
+			group = group[:taken]
+			retryAfter = max(retryAfter, wait)
+		}
+
+		var admitted []bulkItem
+		for _, queued := range groupItems(group, func(item bulkItem) string { return item.queue }) {
+			queueName := queued[0].queue
+			var open []bulkItem
+			for _, item := range queued {
+				drained, ok := draining[item.req.Type]
+				if !ok {
+					var err error
+					if drained, err = a.controls.Draining(r.Context(), queueName, item.req.Type); err != nil {
+						a.logger.Warn("failed to read queue state", zap.Error(err), zap.String("queue", queueName))
+					}
+					draining[item.req.Type] = drained
+				}
+				if drained {
+					resp.Results[item.index].Error = "queue is draining and not accepting new jobs"
+					continue
+				}
+				open = append(open, item)
+			}
+			if len(open) == 0 {
+				continue
+			}
+
+			room, u := a.backlogRoom(r, queueName, projectID, int64(len(admitted)))
+			if int64(len(open)) > room {
+				a.backlogRejected(queueName, u)
+				reject(open[room:], fmt.Sprintf("%s backlog is full (%d/%d jobs waiting)", u.Scope, u.Depth, u.Limit))
+				open = open[:room]
+				retryAfter = max(retryAfter, a.backlog.RetryAfter())
+			}
+			admitted = append(admitted, open...)
+		}
+		if len(admitted) == 0 {
+			continue
+		}
+
+		n, quota := a.reserveUpTo(r, projectID, len(admitted))
+		if n < len(admitted) {
+			reject(admitted[n:], fmt.Sprintf("monthly job quota exceeded (%d/%d jobs in %s)", quota.Used, quota.Limit, quota.Month))
+			retryAfter = max(retryAfter, time.Until(quota.Reset()))
+		}
+		reserved[projectID] = n
+		accepted = append(accepted, admitted[:n]...)
+	}
+
+	if len(accepted) > 0 {
+		jobIDs, err := a.createBulk(r, resp.BatchID, accepted)
+		if err != nil {
+			for projectID, n := range reserved {
+				a.meter.Release(r.Context(), projectID, int64(n))
+			}
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		for i, item := range accepted {
+			resp.Results[item.index].JobID = jobIDs[i]
+		}
+	}
+
+	resp.Accepted = len(accepted)
+	resp.Rejected = len(raws) - len(accepted)
+	status := http.StatusAccepted
+	if resp.Accepted == 0 {
+		status = http.StatusUnprocessableEntity
+		if retryAfter > 0 {
+			status = http.StatusTooManyRequests
+		}
+	}
+	if retryAfter > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(retryAfter.Seconds())+1))
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(resp)
+}
+
+var errTooManyJobs = errors.New("too many jobs")
+
+// decodeBulk reads the jobs of a bulk submit, each kept raw so that a
+// malformed job is rejected alone.
+func decodeBulk(r *http.Request) ([]json.RawMessage, error) {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType != "application/x-ndjson" {
+		var raws []json.RawMessage
+		if err := json.NewDecoder(r.Body).Decode(&raws); err != nil {
+			return nil, err
+		}
+		if len(raws) > config.MaxBulkSubmitJobs {
+			return nil, errTooManyJobs
+		}
+		return raws, nil
+	}
+
+	var raws []json.RawMessage
+	scanner := bufio.NewScanner(r.Body)
+	scanner.Buffer(make([]byte, 0, 64*1024), config.MaxBulkSubmitBytes)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		if len(raws) == config.MaxBulkSubmitJobs {
+			return nil, errTooManyJobs
+		}
+		raws = append(raws, json.RawMessage(append([]byte(nil), line...)))
+	}
+	return raws, scanner.Err()
+}
+
+// groupItems splits items by key, keeping their order within each group and
+// the groups in order of first appearance.
+func groupItems(items []bulkItem, key func(bulkItem) string) [][]bulkItem {
+	index := make(map[string]int)
+	var groups [][]bulkItem
+	for _, item := range items {
+		k := key(item)
+		i, ok := index[k]
+		if !ok {
+			i = len(groups)
+			index[k] = i
+			groups = append(groups, nil)
+		}
+		groups[i] = append(groups[i], item)
+	}
+	return groups
+}
+
+// takeRate counts up to n jobs against an API rate limit and returns how
+// many it allowed, and how long to wait for more if not all were. Redis
+// errors let all n through, as in RateLimit.
+func (a *API) takeRate(r *http.Request, key string, limit throttle.APILimit, n int) (int, time.Duration) {
+	taken, decision, err := a.limiter.Take(r.Context(), key, limit, n)
+	if err != nil {
+		a.logger.Error("failed to check rate limit", zap.Error(err), zap.String("key", key))
+		return n, 0
+	}
+	if decision.Allowed {
+		return taken, 0
+	}
+	return taken, decision.RetryAfter
+}
+
+// reserveUpTo takes up to n jobs from the project's monthly quota and returns
+// how many it took. Redis or database errors let all n through, as in
+// reserveQuota.
+func (a *API) reserveUpTo(r *http.Request, projectID string, n int) (int, usage.Quota) {
+	quota, ok, err := a.meter.Reserve(r.Context(), projectID, int64(n))
+	if err != nil {
+		a.logger.Error("failed to check quota", zap.Error(err), zap.String("project_id", projectID))
+		return n, quota
+	}
+	if ok {
+		return n, quota
+	}
+	taken := 0
+	if left := quota.Limit - quota.Used; left > 0 {
+		// Another submit may have taken what was left in the meantime.
+		q, ok, err := a.meter.Reserve(r.Context(), projectID, left)
+		switch {
+		case err != nil:
+			a.logger.Error("failed to check quota", zap.Error(err), zap.String("project_id", projectID))
+			return int(left), q
+		case ok:
+			quota, taken = q, int(left)
+		}
+	}
+	a.logger.Warn("monthly quota exceeded, rejecting part of bulk submit", zap.String("project_id", projectID), zap.Int64("used", quota.Used), zap.Int64("limit", quota.Limit))
+	return taken, quota
+}
+
+// createBulk inserts the accepted jobs in batches, queues them in one
+// pipeline and counts them as submitted. It returns their IDs in order. If
+// queueing fails, the inserted jobs are deleted again.
+func (a *API) createBulk(r *http.Request, batchID string, items []bulkItem) ([]string, error) {
+	now := time.Now()
+	jobs := make([]models.Job, len(items))
+	byQueue := make(map[string][]string)
+	for i, item := range items {
+		jobs[i] = models.Job{
+			ID:        uuid.NewString(),
+			Type:      item.req.Type,
+			Payload:   item.payload,
+			Status:    models.StatusQueued,
+			CreatedAt: now,
+			UpdatedAt: now,
+			ProjectID: item.req.ProjectID,
+			BatchID:   &batchID,
+		}
+		if item.req.WorkflowID != "" {
+			jobs[i].WorkflowID = &items[i].req.WorkflowID
+		}
+		if info, ok := a.registry.Info(item.req.Type); ok && info.MaxRetries > 0 {
+			jobs[i].MaxRetries = info.MaxRetries
+		}
+		byQueue[item.queue] = append(byQueue[item.queue], jobs[i].ID)
+	}
+
+	if err := a.db.CreateInBatches(&jobs, config.BulkInsertBatchSize).Error; err != nil {
+		a.logger.Error("failed to create jobs", zap.Error(err), zap.String("batch_id", batchID))
+		return nil, errors.New("failed to create jobs")
+	}
+	ids := make([]string, len(jobs))
+	for i, job := range jobs {
+		ids[i] = job.ID
+	}
+	if err := queue.PushAll(r.Context(), a.rdb, byQueue); err != nil {
+		a.logger.Error("failed to enqueue jobs", zap.Error(err), zap.String("batch_id", batchID))
+		// The request may have been cancelled, but the rows must not be
+		// left behind as queued jobs no worker will ever see.
+		ctx := context.WithoutCancel(r.Context())
+		if err := a.db.WithContext(ctx).Where("id IN ?", ids).Delete(&models.Job{}).Error; err != nil {
+			a.logger.Error("failed to delete unqueued jobs", zap.Error(err), zap.String("batch_id", batchID))
+		}
+		return nil, errors.New("failed to enqueue jobs")
+	}
+
+	type counter struct{ projectID, jobType string }
+	counts := make(map[counter]int)
+	for _, job := range jobs {
+		counts[counter{job.ProjectID, job.Type}]++
+	}
+	for c, n := range counts {
+		a.meter.Submitted(r.Context(), c.projectID, c.jobType, n)
+	}
+	return ids, nil
+}
@@ -0,0 +1,142 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"jobqueue/internal/auth"
+	"jobqueue/internal/config"
+	"jobqueue/internal/control"
+	"jobqueue/internal/models"
+	"jobqueue/internal/throttle"
+	"jobqueue/internal/usage"
+)
+
+func TestDecodeBulk(t *testing.T) {
+	r := httptest.NewRequest("POST", "/api/v1/job/submit/bulk", strings.NewReader(`[{"type":"a"}, {"type":"b"}]`))
+	raws, err := decodeBulk(r)
+	require.NoError(t, err)
+	assert.Len(t, raws, 2)
+
+	r = httptest.NewRequest("POST", "/api/v1/job/submit/bulk", strings.NewReader("{\"type\":\"a\"}\n\nnot json\n{\"type\":\"b\"}\n"))
+	r.Header.Set("Content-Type", "application/x-ndjson; charset=utf-8")
+	raws, err = decodeBulk(r)
+	require.NoError(t, err)
+	require.Len(t, raws, 3)
+	assert.Equal(t, "not json", string(raws[1]))
+
+	r = httptest.NewRequest("POST", "/api/v1/job/submit/bulk", strings.NewReader(`{"type":"a"}`))
+	_, err = decodeBulk(r)
+	assert.Error(t, err)
+}
+
+func TestGroupItems(t *testing.T) {
+	items := []bulkItem{{index: 0, queue: "b"}, {index: 1, queue: "a"}, {index: 2, queue: "b"}}
+	groups := groupItems(items, func(item bulkItem) string { return item.queue })
+	require.Len(t, groups, 2)
+	assert.Equal(t, []bulkItem{items[0], items[2]}, groups[0])
+	assert.Equal(t, []bulkItem{items[1]}, groups[1])
+}
+
+func TestBulkSubmitProjectBacklogSpansQueues(t *testing.T) {
+	s := newTestServer(t)
+	user, key := s.user(t, auth.AllScopes...)
+	projectID := s.project(t, map[string]string{user.ID: models.RoleMember})
+	s.api.backlog = throttle.NewBacklog(s.db, s.rdb, nil, 0, map[string]int{projectID: 2}, 0, config.DefaultBacklogSoftWatermark, config.DefaultBacklogRetryAfter)
+
+	jobs := []SubmitRequest{{Type: "email", ProjectID: projectID}, {Type: "pdf", ProjectID: projectID}, {Type: "ai_summary", ProjectID: projectID}}
+	rec := s.do(t, "POST", "/api/v1/job/submit/bulk", key, jobs)
+	require.Equal(t, http.StatusAccepted, rec.Code, rec.Body.String())
+	var resp BulkSubmitResponse
+	decode(t, rec, &resp)
+	assert.Equal(t, 2, resp.Accepted)
+	assert.Contains(t, resp.Results[2].Error, "project backlog is full")
+}
+
+func TestBulkSubmitPartialRejections(t *testing.T) {
+	s := newTestServer(t)
+	user, key := s.user(t, auth.AllScopes...)
+	projectID := s.project(t, map[string]string{user.ID: models.RoleMember})
+	otherID := s.project(t, nil)
+
+	submit := func(t *testing.T, key string, jobs []SubmitRequest) BulkSubmitResponse {
+		t.Helper()
+		rec := s.do(t, "POST", "/api/v1/job/submit/bulk", key, jobs)
+		require.Equal(t, http.StatusAccepted, rec.Code, rec.Body.String())
+		var resp BulkSubmitResponse
+		decode(t, rec, &resp)
+		require.Len(t, resp.Results, len(jobs))
+		return resp
+	}
+
+	t.Run("project membership", func(t *testing.T) {
+		resp := submit(t, key, []SubmitRequest{{Type: "email", ProjectID: otherID}, {Type: "email", ProjectID: projectID}})
+		assert.Equal(t, 1, resp.Accepted)
+		assert.Equal(t, "project not found", resp.Results[0].Error)
+		assert.NotEmpty(t, resp.Results[1].JobID)
+	})
+
+	t.Run("draining", func(t *testing.T) {
+		jobType := "drained-" + uuid.NewString()
+		require.NoError(t, s.api.controls.Set(context.Background(), control.KindType, jobType, control.StateDraining))
+		t.Cleanup(func() { s.api.controls.Set(context.Background(), control.KindType, jobType, control.StateActive) })
+
+		resp := submit(t, key, []SubmitRequest{{Type: jobType, ProjectID: projectID}, {Type: "email", ProjectID: projectID}})
+		assert.Equal(t, 1, resp.Accepted)
+		assert.Contains(t, resp.Results[0].Error, "draining")
+	})
+
+	t.Run("quota", func(t *testing.T) {
+		meter := s.api.meter
+		t.Cleanup(func() { s.api.meter = meter })
+		quotaProject := s.project(t, map[string]string{user.ID: models.RoleMember})
+		s.api.meter = usage.NewMeter(s.db, s.rdb, map[string]int{quotaProject: 2}, 0, zap.NewNop())
+
+		resp := submit(t, key, []SubmitRequest{{Type: "email", ProjectID: quotaProject}, {Type: "email", ProjectID: quotaProject}, {Type: "email", ProjectID: quotaProject}})
+		assert.Equal(t, 2, resp.Accepted)
+		assert.Contains(t, resp.Results[2].Error, "monthly job quota exceeded")
+	})
+
+	t.Run("rate limit", func(t *testing.T) {
+		s.setLimits(throttle.APILimits{Default: throttle.APILimit{Rate: config.RateLimit{Count: 1, Per: time.Hour}, Burst: 3}})
+		rateUser, rateKey := s.user(t, auth.AllScopes...)
+		rateProject := s.project(t, map[string]string{rateUser.ID: models.RoleMember})
+
+		jobs := make([]SubmitRequest, 5)
+		for i := range jobs {
+			jobs[i] = SubmitRequest{Type: "email", ProjectID: rateProject}
+		}
+		resp := submit(t, rateKey, jobs)
+		assert.Equal(t, 3, resp.Accepted)
+		assert.Equal(t, "rate limit exceeded", resp.Results[4].Error)
+	})
+}
+
+func TestBulkSubmitDeletesJobsWhenQueueingFails(t *testing.T) {
+	s := newTestServer(t)
+	user, key := s.user(t, auth.AllScopes...)
+	projectID := s.project(t, map[string]string{user.ID: models.RoleMember})
+
+	opts, err := redis.ParseURL(os.Getenv("REDIS_URL"))
+	require.NoError(t, err)
+	broken := redis.NewClient(opts)
+	broken.Close()
+	s.api.rdb = broken
+
+	rec := s.do(t, "POST", "/api/v1/job/submit/bulk", key, []SubmitRequest{{Type: "email", ProjectID: projectID}, {Type: "pdf", ProjectID: projectID}})
+	assert.Equal(t, http.StatusInternalServerError, rec.Code, rec.Body.String())
+
+	var jobs int64
+	require.NoError(t, s.db.Model(&models.Job{}).Where("project_id = ?", projectID).Count(&jobs).Error)
+	assert.Zero(t, jobs)
+}
@@ -3,7 +3,10 @@ package api
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
+	"math"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/go-chi/chi/v5"
@@ -13,19 +16,38 @@ import (
 	"jobqueue/internal/heuristics"
 	"jobqueue/internal/middleware"
 	"jobqueue/internal/models"
+	"jobqueue/internal/queue"
+	"jobqueue/internal/throttle"
 )
 
 type SubmitRequest struct {
-	ProjectID string                 `json:"project_id"`
-	Type      string                 `json:"type"`
-	Payload   map[string]interface{} `json:"payload"`
-	JobID     string                 `json:"job_id"`
+	ProjectID  string                 `json:"project_id"`
+	Type       string                 `json:"type"`
+	Payload    map[string]interface{} `json:"payload"`
+	JobID      string                 `json:"job_id"`
+	WorkflowID string                 `json:"workflow_id,omitempty"` // optional, groups related jobs for listing
 }
 
 type SubmitResponse struct {
 	JobID string `json:"job_id"`
 }
 
+// JobResponse is a job along with the operator state of its queue and type,
+// so callers can tell why a queued job is not moving.
+type JobResponse struct {
+	models.Job
+	QueueState string              `json:"queue_state"`
+	Attempts   []models.JobAttempt `json:"attempts,omitempty"`
+}
+
+func (a *API) jobResponse(r *http.Request, job models.Job) JobResponse {
+	state, err := a.controls.Effective(r.Context(), heuristics.GetPriorityQueue(job.Type), job.Type)
+	if err != nil {
+		a.logger.Warn("failed to read queue state", zap.Error(err), zap.String("job_id", job.ID))
+	}
+	return JobResponse{Job: job, QueueState: state}
+}
+
 func (a *API) SubmitHandler(w http.ResponseWriter, r *http.Request) {
 	_, ok := middleware.GetUser(r)
 	if !ok {
@@ -39,13 +61,31 @@ func (a *API) SubmitHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// TODO: Validate that user is a member of req.ProjectID
+	if _, ok := a.authorize(w, r, req.ProjectID, models.RoleMember); !ok {
+		return
+	}
+
+	queueName := heuristics.GetPriorityQueue(req.Type)
+	draining, err := a.controls.Draining(r.Context(), queueName, req.Type)
+	if err != nil {
+		a.logger.Warn("failed to read queue state", zap.Error(err), zap.String("queue", queueName))
+	}
+	if draining {
+		http.Error(w, "queue is draining and not accepting new jobs", http.StatusServiceUnavailable)
+		return
+	}
+	if !a.admit(w, r, queueName, req.ProjectID) {
+		return
+	}
 
 	payloadJSON, err := json.Marshal(req.Payload)
 	if err != nil {
 		http.Error(w, "failed to marshal payload", http.StatusBadRequest)
 		return
 	}
+	if !a.reserveQuota(w, r, req.ProjectID, 1) {
+		return
+	}
 
 	job := models.Job{
 		ID:        uuid.NewString(),
@@ -56,30 +96,125 @@ func (a *API) SubmitHandler(w http.ResponseWriter, r *http.Request) {
 		UpdatedAt: time.Now(),
 		ProjectID: req.ProjectID,
 	}
+	if req.WorkflowID != "" {
+		job.WorkflowID = &req.WorkflowID
+	}
+	if info, ok := a.registry.Info(req.Type); ok && info.MaxRetries > 0 {
+		job.MaxRetries = info.MaxRetries
+	}
 	if err := a.db.Create(&job).Error; err != nil {
 		a.logger.Error("failed to create job", zap.Error(err))
+		a.meter.Release(r.Context(), req.ProjectID, 1)
 		http.Error(w, "failed to create job", http.StatusInternalServerError)
 		return
 	}
 
-	queueName := heuristics.GetPriorityQueue(req.Type)
-	if err := a.rdb.LPush(r.Context(), queueName, job.ID).Err(); err != nil {
+	if err := queue.Push(r.Context(), a.rdb, queueName, job.ID); err != nil {
 		a.logger.Error("failed to enqueue job", zap.Error(err), zap.String("job_id", job.ID))
+		a.meter.Release(r.Context(), req.ProjectID, 1)
 		http.Error(w, "failed to enqueue job", http.StatusInternalServerError)
 		return
 	}
+	a.meter.Submitted(r.Context(), job.ProjectID, job.Type, 1)
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusAccepted)
 	json.NewEncoder(w).Encode(SubmitResponse{JobID: job.ID})
 }
 
-func (a *API) StatusHandler(w http.ResponseWriter, r *http.Request) {
-	user, ok := middleware.GetUser(r)
+// limitProject counts cost requests against the project's API rate limit. It
+// runs only once the caller is known to be a member, so that outsiders cannot
+// use up a project's limit. It writes the rejection and returns false if the
+// limit is exceeded.
+func (a *API) limitProject(w http.ResponseWriter, r *http.Request, projectID string, cost int) bool {
+	limit, ok := a.limiter.Limits().ForProject(projectID)
 	if !ok {
-		http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
-		return
+		return true
+	}
+	decision, err := a.limiter.Allow(r.Context(), "project:"+projectID, limit, cost)
+	if err != nil {
+		a.logger.Error("failed to check project rate limit", zap.Error(err), zap.String("project_id", projectID))
+		return true
+	}
+	if !decision.Allowed {
+		decision.WriteHeaders(w.Header())
+		http.Error(w, "project rate limit exceeded", http.StatusTooManyRequests)
+		return false
+	}
+	return true
+}
+
+// reserveQuota takes n jobs from the project's monthly quota. It writes the
+// rejection and returns false if the quota would be exceeded; Redis or
+// database errors let the jobs through rather than blocking all submits.
+func (a *API) reserveQuota(w http.ResponseWriter, r *http.Request, projectID string, n int) bool {
+	quota, ok, err := a.meter.Reserve(r.Context(), projectID, int64(n))
+	if err != nil {
+		a.logger.Error("failed to check quota", zap.Error(err), zap.String("project_id", projectID))
+		return true
+	}
+	if !ok {
+		a.logger.Warn("monthly quota exceeded, rejecting submit", zap.String("project_id", projectID), zap.Int64("used", quota.Used), zap.Int64("limit", quota.Limit))
+		w.Header().Set("Retry-After", strconv.Itoa(int(time.Until(quota.Reset()).Seconds())+1))
+		http.Error(w, fmt.Sprintf("monthly job quota exceeded (%d/%d jobs in %s)", quota.Used, quota.Limit, quota.Month), http.StatusTooManyRequests)
+		return false
+	}
+	return true
+}
+
+// admit checks the queue and project backlogs before a submit. It writes the
+// rejection and returns false if either is full.
+func (a *API) admit(w http.ResponseWriter, r *http.Request, queueName, projectID string) bool {
+	room, u := a.backlogRoom(r, queueName, projectID, 0)
+	if room > 0 {
+		return true
+	}
+	a.backlogRejected(queueName, u)
+
+	status := http.StatusServiceUnavailable
+	if u.Scope == throttle.ScopeProject {
+		status = http.StatusTooManyRequests
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(int(a.backlog.RetryAfter().Seconds())))
+	http.Error(w, fmt.Sprintf("%s backlog is full (%d/%d jobs waiting)", u.Scope, u.Depth, u.Limit), status)
+	return false
+}
+
+// backlogRoom returns how many more jobs the queue and project backlogs take,
+// and the usage of the backlog with the least room. admitted is how many jobs
+// of the project this request has already let into other queues, which its
+// backlog does not count yet. A backlog that cannot be measured because of a
+// Redis or database error lets jobs through rather than blocking all
+// submits; the other is still checked.
+func (a *API) backlogRoom(r *http.Request, queueName, projectID string, admitted int64) (int64, throttle.BacklogUsage) {
+	room := int64(math.MaxInt64)
+	var tightest throttle.BacklogUsage
+	usages, err := a.backlog.Check(r.Context(), queueName, projectID)
+	if err != nil {
+		a.logger.Error("failed to check backlog", zap.Error(err), zap.String("queue", queueName), zap.String("project_id", projectID))
+	}
+
+	for _, u := range usages {
+		if u.Scope == throttle.ScopeProject {
+			u.Depth += admitted
+		}
+		if u.AboveWatermark() && !u.Full() {
+			a.metrics.BacklogWarnings.WithLabelValues(u.Scope, queueName).Inc()
+			a.logger.Warn("backlog above soft watermark", zap.String("scope", u.Scope), zap.String("name", u.Name), zap.Int64("depth", u.Depth), zap.Int64("limit", u.Limit))
+		}
+		if u.Room() < room {
+			room, tightest = u.Room(), u
+		}
 	}
+	return room, tightest
+}
+
+func (a *API) backlogRejected(queueName string, u throttle.BacklogUsage) {
+	a.metrics.BacklogRejections.WithLabelValues(u.Scope, queueName).Inc()
+	a.logger.Warn("backlog full, rejecting submit", zap.String("scope", u.Scope), zap.String("name", u.Name), zap.Int64("depth", u.Depth), zap.Int64("limit", u.Limit))
+}
+
+func (a *API) StatusHandler(w http.ResponseWriter, r *http.Request) {
 	jobID := chi.URLParam(r, "jobID")
 
 	var job models.Job
@@ -94,50 +229,15 @@ func (a *API) StatusHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Security Check: Ensure the user has access to the project this job belongs to.
-	var project models.Project
-	if err := a.db.First(&project, "id = ? AND user_id = ?", job.ProjectID, user.ID).Error; err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
-			http.Error(w, "forbidden", http.StatusForbidden)
-			return
-		}
-		a.logger.Error("failed to get project for auth check", zap.Error(err), zap.String("project_id", job.ProjectID))
-		http.Error(w, "internal server error", http.StatusInternalServerError)
+	if _, ok := a.authorize(w, r, job.ProjectID, models.RoleViewer); !ok {
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(job)
-}
-
-func (a *API) ListHandler(w http.ResponseWriter, r *http.Request) {
-	user, ok := middleware.GetUser(r)
-	if !ok {
-		http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
-		return
+	resp := a.jobResponse(r, job)
+	if err := a.db.Where("job_id = ?", job.ID).Order("attempt asc").Find(&resp.Attempts).Error; err != nil {
+		a.logger.Error("failed to get job attempts", zap.Error(err), zap.String("job_id", job.ID))
 	}
-	projectID := r.URL.Query().Get("projectID")
-	if projectID == "" {
-		http.Error(w, "projectID query parameter is required", http.StatusBadRequest)
-		return
-	}
-
-	// Security Check: Ensure the user has access to the project.
-	var project models.Project
-	if err := a.db.First(&project, "id = ? AND user_id = ?", projectID, user.ID).Error; err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
-			http.Error(w, "forbidden", http.StatusForbidden)
-			return
-		}
-		a.logger.Error("failed to get project for auth check", zap.Error(err), zap.String("project_id", projectID))
-		http.Error(w, "internal server error", http.StatusInternalServerError)
-		return
-	}
-
-	var jobs []models.Job
-	a.db.Where("project_id = ?", projectID).
-		Order("created_at desc").
-		Find(&jobs)
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(jobs)
+	json.NewEncoder(w).Encode(resp)
 }
@@ -0,0 +1,295 @@
+package api
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"jobqueue/internal/config"
+	"jobqueue/internal/heuristics"
+	"jobqueue/internal/models"
+)
+
+// jobSorts are the orders jobs can be listed in, by ?sort= value. A leading
+// "-" sorts descending. Ties are broken by job ID in the same direction.
+var jobSorts = map[string]jobSort{
+	"created_at":  {column: "created_at"},
+	"-created_at": {column: "created_at", desc: true},
+	"updated_at":  {column: "updated_at"},
+	"-updated_at": {column: "updated_at", desc: true},
+}
+
+const defaultJobSort = "-created_at"
+
+type jobSort struct {
+	column string
+	desc   bool
+}
+
+func (s jobSort) value(job models.Job) time.Time {
+	if s.column == "updated_at" {
+		return job.UpdatedAt
+	}
+	return job.CreatedAt
+}
+
+// jobFilter narrows a job listing. Zero fields do not filter.
+type jobFilter struct {
+	Statuses      []string
+	Types         []string
+	CreatedAfter  time.Time
+	CreatedBefore time.Time
+	UpdatedAfter  time.Time
+	UpdatedBefore time.Time
+	BatchID       string
+	WorkflowID    string
+}
+
+var jobStatuses = map[string]bool{
+	models.StatusQueued:    true,
+	models.StatusScheduled: true,
+	models.StatusRunning:   true,
+	models.StatusCompleted: true,
+	models.StatusFailed:    true,
+}
+
+// parseJobFilter reads ?status= and ?type= (comma-separated), the
+// ?created_after=, ?created_before=, ?updated_after= and ?updated_before=
+// times (RFC 3339), ?batch_id= and ?workflow_id=.
+func parseJobFilter(query url.Values) (jobFilter, error) {
+	f := jobFilter{
+		Statuses:   config.ParseList(query.Get("status")),
+		Types:      config.ParseList(query.Get("type")),
+		BatchID:    query.Get("batch_id"),
+		WorkflowID: query.Get("workflow_id"),
+	}
+	for _, status := range f.Statuses {
+		if !jobStatuses[status] {
+			return jobFilter{}, fmt.Errorf("unknown status %q", status)
+		}
+	}
+	if f.BatchID != "" {
+		if _, err := uuid.Parse(f.BatchID); err != nil {
+			return jobFilter{}, errors.New("batch_id must be a UUID")
+		}
+	}
+
+	times := []struct {
+		param string
+		dst   *time.Time
+	}{
+		{"created_after", &f.CreatedAfter},
+		{"created_before", &f.CreatedBefore},
+		{"updated_after", &f.UpdatedAfter},
+		{"updated_before", &f.UpdatedBefore},
+	}
+	for _, t := range times {
+		s := query.Get(t.param)
+		if s == "" {
+			continue
+		}
+		v, err := time.Parse(time.RFC3339Nano, s)
+		if err != nil {
+			return jobFilter{}, fmt.Errorf("%s must be an RFC 3339 time", t.param)
+		}
+		*t.dst = v
+	}
+	return f, nil
+}
+
+// apply adds the filter's conditions to db.
+func (f jobFilter) apply(db *gorm.DB) *gorm.DB {
+	if len(f.Statuses) > 0 {
+		db = db.Where("status IN ?", f.Statuses)
+	}
+	if len(f.Types) > 0 {
+		db = db.Where("type IN ?", f.Types)
+	}
+	if !f.CreatedAfter.IsZero() {
+		db = db.Where("created_at >= ?", f.CreatedAfter)
+	}
+	if !f.CreatedBefore.IsZero() {
+		db = db.Where("created_at < ?", f.CreatedBefore)
+	}
+	if !f.UpdatedAfter.IsZero() {
+		db = db.Where("updated_at >= ?", f.UpdatedAfter)
+	}
+	if !f.UpdatedBefore.IsZero() {
+		db = db.Where("updated_at < ?", f.UpdatedBefore)
+	}
+	if f.BatchID != "" {
+		db = db.Where("batch_id = ?", f.BatchID)
+	}
+	if f.WorkflowID != "" {
+		db = db.Where("workflow_id = ?", f.WorkflowID)
+	}
+	return db
+}
+
+// jobCursor is the position after the last job of a page. It is handed to
+// callers base64-encoded and is only valid with the sort it was made for.
+type jobCursor struct {
+	Sort  string    `json:"s"`
+	Value time.Time `json:"v"`
+	ID    string    `json:"id"`
+}
+
+func (c jobCursor) encode() string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeJobCursor(s string) (jobCursor, error) {
+	var c jobCursor
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return c, err
+	}
+	err = json.Unmarshal(data, &c)
+	return c, err
+}
+
+// jobPage is one page of a job listing: up to limit jobs in sort order,
+// after cursor if it is set.
+type jobPage struct {
+	sortName string
+	sort     jobSort
+	limit    int
+	cursor   *jobCursor
+}
+
+// parseJobPage reads ?sort= (created_at, updated_at, or either prefixed with
+// "-" for descending; newest first by default), ?limit= and ?cursor=.
+func parseJobPage(query url.Values) (jobPage, error) {
+	p := jobPage{sortName: query.Get("sort"), limit: config.DefaultJobPageSize}
+	if p.sortName == "" {
+		p.sortName = defaultJobSort
+	}
+	var ok bool
+	if p.sort, ok = jobSorts[p.sortName]; !ok {
+		return jobPage{}, errors.New("sort must be one of created_at, -created_at, updated_at, -updated_at")
+	}
+	if s := query.Get("limit"); s != "" {
+		limit, err := strconv.Atoi(s)
+		if err != nil || limit < 1 || limit > config.MaxJobPageSize {
+			return jobPage{}, fmt.Errorf("limit must be between 1 and %d", config.MaxJobPageSize)
+		}
+		p.limit = limit
+	}
+	if s := query.Get("cursor"); s != "" {
+		cursor, err := decodeJobCursor(s)
+		if err != nil || cursor.Sort != p.sortName {
+			return jobPage{}, errors.New("invalid cursor")
+		}
+		p.cursor = &cursor
+	}
+	return p, nil
+}
+
+// fetch reads the page from db, which selects the jobs to list, and returns
+// the cursor of the next page, empty if this is the last.
+func (p jobPage) fetch(db *gorm.DB) ([]models.Job, string, error) {
+	dir, cmp := "asc", ">"
+	if p.sort.desc {
+		dir, cmp = "desc", "<"
+	}
+	if p.cursor != nil {
+		db = db.Where(fmt.Sprintf("(%s, id) %s (?, ?)", p.sort.column, cmp), p.cursor.Value, p.cursor.ID)
+	}
+
+	var jobs []models.Job
+	if err := db.Order(p.sort.column + " " + dir).Order("id " + dir).Limit(p.limit + 1).Find(&jobs).Error; err != nil {
+		return nil, "", err
+	}
+	if len(jobs) <= p.limit {
+		return jobs, "", nil
+	}
+	jobs = jobs[:p.limit]
+	last := jobs[len(jobs)-1]
+	return jobs, jobCursor{Sort: p.sortName, Value: p.sort.value(last), ID: last.ID}.encode(), nil
+}
+
+type JobListResponse struct {
+	Jobs []JobResponse `json:"jobs"`
+	// NextCursor fetches the next page as ?cursor=; it is empty on the last
+	// page.
+	NextCursor string `json:"next_cursor,omitempty"`
+	// Total is how many jobs match the filters, across all pages.
+	Total int64 `json:"total"`
+}
+
+// ListHandler lists a project's jobs a page at a time. See parseJobFilter
+// for the filters and parseJobPage for paging and sorting.
+func (a *API) ListHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	projectID := query.Get("projectID")
+	if projectID == "" {
+		http.Error(w, "projectID query parameter is required", http.StatusBadRequest)
+		return
+	}
+
+	// Security Check: Ensure the user has access to the project.
+	if _, ok := a.authorize(w, r, projectID, models.RoleViewer); !ok {
+		return
+	}
+
+	filter, err := parseJobFilter(query)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	page, err := parseJobPage(query)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	base := filter.apply(a.db.Model(&models.Job{}).Where("project_id = ?", projectID)).Session(&gorm.Session{})
+
+	var total int64
+	if err := base.Count(&total).Error; err != nil {
+		a.logger.Error("failed to count jobs", zap.Error(err), zap.String("project_id", projectID))
+		http.Error(w, "failed to list jobs", http.StatusInternalServerError)
+		return
+	}
+
+	jobs, next, err := page.fetch(base)
+	if err != nil {
+		a.logger.Error("failed to list jobs", zap.Error(err), zap.String("project_id", projectID))
+		http.Error(w, "failed to list jobs", http.StatusInternalServerError)
+		return
+	}
+
+	resp := JobListResponse{Jobs: a.jobResponses(r, jobs), NextCursor: next, Total: total}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// jobResponses is jobResponse for many jobs, reading each queue and type's
+// state once.
+func (a *API) jobResponses(r *http.Request, jobs []models.Job) []JobResponse {
+	states := make(map[string]string)
+	resp := make([]JobResponse, 0, len(jobs))
+	for _, job := range jobs {
+		state, ok := states[job.Type]
+		if !ok {
+			var err error
+			state, err = a.controls.Effective(r.Context(), heuristics.GetPriorityQueue(job.Type), job.Type)
+			if err != nil {
+				a.logger.Warn("failed to read queue state", zap.Error(err), zap.String("job_id", job.ID))
+			}
+			states[job.Type] = state
+		}
+		resp = append(resp, JobResponse{Job: job, QueueState: state})
+	}
+	return resp
+}
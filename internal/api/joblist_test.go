@@ -0,0 +1,43 @@
+package api
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseJobFilter(t *testing.T) {
+	f, err := parseJobFilter(url.Values{
+		"status":        {"queued, failed"},
+		"type":          {"email:send"},
+		"created_after": {"2026-03-01T00:00:00Z"},
+		"batch_id":      {"6f1c2b9e-0000-4000-8000-000000000001"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"queued", "failed"}, f.Statuses)
+	assert.Equal(t, []string{"email:send"}, f.Types)
+	assert.Equal(t, time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC), f.CreatedAfter)
+	assert.True(t, f.UpdatedBefore.IsZero())
+
+	_, err = parseJobFilter(url.Values{"status": {"done"}})
+	assert.Error(t, err)
+	_, err = parseJobFilter(url.Values{"updated_before": {"yesterday"}})
+	assert.Error(t, err)
+	_, err = parseJobFilter(url.Values{"batch_id": {"1; DROP TABLE jobs"}})
+	assert.Error(t, err)
+}
+
+func TestJobCursor(t *testing.T) {
+	c := jobCursor{Sort: "-created_at", Value: time.Date(2026, 3, 1, 12, 0, 0, 123456000, time.UTC), ID: "6f1c2b9e-0000-4000-8000-000000000001"}
+	decoded, err := decodeJobCursor(c.encode())
+	require.NoError(t, err)
+	assert.True(t, c.Value.Equal(decoded.Value))
+	assert.Equal(t, c.ID, decoded.ID)
+	assert.Equal(t, c.Sort, decoded.Sort)
+
+	_, err = decodeJobCursor("not a cursor")
+	assert.Error(t, err)
+}
@@ -0,0 +1,38 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"jobqueue/internal/heuristics"
+)
+
+type JobTypeResponse struct {
+	Type       string          `json:"type"`
+	Queue      string          `json:"queue"`
+	Timeout    string          `json:"timeout,omitempty"`
+	MaxRetries int             `json:"max_retries,omitempty"`
+	Schema     json.RawMessage `json:"schema,omitempty"`
+}
+
+// JobTypesHandler lists the job types with a registered processor and the
+// queue each is routed to.
+func (a *API) JobTypesHandler(w http.ResponseWriter, r *http.Request) {
+	infos := a.registry.List()
+	resp := make([]JobTypeResponse, 0, len(infos))
+	for _, info := range infos {
+		item := JobTypeResponse{
+			Type:       info.Type,
+			Queue:      heuristics.GetPriorityQueue(info.Type),
+			MaxRetries: info.MaxRetries,
+			Schema:     info.Schema,
+		}
+		if info.Timeout > 0 {
+			item.Timeout = info.Timeout.String()
+		}
+		resp = append(resp, item)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
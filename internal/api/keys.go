@@ -0,0 +1,281 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"jobqueue/internal/auth"
+	"jobqueue/internal/config"
+	"jobqueue/internal/middleware"
+	"jobqueue/internal/models"
+)
+
+type CreateAPIKeyRequest struct {
+	Name      string     `json:"name"`
+	Scopes    []string   `json:"scopes"`
+	ProjectID *string    `json:"project_id"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+type RotateAPIKeyRequest struct {
+	// Grace keeps the old key working for a while, e.g. "1h", so that
+	// clients can switch over. By default it is revoked at once.
+	Grace string `json:"grace"`
+}
+
+// APIKeyResponse is a key's metadata. Key is only set when the key has just
+// been created; it cannot be retrieved again.
+type APIKeyResponse struct {
+	models.APIKey
+	Key string `json:"key,omitempty"`
+}
+
+// issueAPIKey creates a key and returns it along with its plaintext.
+func issueAPIKey(db *gorm.DB, userID string, projectID *string, name string, scopes []string, expiresAt *time.Time) (APIKeyResponse, error) {
+	key, prefix, hash, err := auth.GenerateAPIKey()
+	if err != nil {
+		return APIKeyResponse{}, err
+	}
+	apiKey := models.APIKey{
+		ID:        uuid.NewString(),
+		UserID:    userID,
+		ProjectID: projectID,
+		Name:      name,
+		Prefix:    prefix,
+		Hash:      hash,
+		Scopes:    scopes,
+		ExpiresAt: expiresAt,
+		CreatedAt: time.Now(),
+	}
+	if err := db.Create(&apiKey).Error; err != nil {
+		return APIKeyResponse{}, err
+	}
+	return APIKeyResponse{APIKey: apiKey, Key: key}, nil
+}
+
+// unrestricted rejects requests made with a key limited to one project,
+// which must not manage the account it belongs to. It writes the response
+// itself when it returns false.
+func unrestricted(w http.ResponseWriter, r *http.Request) bool {
+	if key, ok := middleware.GetAPIKey(r); ok && key.ProjectID != nil {
+		http.Error(w, "forbidden: API key is limited to a project", http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+// errScopeNotHeld is returned when a caller tries to issue a key with a scope
+// their own credential lacks.
+var errScopeNotHeld = errors.New("scope not held")
+
+// missingScope returns the first of scopes that held does not include.
+func missingScope(held, scopes []string) (string, bool) {
+	for _, scope := range scopes {
+		if !auth.HasScope(held, scope) {
+			return scope, true
+		}
+	}
+	return "", false
+}
+
+// CreateAPIKeyHandler creates a key for the caller. Its scopes default to,
+// and may not exceed, those of the credential making the request; a login
+// session holds every scope.
+func (a *API) CreateAPIKeyHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUser(r)
+	if !ok {
+		http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+		return
+	}
+	if !unrestricted(w, r) {
+		return
+	}
+	scopes, _ := middleware.GetScopes(r)
+
+	var req CreateAPIKeyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		http.Error(w, "name is required", http.StatusBadRequest)
+		return
+	}
+	if len(req.Scopes) == 0 {
+		req.Scopes = scopes
+	}
+	for _, scope := range req.Scopes {
+		if !auth.ValidScope(scope) {
+			http.Error(w, "scopes must be among submit, read and admin", http.StatusBadRequest)
+			return
+		}
+	}
+	if scope, ok := missingScope(scopes, req.Scopes); ok {
+		http.Error(w, "forbidden: cannot grant the "+scope+" scope", http.StatusForbidden)
+		return
+	}
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+		http.Error(w, "expires_at must be in the future", http.StatusBadRequest)
+		return
+	}
+	if req.ProjectID != nil {
+		if _, ok := a.authorize(w, r, *req.ProjectID, models.RoleViewer); !ok {
+			return
+		}
+	}
+
+	resp, err := issueAPIKey(a.db, user.ID, req.ProjectID, req.Name, req.Scopes, req.ExpiresAt)
+	if err != nil {
+		a.logger.Error("failed to create api key", zap.Error(err))
+		http.Error(w, "failed to create api key", http.StatusInternalServerError)
+		return
+	}
+	a.logger.Info("api key created", zap.String("user_id", user.ID), zap.String("key_id", resp.ID))
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(resp)
+}
+
+// ListAPIKeysHandler returns the caller's keys, without their secrets.
+func (a *API) ListAPIKeysHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUser(r)
+	if !ok {
+		http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+		return
+	}
+	if !unrestricted(w, r) {
+		return
+	}
+
+	var keys []models.APIKey
+	if err := a.db.Where("user_id = ?", user.ID).Order("created_at desc").Find(&keys).Error; err != nil {
+		a.logger.Error("failed to list api keys", zap.Error(err))
+		http.Error(w, "failed to list api keys", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(keys)
+}
+
+// RevokeAPIKeyHandler revokes one of the caller's keys at once.
+func (a *API) RevokeAPIKeyHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUser(r)
+	if !ok {
+		http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+		return
+	}
+	if !unrestricted(w, r) {
+		return
+	}
+	keyID := chi.URLParam(r, "keyID")
+
+	res := a.db.Model(&models.APIKey{}).
+		Where("id = ? AND user_id = ? AND revoked_at IS NULL", keyID, user.ID).
+		Update("revoked_at", time.Now())
+	if res.Error != nil {
+		a.logger.Error("failed to revoke api key", zap.Error(res.Error), zap.String("key_id", keyID))
+		http.Error(w, "failed to revoke api key", http.StatusInternalServerError)
+		return
+	}
+	if res.RowsAffected == 0 {
+		http.Error(w, "api key not found", http.StatusNotFound)
+		return
+	}
+	a.logger.Info("api key revoked", zap.String("user_id", user.ID), zap.String("key_id", keyID))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// RotateAPIKeyHandler replaces one of the caller's keys with a new one of
+// the same name, scopes, project and lifetime, and retires the old key. As
+// when creating a key, the caller must hold every scope of the key.
+func (a *API) RotateAPIKeyHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUser(r)
+	if !ok {
+		http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+		return
+	}
+	if !unrestricted(w, r) {
+		return
+	}
+	keyID := chi.URLParam(r, "keyID")
+	scopes, _ := middleware.GetScopes(r)
+
+	var req RotateAPIKeyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	var grace time.Duration
+	if req.Grace != "" {
+		var err error
+		grace, err = time.ParseDuration(req.Grace)
+		if err != nil || grace < 0 || grace > config.MaxAPIKeyRotationGrace {
+			http.Error(w, "grace must be a duration of at most "+config.MaxAPIKeyRotationGrace.String(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	var resp APIKeyResponse
+	err := a.db.Transaction(func(tx *gorm.DB) error {
+		var old models.APIKey
+		if err := tx.First(&old, "id = ? AND user_id = ?", keyID, user.ID).Error; err != nil {
+			return err
+		}
+		now := time.Now()
+		if !old.Active(now) {
+			return gorm.ErrRecordNotFound
+		}
+		if scope, ok := missingScope(scopes, old.Scopes); ok {
+			return fmt.Errorf("%w: %s", errScopeNotHeld, scope)
+		}
+
+		var expiresAt *time.Time
+		if old.ExpiresAt != nil {
+			t := now.Add(old.ExpiresAt.Sub(old.CreatedAt))
+			expiresAt = &t
+		}
+		var err error
+		resp, err = issueAPIKey(tx, user.ID, old.ProjectID, old.Name, old.Scopes, expiresAt)
+		if err != nil {
+			return err
+		}
+
+		if grace == 0 {
+			return tx.Model(&old).Update("revoked_at", now).Error
+		}
+		retireAt := now.Add(grace)
+		if old.ExpiresAt != nil && old.ExpiresAt.Before(retireAt) {
+			return nil
+		}
+		return tx.Model(&old).Update("expires_at", retireAt).Error
+	})
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		http.Error(w, "api key not found", http.StatusNotFound)
+		return
+	}
+	if errors.Is(err, errScopeNotHeld) {
+		http.Error(w, "forbidden: cannot rotate a key with scopes this credential lacks", http.StatusForbidden)
+		return
+	}
+	if err != nil {
+		a.logger.Error("failed to rotate api key", zap.Error(err), zap.String("key_id", keyID))
+		http.Error(w, "failed to rotate api key", http.StatusInternalServerError)
+		return
+	}
+	a.logger.Info("api key rotated", zap.String("user_id", user.ID), zap.String("old_key_id", keyID), zap.String("key_id", resp.ID))
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(resp)
+}
@@ -0,0 +1,77 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"jobqueue/internal/auth"
+	"jobqueue/internal/models"
+)
+
+func TestMissingScope(t *testing.T) {
+	scope, ok := missingScope([]string{auth.ScopeRead, auth.ScopeAdmin}, auth.AllScopes)
+	assert.True(t, ok)
+	assert.Equal(t, auth.ScopeSubmit, scope)
+
+	_, ok = missingScope(auth.AllScopes, []string{auth.ScopeRead})
+	assert.False(t, ok)
+}
+
+func TestRotateAPIKeyRequiresItsScopes(t *testing.T) {
+	s := newTestServer(t)
+	user, adminKey := s.user(t, auth.ScopeRead, auth.ScopeAdmin)
+	full, err := issueAPIKey(s.db, user.ID, nil, "full", auth.AllScopes, nil)
+	require.NoError(t, err)
+
+	rec := s.do(t, "POST", "/api/v1/api-keys/"+full.ID+"/rotate", adminKey, nil)
+	assert.Equal(t, http.StatusForbidden, rec.Code, rec.Body.String())
+
+	var resp APIKeyResponse
+	rec = s.do(t, "POST", "/api/v1/api-keys/"+full.ID+"/rotate", full.Key, nil)
+	require.Equal(t, http.StatusCreated, rec.Code, rec.Body.String())
+	decode(t, rec, &resp)
+	assert.ElementsMatch(t, auth.AllScopes, resp.Scopes)
+}
+
+func TestRegisterIssuesKeyWithoutAdmin(t *testing.T) {
+	s := newTestServer(t)
+	rec := s.do(t, "POST", "/api/v1/register", "", AuthRequest{Email: uuid.NewString() + "@example.com", Password: "secret"})
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	var registered AuthResponse
+	decode(t, rec, &registered)
+
+	rec = s.do(t, "GET", "/api/v1/api-keys", registered.APIKey, nil)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	var keys []models.APIKey
+	decode(t, rec, &keys)
+	require.Len(t, keys, 1)
+	assert.ElementsMatch(t, auth.DefaultScopes, keys[0].Scopes)
+
+	rec = s.do(t, "POST", "/api/v1/projects", registered.APIKey, ProjectRequest{Name: "test"})
+	assert.Equal(t, http.StatusForbidden, rec.Code, rec.Body.String())
+}
+
+func TestCreateAPIKeyFromSession(t *testing.T) {
+	s := newTestServer(t)
+	user, _ := s.user(t, auth.ScopeRead)
+	tokens, err := s.api.startSession(httptest.NewRequest("POST", "/api/v1/login", nil), user)
+	require.NoError(t, err)
+
+	var resp APIKeyResponse
+	rec := s.do(t, "POST", "/api/v1/api-keys", tokens.AccessToken, CreateAPIKeyRequest{Name: "ci"})
+	require.Equal(t, http.StatusCreated, rec.Code, rec.Body.String())
+	decode(t, rec, &resp)
+	assert.ElementsMatch(t, auth.AllScopes, resp.Scopes)
+
+	rec = s.do(t, "POST", "/api/v1/api-keys", tokens.AccessToken, CreateAPIKeyRequest{Name: "deploy", Scopes: []string{auth.ScopeSubmit}})
+	require.Equal(t, http.StatusCreated, rec.Code, rec.Body.String())
+	decode(t, rec, &resp)
+	assert.Equal(t, []string{auth.ScopeSubmit}, resp.Scopes)
+
+	rec = s.do(t, "POST", "/api/v1/api-keys/"+resp.ID+"/rotate", tokens.AccessToken, nil)
+	assert.Equal(t, http.StatusCreated, rec.Code, rec.Body.String())
+}
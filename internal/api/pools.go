@@ -0,0 +1,92 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"go.uber.org/zap"
+	"jobqueue/internal/config"
+	"jobqueue/internal/workers"
+)
+
+type PoolsResponse struct {
+	Pools    []workers.PoolStatus            `json:"pools"`
+	Settings map[string]workers.PoolSettings `json:"settings"`
+}
+
+// ListPoolsHandler returns every worker pool across the replicas, what each
+// worker is running and for how long, and the runtime settings in force.
+func (a *API) ListPoolsHandler(w http.ResponseWriter, r *http.Request) {
+	pools, err := workers.ListPoolStatus(r.Context(), a.rdb, config.ProcessTTL)
+	if err != nil {
+		a.logger.Error("failed to list pools", zap.Error(err))
+		http.Error(w, "failed to list pools", http.StatusInternalServerError)
+		return
+	}
+	settings, err := workers.GetPoolSettings(r.Context(), a.rdb)
+	if err != nil {
+		a.logger.Error("failed to get pool settings", zap.Error(err))
+		http.Error(w, "failed to get pool settings", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(PoolsResponse{Pools: pools, Settings: settings})
+}
+
+// SetPoolSettingsHandler changes the size limits and autoscaling of a
+// queue's pools on every replica. Settings that would leave any running pool
+// with max below min, counting the bounds it started with for whatever they
+// leave unset, are rejected.
+func (a *API) SetPoolSettingsHandler(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "name")
+
+	var settings workers.PoolSettings
+	if err := json.NewDecoder(r.Body).Decode(&settings); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	if err := settings.Validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	pools, err := workers.ListPoolStatus(r.Context(), a.rdb, config.ProcessTTL)
+	if err != nil {
+		a.logger.Error("failed to list pools", zap.Error(err))
+		http.Error(w, "failed to set pool settings", http.StatusInternalServerError)
+		return
+	}
+	for _, pool := range pools {
+		if pool.Queue != name {
+			continue
+		}
+		if err := settings.ValidateBounds(pool.StartupMin, pool.StartupMax); err != nil {
+			http.Error(w, err.Error()+" on "+pool.Instance, http.StatusBadRequest)
+			return
+		}
+	}
+
+	if err := workers.SetPoolSettings(r.Context(), a.rdb, name, settings); err != nil {
+		a.logger.Error("failed to set pool settings", zap.Error(err), zap.String("queue", name))
+		http.Error(w, "failed to set pool settings", http.StatusInternalServerError)
+		return
+	}
+	a.logger.Info("pool settings changed", zap.String("queue", name))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(settings)
+}
+
+// DeletePoolSettingsHandler returns a queue's pools to their startup
+// configuration.
+func (a *API) DeletePoolSettingsHandler(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "name")
+	if err := workers.DeletePoolSettings(r.Context(), a.rdb, name); err != nil {
+		a.logger.Error("failed to delete pool settings", zap.Error(err), zap.String("queue", name))
+		http.Error(w, "failed to delete pool settings", http.StatusInternalServerError)
+		return
+	}
+	a.logger.Info("pool settings reset", zap.String("queue", name))
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,49 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"jobqueue/internal/auth"
+	"jobqueue/internal/config"
+	"jobqueue/internal/workers"
+)
+
+func TestSetPoolSettingsChecksStartupBounds(t *testing.T) {
+	s := newTestServer(t)
+	admin, key := s.user(t, auth.AllScopes...)
+	require.NoError(t, s.db.Model(&admin).Update("is_admin", true).Error)
+
+	queueName := "test:" + uuid.NewString()
+	defer workers.DeletePoolSettings(context.Background(), s.rdb, queueName)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	heartbeat := workers.NewHeartbeat("test", time.Second, s.rdb, zap.NewNop())
+	heartbeat.ReportPools(func() []workers.PoolStatus {
+		return []workers.PoolStatus{{Queue: queueName, Min: 1, Max: 4, StartupMin: 1, StartupMax: 4}}
+	})
+	go heartbeat.Run(ctx)
+	require.Eventually(t, func() bool {
+		pools, err := workers.ListPoolStatus(ctx, s.rdb, config.ProcessTTL)
+		require.NoError(t, err)
+		for _, pool := range pools {
+			if pool.Queue == queueName {
+				return true
+			}
+		}
+		return false
+	}, 5*time.Second, 50*time.Millisecond)
+
+	rec := s.do(t, "PUT", "/api/v1/admin/pools/"+queueName, key, map[string]int{"min": 6})
+	assert.Equal(t, http.StatusBadRequest, rec.Code, rec.Body.String())
+	rec = s.do(t, "PUT", "/api/v1/admin/pools/"+queueName, key, map[string]int{"min": 3, "max": 2})
+	assert.Equal(t, http.StatusBadRequest, rec.Code, rec.Body.String())
+	rec = s.do(t, "PUT", "/api/v1/admin/pools/"+queueName, key, map[string]int{"min": 3})
+	assert.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+}
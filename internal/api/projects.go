@@ -0,0 +1,605 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"jobqueue/internal/auth"
+	"jobqueue/internal/middleware"
+	"jobqueue/internal/models"
+)
+
+// invitationTTL is how long an invitation can be accepted.
+const invitationTTL = 7 * 24 * time.Hour
+
+type ProjectRequest struct {
+	Name string `json:"name"`
+}
+
+type ProjectResponse struct {
+	models.Project
+	Role string `json:"role"`
+}
+
+type MemberRequest struct {
+	Role string `json:"role"`
+}
+
+type InvitationRequest struct {
+	Email string `json:"email"`
+	Role  string `json:"role"`
+}
+
+// InvitationResponse is an invitation along with the token the invitee must
+// present to accept it. Token is only set when the invitation has just been
+// created; it cannot be retrieved again.
+type InvitationResponse struct {
+	models.ProjectInvitation
+	Token string `json:"token,omitempty"`
+}
+
+// AcceptInvitationRequest carries the token handed out by the inviter. The
+// email match alone is not enough, since registering does not prove that the
+// caller owns their address.
+type AcceptInvitationRequest struct {
+	Token string `json:"token"`
+}
+
+// authorize checks that the caller has at least role in projectID, and that
+// their API key is not limited to another project, and returns their
+// membership. Callers without any role get a 404 so that project IDs cannot
+// be probed; members with too little a 403. Members' requests then count
+// against the project's API rate limit. It writes the response itself when
+// it returns false.
+func (a *API) authorize(w http.ResponseWriter, r *http.Request, projectID, role string) (models.ProjectMember, bool) {
+	member, status, msg := a.checkRole(r, projectID, role)
+	if status != http.StatusOK {
+		http.Error(w, msg, status)
+		return models.ProjectMember{}, false
+	}
+	if !a.limitProject(w, r, projectID, 1) {
+		return models.ProjectMember{}, false
+	}
+	return member, true
+}
+
+// checkRole is authorize without writing the response: on failure it returns
+// the status and message to reject the request with.
+func (a *API) checkRole(r *http.Request, projectID, role string) (models.ProjectMember, int, string) {
+	user, ok := middleware.GetUser(r)
+	if !ok {
+		return models.ProjectMember{}, http.StatusUnauthorized, http.StatusText(http.StatusUnauthorized)
+	}
+	if _, err := uuid.Parse(projectID); err != nil {
+		return models.ProjectMember{}, http.StatusNotFound, "project not found"
+	}
+	if key, ok := middleware.GetAPIKey(r); ok && key.ProjectID != nil && *key.ProjectID != projectID {
+		return models.ProjectMember{}, http.StatusNotFound, "project not found"
+	}
+
+	var member models.ProjectMember
+	err := a.db.First(&member, "project_id = ? AND user_id = ?", projectID, user.ID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return models.ProjectMember{}, http.StatusNotFound, "project not found"
+	}
+	if err != nil {
+		a.logger.Error("failed to get project membership", zap.Error(err), zap.String("project_id", projectID))
+		return models.ProjectMember{}, http.StatusInternalServerError, "internal server error"
+	}
+	if !models.RoleAllows(member.Role, role) {
+		return models.ProjectMember{}, http.StatusForbidden, "forbidden"
+	}
+	return member, http.StatusOK, ""
+}
+
+// canAssign reports whether a member with role actor may give or take away
+// role target. Only owners can manage admins and owners.
+func canAssign(actor, target string) bool {
+	if actor == models.RoleOwner {
+		return true
+	}
+	return models.RoleAllows(actor, models.RoleAdmin) && !models.RoleAllows(target, models.RoleAdmin)
+}
+
+// CreateProjectHandler creates a project owned by the caller.
+func (a *API) CreateProjectHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUser(r)
+	if !ok {
+		http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+		return
+	}
+	if !unrestricted(w, r) {
+		return
+	}
+	var req ProjectRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		http.Error(w, "name is required", http.StatusBadRequest)
+		return
+	}
+
+	project := models.Project{ID: uuid.NewString(), Name: req.Name}
+	err := a.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&project).Error; err != nil {
+			return err
+		}
+		return tx.Create(&models.ProjectMember{ProjectID: project.ID, UserID: user.ID, Role: models.RoleOwner}).Error
+	})
+	if err != nil {
+		a.logger.Error("failed to create project", zap.Error(err))
+		http.Error(w, "failed to create project", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(ProjectResponse{Project: project, Role: models.RoleOwner})
+}
+
+// ListProjectsHandler returns the projects the caller belongs to, with their
+// role in each.
+func (a *API) ListProjectsHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUser(r)
+	if !ok {
+		http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+		return
+	}
+
+	query := a.db.Where("user_id = ?", user.ID)
+	if key, ok := middleware.GetAPIKey(r); ok && key.ProjectID != nil {
+		query = query.Where("project_id = ?", *key.ProjectID)
+	}
+	var members []models.ProjectMember
+	if err := query.Find(&members).Error; err != nil {
+		a.logger.Error("failed to list memberships", zap.Error(err))
+		http.Error(w, "failed to list projects", http.StatusInternalServerError)
+		return
+	}
+	roles := make(map[string]string, len(members))
+	ids := make([]string, 0, len(members))
+	for _, m := range members {
+		roles[m.ProjectID] = m.Role
+		ids = append(ids, m.ProjectID)
+	}
+
+	var projects []models.Project
+	if len(ids) > 0 {
+		if err := a.db.Where("id IN ?", ids).Order("name").Find(&projects).Error; err != nil {
+			a.logger.Error("failed to list projects", zap.Error(err))
+			http.Error(w, "failed to list projects", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	resp := make([]ProjectResponse, 0, len(projects))
+	for _, p := range projects {
+		resp = append(resp, ProjectResponse{Project: p, Role: roles[p.ID]})
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// GetProjectHandler returns a project the caller can view.
+func (a *API) GetProjectHandler(w http.ResponseWriter, r *http.Request) {
+	projectID := chi.URLParam(r, "projectID")
+	member, ok := a.authorize(w, r, projectID, models.RoleViewer)
+	if !ok {
+		return
+	}
+
+	var project models.Project
+	if err := a.db.First(&project, "id = ?", projectID).Error; err != nil {
+		a.logger.Error("failed to get project", zap.Error(err), zap.String("project_id", projectID))
+		http.Error(w, "failed to get project", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ProjectResponse{Project: project, Role: member.Role})
+}
+
+// RenameProjectHandler changes a project's name.
+func (a *API) RenameProjectHandler(w http.ResponseWriter, r *http.Request) {
+	projectID := chi.URLParam(r, "projectID")
+	member, ok := a.authorize(w, r, projectID, models.RoleAdmin)
+	if !ok {
+		return
+	}
+	var req ProjectRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		http.Error(w, "name is required", http.StatusBadRequest)
+		return
+	}
+
+	var project models.Project
+	err := a.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.Project{}).Where("id = ?", projectID).Update("name", req.Name).Error; err != nil {
+			return err
+		}
+		return tx.First(&project, "id = ?", projectID).Error
+	})
+	if err != nil {
+		a.logger.Error("failed to rename project", zap.Error(err), zap.String("project_id", projectID))
+		http.Error(w, "failed to rename project", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ProjectResponse{Project: project, Role: member.Role})
+}
+
+// DeleteProjectHandler deletes a project with its jobs, members and
+// invitations. Projects with unfinished jobs cannot be deleted.
+func (a *API) DeleteProjectHandler(w http.ResponseWriter, r *http.Request) {
+	projectID := chi.URLParam(r, "projectID")
+	if _, ok := a.authorize(w, r, projectID, models.RoleOwner); !ok {
+		return
+	}
+
+	var unfinished int64
+	err := a.db.Model(&models.Job{}).
+		Where("project_id = ? AND status IN ?", projectID, []string{models.StatusQueued, models.StatusScheduled, models.StatusRunning}).
+		Count(&unfinished).Error
+	if err != nil {
+		a.logger.Error("failed to count unfinished jobs", zap.Error(err), zap.String("project_id", projectID))
+		http.Error(w, "failed to delete project", http.StatusInternalServerError)
+		return
+	}
+	if unfinished > 0 {
+		http.Error(w, "project has unfinished jobs", http.StatusConflict)
+		return
+	}
+
+	err = a.db.Transaction(func(tx *gorm.DB) error {
+		jobs := tx.Model(&models.Job{}).Select("id").Where("project_id = ?", projectID)
+		steps := []*gorm.DB{
+			tx.Where("job_id IN (?)", jobs).Delete(&models.JobAttempt{}),
+			tx.Where("project_id = ?", projectID).Delete(&models.Job{}),
+			tx.Where("project_id = ?", projectID).Delete(&models.ProjectInvitation{}),
+			tx.Where("project_id = ?", projectID).Delete(&models.ProjectMember{}),
+			tx.Where("id = ?", projectID).Delete(&models.Project{}),
+		}
+		for _, step := range steps {
+			if step.Error != nil {
+				return step.Error
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		a.logger.Error("failed to delete project", zap.Error(err), zap.String("project_id", projectID))
+		http.Error(w, "failed to delete project", http.StatusInternalServerError)
+		return
+	}
+	a.logger.Info("project deleted", zap.String("project_id", projectID))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ListMembersHandler returns a project's members.
+func (a *API) ListMembersHandler(w http.ResponseWriter, r *http.Request) {
+	projectID := chi.URLParam(r, "projectID")
+	if _, ok := a.authorize(w, r, projectID, models.RoleViewer); !ok {
+		return
+	}
+
+	var members []models.ProjectMember
+	if err := a.db.Where("project_id = ?", projectID).Order("created_at").Find(&members).Error; err != nil {
+		a.logger.Error("failed to list members", zap.Error(err), zap.String("project_id", projectID))
+		http.Error(w, "failed to list members", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(members)
+}
+
+// SetMemberRoleHandler changes the role of an existing member.
+func (a *API) SetMemberRoleHandler(w http.ResponseWriter, r *http.Request) {
+	projectID := chi.URLParam(r, "projectID")
+	userID := chi.URLParam(r, "userID")
+	actor, ok := a.authorize(w, r, projectID, models.RoleAdmin)
+	if !ok {
+		return
+	}
+	var req MemberRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	if !models.ValidRole(req.Role) {
+		http.Error(w, "role must be one of owner, admin, member or viewer", http.StatusBadRequest)
+		return
+	}
+
+	var member models.ProjectMember
+	err := a.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.First(&member, "project_id = ? AND user_id = ?", projectID, userID).Error; err != nil {
+			return err
+		}
+		if !canAssign(actor.Role, member.Role) || !canAssign(actor.Role, req.Role) {
+			return errForbidden
+		}
+		if member.Role == models.RoleOwner && req.Role != models.RoleOwner {
+			if err := ensureAnotherOwner(tx, projectID, userID); err != nil {
+				return err
+			}
+		}
+		member.Role = req.Role
+		return tx.Save(&member).Error
+	})
+	if a.memberError(w, err, projectID) {
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(member)
+}
+
+// RemoveMemberHandler removes a member from a project. Members may always
+// remove themselves.
+func (a *API) RemoveMemberHandler(w http.ResponseWriter, r *http.Request) {
+	projectID := chi.URLParam(r, "projectID")
+	userID := chi.URLParam(r, "userID")
+	actor, ok := a.authorize(w, r, projectID, models.RoleViewer)
+	if !ok {
+		return
+	}
+	self := actor.UserID == userID
+	if !self && !models.RoleAllows(actor.Role, models.RoleAdmin) {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+
+	err := a.db.Transaction(func(tx *gorm.DB) error {
+		var member models.ProjectMember
+		if err := tx.First(&member, "project_id = ? AND user_id = ?", projectID, userID).Error; err != nil {
+			return err
+		}
+		if !self && !canAssign(actor.Role, member.Role) {
+			return errForbidden
+		}
+		if member.Role == models.RoleOwner {
+			if err := ensureAnotherOwner(tx, projectID, userID); err != nil {
+				return err
+			}
+		}
+		return tx.Delete(&member).Error
+	})
+	if a.memberError(w, err, projectID) {
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+var (
+	errForbidden = errors.New("forbidden")
+	errLastOwner = errors.New("a project must keep at least one owner")
+)
+
+// ensureAnotherOwner fails if userID is the project's only owner.
+func ensureAnotherOwner(tx *gorm.DB, projectID, userID string) error {
+	var owners int64
+	err := tx.Model(&models.ProjectMember{}).
+		Where("project_id = ? AND role = ? AND user_id <> ?", projectID, models.RoleOwner, userID).
+		Count(&owners).Error
+	if err != nil {
+		return err
+	}
+	if owners == 0 {
+		return errLastOwner
+	}
+	return nil
+}
+
+// memberError writes the response for an error from a membership change and
+// reports whether there was one.
+func (a *API) memberError(w http.ResponseWriter, err error, projectID string) bool {
+	switch {
+	case err == nil:
+		return false
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		http.Error(w, "member not found", http.StatusNotFound)
+	case errors.Is(err, errForbidden):
+		http.Error(w, "forbidden", http.StatusForbidden)
+	case errors.Is(err, errLastOwner):
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		a.logger.Error("failed to change membership", zap.Error(err), zap.String("project_id", projectID))
+		http.Error(w, "failed to change membership", http.StatusInternalServerError)
+	}
+	return true
+}
+
+// InviteHandler invites an email address to a project. The invitation shows
+// up for the user with that address, who can accept it with the token that
+// is returned here, once, for the inviter to pass on.
+func (a *API) InviteHandler(w http.ResponseWriter, r *http.Request) {
+	projectID := chi.URLParam(r, "projectID")
+	actor, ok := a.authorize(w, r, projectID, models.RoleAdmin)
+	if !ok {
+		return
+	}
+	var req InvitationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	req.Email = normalizeEmail(req.Email)
+	if !strings.Contains(req.Email, "@") {
+		http.Error(w, "a valid email is required", http.StatusBadRequest)
+		return
+	}
+	if req.Role == "" {
+		req.Role = models.RoleMember
+	}
+	if !models.ValidRole(req.Role) {
+		http.Error(w, "role must be one of owner, admin, member or viewer", http.StatusBadRequest)
+		return
+	}
+	if !canAssign(actor.Role, req.Role) {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+
+	token, hash, err := auth.GenerateInvitationToken()
+	if err != nil {
+		a.logger.Error("failed to generate invitation token", zap.Error(err))
+		http.Error(w, "failed to create invitation", http.StatusInternalServerError)
+		return
+	}
+	invitation := models.ProjectInvitation{
+		ID:        uuid.NewString(),
+		ProjectID: projectID,
+		Email:     req.Email,
+		Role:      req.Role,
+		TokenHash: hash,
+		InvitedBy: actor.UserID,
+		ExpiresAt: time.Now().Add(invitationTTL),
+	}
+	if err := a.db.Create(&invitation).Error; err != nil {
+		a.logger.Error("failed to create invitation", zap.Error(err), zap.String("project_id", projectID))
+		http.Error(w, "failed to create invitation", http.StatusInternalServerError)
+		return
+	}
+	a.logger.Info("project invitation created", zap.String("project_id", projectID), zap.String("invitation_id", invitation.ID))
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(InvitationResponse{ProjectInvitation: invitation, Token: token})
+}
+
+// ListProjectInvitationsHandler returns a project's pending invitations.
+func (a *API) ListProjectInvitationsHandler(w http.ResponseWriter, r *http.Request) {
+	projectID := chi.URLParam(r, "projectID")
+	if _, ok := a.authorize(w, r, projectID, models.RoleAdmin); !ok {
+		return
+	}
+
+	var invitations []models.ProjectInvitation
+	err := a.db.Where("project_id = ? AND accepted_at IS NULL AND expires_at > ?", projectID, time.Now()).
+		Order("created_at").Find(&invitations).Error
+	if err != nil {
+		a.logger.Error("failed to list invitations", zap.Error(err), zap.String("project_id", projectID))
+		http.Error(w, "failed to list invitations", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(invitations)
+}
+
+// RevokeInvitationHandler deletes a pending invitation.
+func (a *API) RevokeInvitationHandler(w http.ResponseWriter, r *http.Request) {
+	projectID := chi.URLParam(r, "projectID")
+	if _, ok := a.authorize(w, r, projectID, models.RoleAdmin); !ok {
+		return
+	}
+
+	res := a.db.Where("id = ? AND project_id = ? AND accepted_at IS NULL", chi.URLParam(r, "invitationID"), projectID).
+		Delete(&models.ProjectInvitation{})
+	if res.Error != nil {
+		a.logger.Error("failed to revoke invitation", zap.Error(res.Error), zap.String("project_id", projectID))
+		http.Error(w, "failed to revoke invitation", http.StatusInternalServerError)
+		return
+	}
+	if res.RowsAffected == 0 {
+		http.Error(w, "invitation not found", http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// MyInvitationsHandler returns the pending invitations for the caller's
+// email address.
+func (a *API) MyInvitationsHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUser(r)
+	if !ok {
+		http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+		return
+	}
+
+	var invitations []models.ProjectInvitation
+	err := a.db.Where("email = ? AND accepted_at IS NULL AND expires_at > ?", normalizeEmail(user.Email), time.Now()).
+		Order("created_at").Find(&invitations).Error
+	if err != nil {
+		a.logger.Error("failed to list invitations", zap.Error(err))
+		http.Error(w, "failed to list invitations", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(invitations)
+}
+
+// AcceptInvitationHandler makes the caller a member of the inviting project.
+// The caller's email must match the invitation and they must present its
+// token. Accepting never lowers a role the caller already has.
+func (a *API) AcceptInvitationHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUser(r)
+	if !ok {
+		http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+		return
+	}
+	if !unrestricted(w, r) {
+		return
+	}
+	invitationID := chi.URLParam(r, "invitationID")
+	var req AcceptInvitationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.Token == "" {
+		http.Error(w, "token is required", http.StatusBadRequest)
+		return
+	}
+
+	var member models.ProjectMember
+	err := a.db.Transaction(func(tx *gorm.DB) error {
+		var invitation models.ProjectInvitation
+		err := tx.Where("id = ? AND email = ? AND token_hash = ? AND accepted_at IS NULL AND expires_at > ?",
+			invitationID, normalizeEmail(user.Email), auth.HashToken(req.Token), time.Now()).
+			First(&invitation).Error
+		if err != nil {
+			return err
+		}
+		now := time.Now()
+		if err := tx.Model(&invitation).Update("accepted_at", &now).Error; err != nil {
+			return err
+		}
+
+		err = tx.First(&member, "project_id = ? AND user_id = ?", invitation.ProjectID, user.ID).Error
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			member = models.ProjectMember{ProjectID: invitation.ProjectID, UserID: user.ID, Role: invitation.Role}
+			return tx.Create(&member).Error
+		case err != nil:
+			return err
+		case !models.RoleAllows(member.Role, invitation.Role):
+			member.Role = invitation.Role
+			return tx.Save(&member).Error
+		}
+		return nil
+	})
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		http.Error(w, "invitation not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		a.logger.Error("failed to accept invitation", zap.Error(err), zap.String("invitation_id", invitationID))
+		http.Error(w, "failed to accept invitation", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(member)
+}
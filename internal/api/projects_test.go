@@ -0,0 +1,193 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"jobqueue/internal/auth"
+	"jobqueue/internal/config"
+	"jobqueue/internal/models"
+	"jobqueue/internal/throttle"
+)
+
+func TestCanAssign(t *testing.T) {
+	tests := []struct {
+		actor, target string
+		want          bool
+	}{
+		{models.RoleOwner, models.RoleOwner, true},
+		{models.RoleOwner, models.RoleAdmin, true},
+		{models.RoleOwner, models.RoleViewer, true},
+		{models.RoleAdmin, models.RoleOwner, false},
+		{models.RoleAdmin, models.RoleAdmin, false},
+		{models.RoleAdmin, models.RoleMember, true},
+		{models.RoleAdmin, models.RoleViewer, true},
+		{models.RoleMember, models.RoleViewer, false},
+		{models.RoleViewer, models.RoleViewer, false},
+		{"", models.RoleViewer, false},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, canAssign(tt.actor, tt.target), "%s assigning %s", tt.actor, tt.target)
+	}
+}
+
+func TestNormalizeEmail(t *testing.T) {
+	assert.Equal(t, "alice@example.com", normalizeEmail("  Alice@Example.COM\n"))
+	assert.Equal(t, normalizeEmail("bob@example.com"), normalizeEmail("BOB@example.com"))
+}
+
+func TestAuthorize(t *testing.T) {
+	s := newTestServer(t)
+	admin, adminKey := s.user(t, auth.AllScopes...)
+	viewer, viewerKey := s.user(t, auth.AllScopes...)
+	_, outsiderKey := s.user(t, auth.AllScopes...)
+	projectID := s.project(t, map[string]string{admin.ID: models.RoleAdmin, viewer.ID: models.RoleViewer})
+	otherID := s.project(t, map[string]string{admin.ID: models.RoleOwner})
+	limited, err := issueAPIKey(s.db, admin.ID, &otherID, "limited", auth.AllScopes, nil)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name      string
+		key       string
+		projectID string
+		role      string
+		want      int
+	}{
+		{"admin as viewer", adminKey, projectID, models.RoleViewer, http.StatusOK},
+		{"admin as admin", adminKey, projectID, models.RoleAdmin, http.StatusOK},
+		{"admin as owner", adminKey, projectID, models.RoleOwner, http.StatusForbidden},
+		{"viewer as viewer", viewerKey, projectID, models.RoleViewer, http.StatusOK},
+		{"viewer as member", viewerKey, projectID, models.RoleMember, http.StatusForbidden},
+		{"outsider", outsiderKey, projectID, models.RoleViewer, http.StatusNotFound},
+		{"unknown project", adminKey, uuid.NewString(), models.RoleViewer, http.StatusNotFound},
+		{"malformed project", adminKey, "not-a-uuid", models.RoleViewer, http.StatusNotFound},
+		{"key limited to another project", limited.Key, projectID, models.RoleViewer, http.StatusNotFound},
+		{"key limited to the project", limited.Key, otherID, models.RoleOwner, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := s.mw.Authenticate(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if _, ok := s.api.authorize(w, r, tt.projectID, tt.role); ok {
+					w.WriteHeader(http.StatusOK)
+				}
+			}))
+			req := httptest.NewRequest("GET", "/", nil)
+			req.Header.Set("Authorization", "Bearer "+tt.key)
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+			assert.Equal(t, tt.want, rec.Code, rec.Body.String())
+		})
+	}
+}
+
+func TestEnsureAnotherOwner(t *testing.T) {
+	s := newTestServer(t)
+	ua, _ := s.user(t)
+	ub, _ := s.user(t)
+	uc, _ := s.user(t)
+	a, b, c := ua.ID, ub.ID, uc.ID
+	solo := s.project(t, map[string]string{a: models.RoleOwner, b: models.RoleAdmin})
+	shared := s.project(t, map[string]string{a: models.RoleOwner, b: models.RoleOwner, c: models.RoleViewer})
+
+	tests := []struct {
+		name      string
+		projectID string
+		userID    string
+		want      error
+	}{
+		{"sole owner", solo, a, errLastOwner},
+		{"admin beside the sole owner", solo, b, nil},
+		{"one of two owners", shared, a, nil},
+		{"viewer", shared, c, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, ensureAnotherOwner(s.db, tt.projectID, tt.userID))
+		})
+	}
+}
+
+func TestInvitationMatchesEmailCaseInsensitively(t *testing.T) {
+	s := newTestServer(t)
+	email := uuid.NewString() + "@Example.com"
+	rec := s.do(t, "POST", "/api/v1/register", "", AuthRequest{Email: " " + email, Password: "secret"})
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+	rec = s.do(t, "POST", "/api/v1/login", "", AuthRequest{Email: strings.ToUpper(email), Password: "secret"})
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	var session TokenResponse
+	decode(t, rec, &session)
+
+	owner, ownerKey := s.user(t, auth.AllScopes...)
+	projectID := s.project(t, map[string]string{owner.ID: models.RoleOwner})
+	rec = s.do(t, "POST", "/api/v1/projects/"+projectID+"/invitations", ownerKey, InvitationRequest{Email: email})
+	require.Equal(t, http.StatusCreated, rec.Code, rec.Body.String())
+	var invitation InvitationResponse
+	decode(t, rec, &invitation)
+	require.NotEmpty(t, invitation.Token)
+
+	var mine []models.ProjectInvitation
+	rec = s.do(t, "GET", "/api/v1/invitations", session.AccessToken, nil)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	decode(t, rec, &mine)
+	require.Len(t, mine, 1)
+
+	rec = s.do(t, "POST", "/api/v1/invitations/"+invitation.ID+"/accept", session.AccessToken, AcceptInvitationRequest{Token: invitation.Token})
+	assert.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+}
+
+func TestAcceptInvitationRequiresToken(t *testing.T) {
+	s := newTestServer(t)
+	owner, ownerKey := s.user(t, auth.AllScopes...)
+	projectID := s.project(t, map[string]string{owner.ID: models.RoleOwner})
+	email := uuid.NewString() + "@example.com"
+	rec := s.do(t, "POST", "/api/v1/projects/"+projectID+"/invitations", ownerKey, InvitationRequest{Email: email, Role: models.RoleAdmin})
+	require.Equal(t, http.StatusCreated, rec.Code, rec.Body.String())
+	var invitation InvitationResponse
+	decode(t, rec, &invitation)
+
+	// Someone else registers the invited address before the invitee does.
+	rec = s.do(t, "POST", "/api/v1/register", "", AuthRequest{Email: email, Password: "secret"})
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	rec = s.do(t, "POST", "/api/v1/login", "", AuthRequest{Email: email, Password: "secret"})
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	var squatter TokenResponse
+	decode(t, rec, &squatter)
+
+	accept := "/api/v1/invitations/" + invitation.ID + "/accept"
+	rec = s.do(t, "POST", accept, squatter.AccessToken, AcceptInvitationRequest{})
+	assert.Equal(t, http.StatusBadRequest, rec.Code, rec.Body.String())
+	rec = s.do(t, "POST", accept, squatter.AccessToken, AcceptInvitationRequest{Token: "jqi_guess"})
+	assert.Equal(t, http.StatusNotFound, rec.Code, rec.Body.String())
+	rec = s.do(t, "GET", "/api/v1/projects/"+projectID, squatter.AccessToken, nil)
+	assert.Equal(t, http.StatusNotFound, rec.Code, rec.Body.String())
+
+	_, otherKey := s.user(t, auth.AllScopes...)
+	rec = s.do(t, "POST", accept, otherKey, AcceptInvitationRequest{Token: invitation.Token})
+	assert.Equal(t, http.StatusNotFound, rec.Code, "the token is bound to the invited address")
+}
+
+func TestProjectRateLimitIgnoresOutsiders(t *testing.T) {
+	s := newTestServer(t)
+	member, memberKey := s.user(t, auth.AllScopes...)
+	_, outsiderKey := s.user(t, auth.AllScopes...)
+	projectID := s.project(t, map[string]string{member.ID: models.RoleViewer})
+	limits := s.api.limiter.Limits()
+	limits.Projects = map[string]throttle.APILimit{projectID: {Rate: config.RateLimit{Count: 1, Per: time.Hour}, Burst: 1}}
+	s.setLimits(limits)
+
+	for i := 0; i < 3; i++ {
+		rec := s.do(t, "GET", "/api/v1/projects/"+projectID, outsiderKey, nil)
+		require.Equal(t, http.StatusNotFound, rec.Code, rec.Body.String())
+	}
+	rec := s.do(t, "GET", "/api/v1/projects/"+projectID, memberKey, nil)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	rec = s.do(t, "GET", "/api/v1/projects/"+projectID, memberKey, nil)
+	assert.Equal(t, http.StatusTooManyRequests, rec.Code, rec.Body.String())
+}
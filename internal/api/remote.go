@@ -0,0 +1,189 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"jobqueue/internal/config"
+	"jobqueue/internal/middleware"
+	"jobqueue/internal/workers"
+)
+
+type LeaseRequest struct {
+	Types        []string `json:"types"`
+	LeaseSeconds int      `json:"lease_seconds"`
+}
+
+type LeaseResponse struct {
+	JobID          string          `json:"job_id"`
+	Type           string          `json:"type"`
+	ProjectID      string          `json:"project_id"`
+	Payload        json.RawMessage `json:"payload"`
+	Attempt        int             `json:"attempt"`
+	MaxRetries     int             `json:"max_retries"`
+	LeaseExpiresAt time.Time       `json:"lease_expires_at"`
+}
+
+type HeartbeatRequest struct {
+	LeaseSeconds int `json:"lease_seconds"`
+}
+
+type HeartbeatResponse struct {
+	LeaseExpiresAt time.Time `json:"lease_expires_at"`
+}
+
+type CompleteRequest struct {
+	Result json.RawMessage `json:"result"`
+}
+
+type FailRequest struct {
+	Error     string `json:"error"`
+	Retryable bool   `json:"retryable"`
+}
+
+type FailResponse struct {
+	Status     string `json:"status"`
+	RetryCount int    `json:"retry_count"`
+}
+
+func leaseTTL(seconds int) time.Duration {
+	ttl := time.Duration(seconds) * time.Second
+	if ttl <= 0 {
+		return config.DefaultRemoteLease
+	}
+	if ttl > config.MaxRemoteLease {
+		return config.MaxRemoteLease
+	}
+	return ttl
+}
+
+// LeaseHandler hands the next job of one of the requested types to a remote
+// worker, or responds 204 if there is none.
+func (a *API) LeaseHandler(w http.ResponseWriter, r *http.Request) {
+	worker, ok := middleware.GetWorker(r)
+	if !ok {
+		http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+		return
+	}
+
+	var req LeaseRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || len(req.Types) == 0 {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	lease, err := a.remote.Acquire(r.Context(), worker, req.Types, leaseTTL(req.LeaseSeconds))
+	if err != nil {
+		a.logger.Error("failed to lease job", zap.Error(err), zap.String("worker", worker))
+		http.Error(w, "failed to lease job", http.StatusInternalServerError)
+		return
+	}
+	if lease == nil {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(LeaseResponse{
+		JobID:          lease.Job.ID,
+		Type:           lease.Job.Type,
+		ProjectID:      lease.Job.ProjectID,
+		Payload:        json.RawMessage(lease.Job.Payload),
+		Attempt:        lease.Job.RetryCount + 1,
+		MaxRetries:     lease.Job.MaxRetries,
+		LeaseExpiresAt: lease.ExpiresAt,
+	})
+}
+
+// HeartbeatHandler extends a remote worker's lease on a job.
+func (a *API) HeartbeatHandler(w http.ResponseWriter, r *http.Request) {
+	worker, ok := middleware.GetWorker(r)
+	if !ok {
+		http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+		return
+	}
+	jobID := chi.URLParam(r, "jobID")
+
+	var req HeartbeatRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "invalid request body", http.StatusBadRequest)
+			return
+		}
+	}
+
+	lease, err := a.remote.Heartbeat(r.Context(), worker, jobID, leaseTTL(req.LeaseSeconds))
+	if err != nil {
+		a.leaseError(w, err, worker, jobID)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(HeartbeatResponse{LeaseExpiresAt: lease.ExpiresAt})
+}
+
+// CompleteHandler records a job finished successfully by a remote worker.
+func (a *API) CompleteHandler(w http.ResponseWriter, r *http.Request) {
+	worker, ok := middleware.GetWorker(r)
+	if !ok {
+		http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+		return
+	}
+	jobID := chi.URLParam(r, "jobID")
+
+	var req CompleteRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "invalid request body", http.StatusBadRequest)
+			return
+		}
+	}
+
+	if err := a.remote.Complete(r.Context(), worker, jobID, req.Result); err != nil {
+		a.leaseError(w, err, worker, jobID)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// FailHandler records a failed attempt reported by a remote worker.
+func (a *API) FailHandler(w http.ResponseWriter, r *http.Request) {
+	worker, ok := middleware.GetWorker(r)
+	if !ok {
+		http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+		return
+	}
+	jobID := chi.URLParam(r, "jobID")
+
+	var req FailRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Error == "" {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	job, err := a.remote.Fail(r.Context(), worker, jobID, req.Error, req.Retryable)
+	if err != nil {
+		a.leaseError(w, err, worker, jobID)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(FailResponse{Status: job.Status, RetryCount: job.RetryCount})
+}
+
+func (a *API) leaseError(w http.ResponseWriter, err error, worker, jobID string) {
+	switch {
+	case errors.Is(err, workers.ErrLeaseNotHeld):
+		http.Error(w, "lease not held", http.StatusConflict)
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		http.Error(w, "job not found", http.StatusNotFound)
+	default:
+		a.logger.Error("failed to update lease", zap.Error(err), zap.String("worker", worker), zap.String("job_id", jobID))
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+	}
+}
@@ -5,32 +5,85 @@ import (
 
     "github.com/go-chi/chi/v5"
     "github.com/prometheus/client_golang/prometheus/promhttp"
+    "jobqueue/internal/auth"
     "jobqueue/internal/middleware"
 )
 
-func NewRouter(
-    mw *middleware.Middleware,
-    registerHandler http.HandlerFunc,
-    loginHandler    http.HandlerFunc,
-    submitHandler   http.HandlerFunc,
-    statusHandler   http.HandlerFunc,
-    listHandler     http.HandlerFunc,
-) http.Handler {
+func NewRouter(mw *middleware.Middleware, a *API) http.Handler {
     r := chi.NewRouter()
 
     // Public
-    r.Post("/api/v1/register", registerHandler)
-    r.Post("/api/v1/login",    loginHandler)
+    r.Post("/api/v1/register", a.RegisterHandler)
+    r.Post("/api/v1/login",    a.LoginHandler)
+    r.Post("/api/v1/token/refresh", a.RefreshHandler)
 
     // Metrics
     r.Handle("/metrics", promhttp.Handler())
 
     // Protected
     r.Group(func(r chi.Router) {
-        r.Use(mw.APIKeyAuth, mw.RateLimit)
-        r.Post("/api/v1/job/submit", submitHandler)
-        r.Get ("/api/v1/job/status/{jobID}", statusHandler)
-        r.Get ("/api/v1/job/list",        listHandler) // ?projectID=
+        r.Use(mw.Authenticate, mw.RateLimit)
+
+        r.Post("/api/v1/logout", a.LogoutHandler)
+
+        r.With(mw.RequireScope(auth.ScopeSubmit)).Post("/api/v1/job/submit", a.SubmitHandler)
+        r.With(mw.RequireScope(auth.ScopeSubmit)).Post("/api/v1/job/submit/bulk", a.BulkSubmitHandler) // JSON array or NDJSON
+
+        r.Group(func(r chi.Router) {
+            r.Use(mw.RequireScope(auth.ScopeRead))
+            r.Get ("/api/v1/job/status/{jobID}", a.StatusHandler)
+            r.Get ("/api/v1/job/list",        a.ListHandler) // ?projectID=&status=&type=&sort=&limit=&cursor=
+            r.Get ("/api/v1/job/search",      a.SearchHandler) // ?q=&projectID=&sort=&limit=&cursor=
+            r.Get ("/api/v1/job-types",       a.JobTypesHandler)
+            r.Get ("/api/v1/projects",             a.ListProjectsHandler)
+            r.Get ("/api/v1/projects/{projectID}", a.GetProjectHandler)
+            r.Get ("/api/v1/projects/{projectID}/members",     a.ListMembersHandler)
+            r.Get ("/api/v1/projects/{projectID}/invitations", a.ListProjectInvitationsHandler)
+            r.Get ("/api/v1/projects/{projectID}/usage",       a.UsageHandler) // ?from=&to=&type=
+            r.Get ("/api/v1/invitations", a.MyInvitationsHandler)
+            r.Get ("/api/v1/api-keys",    a.ListAPIKeysHandler)
+        })
+
+        r.Group(func(r chi.Router) {
+            r.Use(mw.RequireScope(auth.ScopeAdmin))
+
+            // Projects
+            r.Post  ("/api/v1/projects",             a.CreateProjectHandler)
+            r.Patch ("/api/v1/projects/{projectID}", a.RenameProjectHandler)
+            r.Delete("/api/v1/projects/{projectID}", a.DeleteProjectHandler)
+            r.Put   ("/api/v1/projects/{projectID}/members/{userID}",           a.SetMemberRoleHandler)
+            r.Delete("/api/v1/projects/{projectID}/members/{userID}",           a.RemoveMemberHandler)
+            r.Post  ("/api/v1/projects/{projectID}/invitations",                a.InviteHandler)
+            r.Delete("/api/v1/projects/{projectID}/invitations/{invitationID}", a.RevokeInvitationHandler)
+            r.Post  ("/api/v1/invitations/{invitationID}/accept", a.AcceptInvitationHandler)
+
+            // API keys
+            r.Post  ("/api/v1/api-keys",                a.CreateAPIKeyHandler)
+            r.Delete("/api/v1/api-keys/{keyID}",        a.RevokeAPIKeyHandler)
+            r.Post  ("/api/v1/api-keys/{keyID}/rotate", a.RotateAPIKeyHandler)
+
+            // Admin
+            r.Group(func(r chi.Router) {
+                r.Use(mw.RequireAdmin)
+                r.Get ("/api/v1/admin/controls", a.ListControlsHandler)
+                r.Post("/api/v1/admin/queues/{name}/{action:^(pause|resume|drain)$}", a.SetQueueControlHandler)
+                r.Post("/api/v1/admin/types/{name}/{action:^(pause|resume|drain)$}",  a.SetTypeControlHandler)
+                r.Get   ("/api/v1/admin/workers",      a.ListWorkersHandler)
+                r.Get   ("/api/v1/admin/pools",        a.ListPoolsHandler)
+                r.Put   ("/api/v1/admin/pools/{name}", a.SetPoolSettingsHandler)
+                r.Delete("/api/v1/admin/pools/{name}", a.DeletePoolSettingsHandler)
+                r.Put   ("/api/v1/admin/users/{userID}/plan", a.SetUserPlanHandler)
+            })
+        })
+    })
+
+    // Remote workers
+    r.Group(func(r chi.Router) {
+        r.Use(mw.WorkerAuth)
+        r.Post("/api/v1/worker/lease",                   a.LeaseHandler)
+        r.Post("/api/v1/worker/jobs/{jobID}/heartbeat", a.HeartbeatHandler)
+        r.Post("/api/v1/worker/jobs/{jobID}/complete",  a.CompleteHandler)
+        r.Post("/api/v1/worker/jobs/{jobID}/fail",      a.FailHandler)
     })
 
     return r
@@ -0,0 +1,64 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"go.uber.org/zap"
+	"jobqueue/internal/middleware"
+	"jobqueue/internal/models"
+	"jobqueue/internal/search"
+)
+
+type JobSearchResponse struct {
+	Jobs []JobResponse `json:"jobs"`
+	// NextCursor fetches the next page as ?cursor=; it is empty on the last
+	// page.
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+// SearchHandler finds jobs matching ?q=, in the language described in
+// package search, across the projects the caller belongs to, or only in
+// ?projectID= if given. Results are paged and sorted like ListHandler's.
+func (a *API) SearchHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUser(r)
+	if !ok {
+		http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+		return
+	}
+
+	query := r.URL.Query()
+	q, err := search.Parse(query.Get("q"))
+	if err != nil {
+		http.Error(w, "invalid query: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	page, err := parseJobPage(query)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	db := a.db.Model(&models.Job{})
+	if projectID := query.Get("projectID"); projectID != "" {
+		if _, ok := a.authorize(w, r, projectID, models.RoleViewer); !ok {
+			return
+		}
+		db = db.Where("project_id = ?", projectID)
+	} else {
+		db = db.Where("project_id IN (?)", a.db.Model(&models.ProjectMember{}).Select("project_id").Where("user_id = ?", user.ID))
+		if key, ok := middleware.GetAPIKey(r); ok && key.ProjectID != nil {
+			db = db.Where("project_id = ?", *key.ProjectID)
+		}
+	}
+
+	jobs, next, err := page.fetch(q.Apply(db))
+	if err != nil {
+		a.logger.Error("failed to search jobs", zap.Error(err), zap.String("query", query.Get("q")))
+		http.Error(w, "failed to search jobs", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(JobSearchResponse{Jobs: a.jobResponses(r, jobs), NextCursor: next})
+}
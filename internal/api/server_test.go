@@ -0,0 +1,133 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+	"jobqueue/internal/auth"
+	"jobqueue/internal/config"
+	"jobqueue/internal/control"
+	"jobqueue/internal/middleware"
+	"jobqueue/internal/models"
+	"jobqueue/internal/monitoring"
+	"jobqueue/internal/tasks"
+	"jobqueue/internal/throttle"
+	"jobqueue/internal/usage"
+)
+
+// Metrics register globally, so every test server shares one set.
+var testMetrics = sync.OnceValue(monitoring.NewMetrics)
+
+// testServer is the API wired to the Postgres and Redis named by
+// POSTGRES_DSN and REDIS_URL. Tests using it skip when either is not set.
+type testServer struct {
+	api     *API
+	mw      *middleware.Middleware
+	handler http.Handler
+	db      *gorm.DB
+	rdb     redis.UniversalClient
+}
+
+func newTestServer(t *testing.T) *testServer {
+	t.Helper()
+	dsn, redisURL := os.Getenv("POSTGRES_DSN"), os.Getenv("REDIS_URL")
+	if dsn == "" || redisURL == "" {
+		t.Skip("POSTGRES_DSN and REDIS_URL environment variables not set, skipping test")
+	}
+
+	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{Logger: logger.Discard})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(
+		&models.User{},
+		&models.APIKey{},
+		&models.Session{},
+		&models.Project{},
+		&models.ProjectMember{},
+		&models.ProjectInvitation{},
+		&models.Job{},
+		&models.JobAttempt{},
+		&models.DailyUsage{},
+	))
+	opts, err := redis.ParseURL(redisURL)
+	require.NoError(t, err)
+	rdb := redis.NewClient(opts)
+	t.Cleanup(func() { rdb.Close() })
+
+	tokens, err := auth.GenerateKeySet()
+	require.NoError(t, err)
+	limiter := throttle.NewAPILimiter(rdb, throttle.APILimits{Default: throttle.APILimit{Rate: config.RateLimit{Count: 1000, Per: time.Second}, Burst: 1000}})
+	backlog := throttle.NewBacklog(db, rdb, nil, 0, nil, 0, config.DefaultBacklogSoftWatermark, config.DefaultBacklogRetryAfter)
+	meter := usage.NewMeter(db, rdb, nil, 0, zap.NewNop())
+	controls := control.NewStore(rdb, 0)
+
+	a := New(db, rdb, controls, backlog, limiter, meter, nil, tasks.NewRegistry(), tokens, time.Minute, time.Hour, testMetrics(), zap.NewNop())
+	mw := &middleware.Middleware{DB: db, Limiter: limiter, Tokens: tokens, Logger: zap.NewNop()}
+	return &testServer{api: a, mw: mw, handler: NewRouter(mw, a), db: db, rdb: rdb}
+}
+
+// setLimits replaces the API rate limits.
+func (s *testServer) setLimits(limits throttle.APILimits) {
+	s.api.limiter = throttle.NewAPILimiter(s.rdb, limits)
+	s.mw.Limiter = s.api.limiter
+}
+
+// user creates a user with an API key of the given scopes, and returns the
+// user and the key.
+func (s *testServer) user(t *testing.T, scopes ...string) (models.User, string) {
+	t.Helper()
+	user := models.User{ID: uuid.NewString(), Email: uuid.NewString() + "@example.com", Password: "-", CreatedAt: time.Now()}
+	require.NoError(t, s.db.Create(&user).Error)
+	key, err := issueAPIKey(s.db, user.ID, nil, "test", scopes, nil)
+	require.NoError(t, err)
+	return user, key.Key
+}
+
+// project creates a project with the given members, user ID -> role.
+func (s *testServer) project(t *testing.T, members map[string]string) string {
+	t.Helper()
+	project := models.Project{ID: uuid.NewString(), Name: "test"}
+	require.NoError(t, s.db.Create(&project).Error)
+	for userID, role := range members {
+		require.NoError(t, s.db.Create(&models.ProjectMember{ProjectID: project.ID, UserID: userID, Role: role}).Error)
+	}
+	return project.ID
+}
+
+// do sends a request authenticated with token and returns the response. A
+// non-nil body is sent as JSON unless it is already a string.
+func (s *testServer) do(t *testing.T, method, path, token string, body interface{}) *httptest.ResponseRecorder {
+	t.Helper()
+	var buf bytes.Buffer
+	switch b := body.(type) {
+	case nil:
+	case string:
+		buf.WriteString(b)
+	default:
+		require.NoError(t, json.NewEncoder(&buf).Encode(b))
+	}
+	req := httptest.NewRequest(method, path, &buf)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	s.handler.ServeHTTP(rec, req)
+	return rec
+}
+
+func decode(t *testing.T, rec *httptest.ResponseRecorder, v interface{}) {
+	t.Helper()
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), v), rec.Body.String())
+}
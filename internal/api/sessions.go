@@ -0,0 +1,147 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"jobqueue/internal/auth"
+	"jobqueue/internal/middleware"
+	"jobqueue/internal/models"
+)
+
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+// TokenResponse carries the credentials of a login session. The refresh
+// token is only returned here; it cannot be retrieved again.
+type TokenResponse struct {
+	AccessToken      string    `json:"access_token"`
+	TokenType        string    `json:"token_type"`
+	ExpiresIn        int       `json:"expires_in"` // seconds
+	RefreshToken     string    `json:"refresh_token"`
+	RefreshExpiresAt time.Time `json:"refresh_expires_at"`
+}
+
+// startSession opens a login session for user and returns its tokens.
+func (a *API) startSession(r *http.Request, user models.User) (TokenResponse, error) {
+	refresh, hash, err := auth.GenerateRefreshToken()
+	if err != nil {
+		return TokenResponse{}, err
+	}
+	session := models.Session{
+		ID:          uuid.NewString(),
+		UserID:      user.ID,
+		RefreshHash: hash,
+		UserAgent:   r.UserAgent(),
+		ExpiresAt:   time.Now().Add(a.refreshTTL),
+	}
+	if err := a.db.Create(&session).Error; err != nil {
+		return TokenResponse{}, err
+	}
+	return a.tokenResponse(session, refresh)
+}
+
+func (a *API) tokenResponse(session models.Session, refresh string) (TokenResponse, error) {
+	now := time.Now()
+	expiresAt := now.Add(a.accessTTL)
+	// An access token never outlives its session.
+	if expiresAt.After(session.ExpiresAt) {
+		expiresAt = session.ExpiresAt
+	}
+	access, err := a.tokens.Sign(auth.Claims{
+		Subject:   session.UserID,
+		SessionID: session.ID,
+		IssuedAt:  now.Unix(),
+		ExpiresAt: expiresAt.Unix(),
+	})
+	if err != nil {
+		return TokenResponse{}, err
+	}
+	return TokenResponse{
+		AccessToken:      access,
+		TokenType:        "Bearer",
+		ExpiresIn:        int(expiresAt.Sub(now).Seconds()),
+		RefreshToken:     refresh,
+		RefreshExpiresAt: session.ExpiresAt,
+	}, nil
+}
+
+// RefreshHandler exchanges a refresh token for a new access token and a new
+// refresh token. The old refresh token stops working.
+func (a *API) RefreshHandler(w http.ResponseWriter, r *http.Request) {
+	var req RefreshRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.RefreshToken == "" {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	now := time.Now()
+	oldHash := auth.HashToken(req.RefreshToken)
+	var session models.Session
+	err := a.db.Where("refresh_hash = ? AND revoked_at IS NULL AND expires_at > ?", oldHash, now).First(&session).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		http.Error(w, "invalid refresh token", http.StatusUnauthorized)
+		return
+	}
+	if err != nil {
+		a.logger.Error("failed to get session", zap.Error(err))
+		http.Error(w, "failed to refresh session", http.StatusInternalServerError)
+		return
+	}
+
+	refresh, hash, err := auth.GenerateRefreshToken()
+	if err != nil {
+		a.logger.Error("failed to generate refresh token", zap.Error(err))
+		http.Error(w, "failed to refresh session", http.StatusInternalServerError)
+		return
+	}
+	// Swapping on the old hash makes concurrent refreshes with the same
+	// token succeed at most once.
+	res := a.db.Model(&models.Session{}).
+		Where("id = ? AND refresh_hash = ? AND revoked_at IS NULL", session.ID, oldHash).
+		Update("refresh_hash", hash)
+	if res.Error != nil {
+		a.logger.Error("failed to refresh session", zap.Error(res.Error), zap.String("session_id", session.ID))
+		http.Error(w, "failed to refresh session", http.StatusInternalServerError)
+		return
+	}
+	if res.RowsAffected == 0 {
+		http.Error(w, "invalid refresh token", http.StatusUnauthorized)
+		return
+	}
+
+	resp, err := a.tokenResponse(session, refresh)
+	if err != nil {
+		a.logger.Error("failed to sign access token", zap.Error(err), zap.String("session_id", session.ID))
+		http.Error(w, "failed to refresh session", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// LogoutHandler revokes the session the request was made with. Its access
+// tokens are rejected from then on and its refresh token no longer works.
+func (a *API) LogoutHandler(w http.ResponseWriter, r *http.Request) {
+	sessionID, ok := middleware.GetSession(r)
+	if !ok {
+		http.Error(w, "not authenticated with a login session", http.StatusBadRequest)
+		return
+	}
+
+	err := a.db.Model(&models.Session{}).
+		Where("id = ? AND revoked_at IS NULL", sessionID).
+		Update("revoked_at", time.Now()).Error
+	if err != nil {
+		a.logger.Error("failed to revoke session", zap.Error(err), zap.String("session_id", sessionID))
+		http.Error(w, "failed to log out", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,123 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"go.uber.org/zap"
+	"jobqueue/internal/models"
+	"jobqueue/internal/usage"
+)
+
+const (
+	// defaultUsageDays is how far back usage is reported without ?from=.
+	defaultUsageDays = 30
+	// maxUsageDays bounds the range of one usage request.
+	maxUsageDays = 366
+)
+
+// UsageCounts is what was used over some period.
+type UsageCounts struct {
+	Submitted  int64 `json:"submitted"`
+	Executed   int64 `json:"executed"`
+	Failed     int64 `json:"failed"`
+	DurationMs int64 `json:"duration_ms"`
+}
+
+func (c *UsageCounts) add(u models.DailyUsage) {
+	c.Submitted += u.Submitted
+	c.Executed += u.Executed
+	c.Failed += u.Failed
+	c.DurationMs += u.DurationMs
+}
+
+// UsageDay is what was used of one job type on one day.
+type UsageDay struct {
+	Day     string `json:"day"`
+	JobType string `json:"job_type"`
+	UsageCounts
+}
+
+type UsageResponse struct {
+	ProjectID string      `json:"project_id"`
+	From      string      `json:"from"`
+	To        string      `json:"to"`
+	Days      []UsageDay  `json:"days"`
+	Total     UsageCounts `json:"total"`
+	Quota     usage.Quota `json:"quota"`
+}
+
+// UsageHandler reports a project's daily usage between ?from= and ?to=
+// (inclusive, YYYY-MM-DD, UTC), optionally for one ?type= of job, along with
+// this month's job quota. Usage is flushed from Redis periodically, so the
+// latest minute or so may be missing.
+func (a *API) UsageHandler(w http.ResponseWriter, r *http.Request) {
+	projectID := chi.URLParam(r, "projectID")
+	if _, ok := a.authorize(w, r, projectID, models.RoleViewer); !ok {
+		return
+	}
+
+	query := r.URL.Query()
+	to := time.Now().UTC().Truncate(24 * time.Hour)
+	if s := query.Get("to"); s != "" {
+		t, err := time.Parse("2006-01-02", s)
+		if err != nil {
+			http.Error(w, "to must be a date (YYYY-MM-DD)", http.StatusBadRequest)
+			return
+		}
+		to = t
+	}
+	from := to.AddDate(0, 0, -(defaultUsageDays - 1))
+	if s := query.Get("from"); s != "" {
+		t, err := time.Parse("2006-01-02", s)
+		if err != nil {
+			http.Error(w, "from must be a date (YYYY-MM-DD)", http.StatusBadRequest)
+			return
+		}
+		from = t
+	}
+	if from.After(to) {
+		http.Error(w, "from must not be after to", http.StatusBadRequest)
+		return
+	}
+	if to.Sub(from) >= maxUsageDays*24*time.Hour {
+		http.Error(w, "range must not exceed 366 days", http.StatusBadRequest)
+		return
+	}
+
+	db := a.db.Where("project_id = ? AND day BETWEEN ? AND ?", projectID, from, to)
+	if jobType := query.Get("type"); jobType != "" {
+		db = db.Where("job_type = ?", jobType)
+	}
+	var rows []models.DailyUsage
+	if err := db.Order("day, job_type").Find(&rows).Error; err != nil {
+		a.logger.Error("failed to get usage", zap.Error(err), zap.String("project_id", projectID))
+		http.Error(w, "failed to get usage", http.StatusInternalServerError)
+		return
+	}
+
+	quota, err := a.meter.Current(r.Context(), projectID)
+	if err != nil {
+		a.logger.Error("failed to get quota", zap.Error(err), zap.String("project_id", projectID))
+		http.Error(w, "failed to get quota", http.StatusInternalServerError)
+		return
+	}
+
+	resp := UsageResponse{
+		ProjectID: projectID,
+		From:      from.Format("2006-01-02"),
+		To:        to.Format("2006-01-02"),
+		Days:      make([]UsageDay, 0, len(rows)),
+		Quota:     quota,
+	}
+	for _, row := range rows {
+		day := UsageDay{Day: row.Day.Format("2006-01-02"), JobType: row.JobType}
+		day.add(row)
+		resp.Days = append(resp.Days, day)
+		resp.Total.add(row)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
@@ -3,11 +3,14 @@ package api
 import (
     "encoding/json"
     "net/http"
+    "strings"
     "time"
 
     "github.com/google/uuid"
     "go.uber.org/zap"
     "golang.org/x/crypto/bcrypt"
+    "gorm.io/gorm"
+    "jobqueue/internal/auth"
     "jobqueue/internal/models"
 )
 
@@ -21,6 +24,12 @@ type AuthResponse struct {
     APIKey string `json:"api_key"`
 }
 
+// normalizeEmail is the form emails are stored and compared in, so that
+// accounts and invitations match however the address was typed.
+func normalizeEmail(email string) string {
+    return strings.ToLower(strings.TrimSpace(email))
+}
+
 func (a *API) RegisterHandler(w http.ResponseWriter, r *http.Request) {
     var req AuthRequest
     if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -37,19 +46,26 @@ func (a *API) RegisterHandler(w http.ResponseWriter, r *http.Request) {
 
     user := models.User{
         ID:        uuid.NewString(),
-        Email:     req.Email,
+        Email:     normalizeEmail(req.Email),
         Password:  string(hash),
-        APIKey:    uuid.NewString(),
         CreatedAt: time.Now(),
     }
-    if err := a.db.Create(&user).Error; err != nil {
+    var key APIKeyResponse
+    err = a.db.Transaction(func(tx *gorm.DB) error {
+        if err := tx.Create(&user).Error; err != nil {
+            return err
+        }
+        key, err = issueAPIKey(tx, user.ID, nil, "default", auth.DefaultScopes, nil)
+        return err
+    })
+    if err != nil {
         // This could be a unique constraint violation
         a.logger.Error("failed to create user", zap.Error(err))
         http.Error(w, "failed to create user", http.StatusInternalServerError)
         return
     }
     w.Header().Set("Content-Type", "application/json")
-    json.NewEncoder(w).Encode(AuthResponse{APIKey: user.APIKey})
+    json.NewEncoder(w).Encode(AuthResponse{APIKey: key.Key})
 }
 
 func (a *API) LoginHandler(w http.ResponseWriter, r *http.Request) {
@@ -60,7 +76,7 @@ func (a *API) LoginHandler(w http.ResponseWriter, r *http.Request) {
     }
 
     var user models.User
-    if err := a.db.Where("email = ?", req.Email).First(&user).Error; err != nil {
+    if err := a.db.Where("email = ?", normalizeEmail(req.Email)).First(&user).Error; err != nil {
         http.Error(w, "invalid email or password", http.StatusUnauthorized)
         return
     }
@@ -69,6 +85,13 @@ func (a *API) LoginHandler(w http.ResponseWriter, r *http.Request) {
         http.Error(w, "invalid email or password", http.StatusUnauthorized)
         return
     }
+
+    resp, err := a.startSession(r, user)
+    if err != nil {
+        a.logger.Error("failed to start session", zap.Error(err))
+        http.Error(w, "failed to log in", http.StatusInternalServerError)
+        return
+    }
     w.Header().Set("Content-Type", "application/json")
-    json.NewEncoder(w).Encode(AuthResponse{APIKey: user.APIKey})
+    json.NewEncoder(w).Encode(resp)
 }
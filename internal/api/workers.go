@@ -0,0 +1,24 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"go.uber.org/zap"
+	"jobqueue/internal/config"
+	"jobqueue/internal/workers"
+)
+
+// ListWorkersHandler returns every live process in the cluster with its
+// host, version, pools and what each worker is running.
+func (a *API) ListWorkersHandler(w http.ResponseWriter, r *http.Request) {
+	processes, err := workers.ListProcesses(r.Context(), a.rdb, config.ProcessTTL)
+	if err != nil {
+		a.logger.Error("failed to list processes", zap.Error(err))
+		http.Error(w, "failed to list workers", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(processes)
+}
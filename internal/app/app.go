@@ -0,0 +1,199 @@
+package app
+
+import (
+	"context"
+	"log"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"go.uber.org/zap"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"jobqueue/internal/ai"
+	"jobqueue/internal/config"
+	"jobqueue/internal/control"
+	"jobqueue/internal/heuristics"
+	"jobqueue/internal/models"
+	"jobqueue/internal/monitoring"
+	"jobqueue/internal/queue"
+	"jobqueue/internal/tasks"
+	"jobqueue/internal/throttle"
+	"jobqueue/internal/usage"
+	"jobqueue/internal/workers"
+)
+
+// App holds the dependencies shared by the API server and the workers, so
+// both binaries are wired from the same config the same way.
+type App struct {
+	Config   *config.Config
+	Logger   *zap.Logger
+	DB       *gorm.DB
+	Redis    redis.UniversalClient
+	Metrics  *monitoring.Metrics
+	AI       *ai.AI
+	Controls *control.Store
+	Registry *tasks.Registry
+
+	Meter     *usage.Meter
+	Lifecycle *workers.Lifecycle
+	Remote    *workers.RemoteLeases
+	Scaling   workers.ScalingConfigs
+	Heartbeat *workers.Heartbeat
+}
+
+// New connects to Postgres and Redis and builds the shared dependencies.
+func New(cfg *config.Config, logger *zap.Logger) (*App, error) {
+	// Database
+	db, err := gorm.Open(postgres.Open(cfg.PostgresDSN), &gorm.Config{})
+	if err != nil {
+		return nil, err
+	}
+	if err := migrate(db); err != nil {
+		return nil, err
+	}
+	granted, err := grantAdmins(db, cfg.AdminEmails)
+	if err != nil {
+		return nil, err
+	}
+	if granted > 0 {
+		logger.Info("granted admin to configured accounts", zap.Int64("count", granted))
+	}
+
+	scaling, err := workers.LoadScalingConfigs(cfg.AutoscaleFile)
+	if err != nil {
+		return nil, err
+	}
+
+	// Redis
+	rdb, err := queue.NewRedisClient(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, jobType := range cfg.RemoteJobTypes {
+		heuristics.RegisterRemote(jobType)
+	}
+
+	a := &App{
+		Config:   cfg,
+		Logger:   logger,
+		DB:       db,
+		Redis:    rdb,
+		Metrics:  monitoring.NewMetrics(),
+		AI:       ai.New(rdb),
+		Controls: control.NewStore(rdb, config.ControlCacheTTL),
+		Registry: tasks.NewRegistry(),
+		Scaling:  scaling,
+	}
+	a.useTaskMiddleware()
+	if err := registerProcessors(a.Registry, cfg); err != nil {
+		return nil, err
+	}
+
+	sem := throttle.NewSemaphore(rdb, cfg.SemaphoreLease, cfg.JobConcurrencyLimits, cfg.ProjectConcurrencyLimits)
+	limiter := throttle.NewRateLimiter(rdb, cfg.JobRateLimits)
+	a.Meter = usage.NewMeter(db, rdb, cfg.ProjectMonthlyQuotas, cfg.DefaultProjectMonthlyQuota, logger)
+	a.Lifecycle = workers.NewLifecycle(cfg.DeferDelay, db, rdb, a.AI, sem, limiter, a.Controls, a.Meter, a.Metrics, logger)
+	a.Remote = workers.NewRemoteLeases(a.Lifecycle, db, rdb, a.Controls, logger)
+	a.Heartbeat = workers.NewHeartbeat(Version, config.HeartbeatInterval, rdb, logger)
+	return a, nil
+}
+
+// Close releases the connections opened by New.
+func (a *App) Close() {
+	if err := a.Redis.Close(); err != nil {
+		a.Logger.Error("failed to close redis", zap.Error(err))
+	}
+	if sqlDB, err := a.DB.DB(); err == nil {
+		sqlDB.Close()
+	}
+}
+
+// useTaskMiddleware installs the middleware every task runs under. Panics
+// are recovered by the worker itself, around all of it.
+func (a *App) useTaskMiddleware() {
+	a.Registry.Use(
+		tasks.Logging(a.Logger.With(zap.String("component", "tasks"))),
+		tasks.Timing(func(job models.Job, elapsed time.Duration, err error) {
+			outcome := "success"
+			if err != nil {
+				outcome = "error"
+			}
+			a.Metrics.TaskDurationSeconds.WithLabelValues(job.Type, outcome).Observe(elapsed.Seconds())
+		}),
+	)
+}
+
+// registerProcessors registers the task processors every worker can run,
+// including the allow-listed commands from EXEC_TASKS_FILE. Timeouts from
+// JOB_TIMEOUTS are attached to the matching types.
+func registerProcessors(r *tasks.Registry, cfg *config.Config) error {
+	register := func(jobType string, p tasks.Processor, opts ...tasks.Option) {
+		if timeout, ok := cfg.JobTimeouts[jobType]; ok {
+			opts = append(opts, tasks.WithTimeout(timeout))
+		}
+		r.Register(jobType, p, opts...)
+	}
+	register("send_email", &tasks.MockEmailSender{})
+	register("generate_receipt", &tasks.ReceiptGenerator{}, tasks.WithSchema(tasks.SchemaOf[tasks.ReceiptPayload]()))
+	register("summarize_text", &tasks.MockSummarizer{})
+
+	if cfg.ExecTasksFile == "" {
+		return nil
+	}
+	processors, err := tasks.LoadExecProcessors(cfg.ExecTasksFile)
+	if err != nil {
+		return err
+	}
+	for jobType, p := range processors {
+		register(jobType, p)
+	}
+	return nil
+}
+
+// Main sets up logging, config and the shared dependencies, then calls run
+// with a context that is cancelled on SIGINT or SIGTERM. run should block
+// until that context is done and then shut its components down.
+func Main(run func(ctx context.Context, a *App) error) {
+	// Logger
+	logger, err := zap.NewDevelopment() // More verbose for local dev
+	if err != nil {
+		log.Fatalf("can't initialize zap logger: %v", err)
+	}
+	defer logger.Sync()
+
+	// Config
+	cfg, err := config.Load()
+	if err != nil {
+		logger.Fatal("failed to load config", zap.Error(err))
+	}
+
+	// Context for graceful shutdown
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	a, err := New(cfg, logger)
+	if err != nil {
+		logger.Fatal("failed to initialize", zap.Error(err))
+	}
+	defer a.Close()
+	go backfillJobSearch(ctx, a.DB, logger)
+
+	// Stay registered in the cluster until run has returned, so that jobs
+	// still draining after the signal are not reclaimed by other replicas.
+	heartbeatCtx, stopHeartbeat := context.WithCancel(context.Background())
+	heartbeatDone := make(chan struct{})
+	go func() {
+		a.Heartbeat.Run(heartbeatCtx)
+		close(heartbeatDone)
+	}()
+
+	if err := run(ctx, a); err != nil {
+		logger.Error("exited with error", zap.Error(err))
+	}
+	stopHeartbeat()
+	<-heartbeatDone
+	logger.Info("shutdown complete")
+}
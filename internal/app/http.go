@@ -0,0 +1,90 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.uber.org/zap"
+	"jobqueue/internal/api"
+	"jobqueue/internal/auth"
+	"jobqueue/internal/config"
+	"jobqueue/internal/middleware"
+	"jobqueue/internal/throttle"
+)
+
+// APIHandler builds the HTTP API router. Signing keys from JWT_KEYS_FILE are
+// reloaded until ctx is done.
+func (a *App) APIHandler(ctx context.Context) (http.Handler, error) {
+	cfg := a.Config
+	tokens, err := a.signingKeys(ctx)
+	if err != nil {
+		return nil, err
+	}
+	limits, err := throttle.LoadAPILimits(cfg.RateLimitsFile)
+	if err != nil {
+		return nil, err
+	}
+	limiter := throttle.NewAPILimiter(a.Redis, limits)
+	backlog := throttle.NewBacklog(a.DB, a.Redis, cfg.QueueMaxDepths, cfg.DefaultQueueMaxDepth, cfg.ProjectMaxBacklogs, cfg.DefaultProjectMaxBacklog, cfg.BacklogSoftWatermark, cfg.BacklogRetryAfter)
+	apiHandler := api.New(a.DB, a.Redis, a.Controls, backlog, limiter, a.Meter, a.Remote, a.Registry, tokens, cfg.AccessTokenTTL, cfg.RefreshTokenTTL, a.Metrics, a.Logger)
+	mw := &middleware.Middleware{
+		DB:           a.DB,
+		Limiter:      limiter,
+		Tokens:       tokens,
+		WorkerTokens: cfg.RemoteWorkerTokens,
+		Logger:       a.Logger,
+	}
+	return api.NewRouter(mw, apiHandler), nil
+}
+
+// signingKeys loads the keys that sign access tokens.
+func (a *App) signingKeys(ctx context.Context) (*auth.KeySet, error) {
+	path := a.Config.JWTKeysFile
+	if path == "" {
+		a.Logger.Warn("JWT_KEYS_FILE is not set; access tokens are only valid on this replica until it restarts")
+		return auth.GenerateKeySet()
+	}
+	keys, err := auth.LoadKeySet(path)
+	if err != nil {
+		return nil, err
+	}
+	go keys.Watch(ctx, path, config.SigningKeysReloadInterval, a.Logger)
+	return keys, nil
+}
+
+// MetricsHandler serves only the Prometheus metrics, for processes that do
+// not run the API.
+func (a *App) MetricsHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+	return mux
+}
+
+// Serve starts an HTTP server on port in the background and returns it.
+func (a *App) Serve(port string, handler http.Handler) *http.Server {
+	srv := &http.Server{
+		Addr:    fmt.Sprintf(":%s", port),
+		Handler: handler,
+	}
+
+	go func() {
+		a.Logger.Info("starting server", zap.String("port", port))
+		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			a.Logger.Fatal("failed to start server", zap.Error(err))
+		}
+	}()
+	return srv
+}
+
+// ShutdownServer stops accepting requests and waits briefly for in-flight
+// ones to finish.
+func (a *App) ShutdownServer(srv *http.Server) {
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		a.Logger.Error("server shutdown failed", zap.Error(err))
+	}
+}
@@ -0,0 +1,203 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"jobqueue/internal/auth"
+	"jobqueue/internal/config"
+	"jobqueue/internal/models"
+	"jobqueue/internal/queue"
+)
+
+// migrate brings the schema up to date. AutoMigrate creates tables and adds
+// columns; the steps after it move data out of what they replace.
+func migrate(db *gorm.DB) error {
+	err := db.AutoMigrate(
+		&models.User{},
+		&models.APIKey{},
+		&models.Session{},
+		&models.Project{},
+		&models.ProjectMember{},
+		&models.ProjectInvitation{},
+		&models.Job{},
+		&models.JobAttempt{},
+		&models.DailyUsage{},
+	)
+	if err != nil {
+		return err
+	}
+	if err := migrateProjectOwners(db); err != nil {
+		return err
+	}
+	if err := migrateUserAPIKeys(db); err != nil {
+		return err
+	}
+	if err := migrateUserEmails(db); err != nil {
+		return err
+	}
+	return migrateJobSearch(db)
+}
+
+// migrateProjectOwners turns projects.user_id, the single owner each project
+// used to have, into owner memberships and drops the column.
+func migrateProjectOwners(db *gorm.DB) error {
+	if !db.Migrator().HasColumn(&models.Project{}, "user_id") {
+		return nil
+	}
+	return db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Exec(`
+			INSERT INTO project_members (project_id, user_id, role, created_at, updated_at)
+			SELECT id, user_id, ?, now(), now() FROM projects WHERE user_id IS NOT NULL
+			ON CONFLICT DO NOTHING`, models.RoleOwner).Error
+		if err != nil {
+			return err
+		}
+		return tx.Migrator().DropColumn(&models.Project{}, "user_id")
+	})
+}
+
+// migrateUserAPIKeys turns users.api_key, the single plaintext key each user
+// used to have, into hashed API keys with every scope and drops the column.
+// Existing clients keep working with the keys they have.
+func migrateUserAPIKeys(db *gorm.DB) error {
+	if !db.Migrator().HasColumn(&models.User{}, "api_key") {
+		return nil
+	}
+	scopes, err := json.Marshal(auth.AllScopes)
+	if err != nil {
+		return err
+	}
+	return db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Exec(`
+			INSERT INTO api_keys (id, user_id, name, prefix, hash, scopes, created_at)
+			SELECT gen_random_uuid(), id, 'default', left(api_key, 8),
+			       encode(sha256(convert_to(api_key, 'UTF8')), 'hex'), ?::jsonb, now()
+			FROM users WHERE api_key IS NOT NULL AND api_key <> ''
+			ON CONFLICT (hash) DO NOTHING`, string(scopes)).Error
+		if err != nil {
+			return err
+		}
+		return tx.Migrator().DropColumn(&models.User{}, "api_key")
+	})
+}
+
+// migrateUserEmails lowercases and trims the emails of users registered
+// before they were normalized, so that they can still log in and accept
+// invitations. An account whose normalized email another account already has
+// is left as it is for an operator to merge.
+func migrateUserEmails(db *gorm.DB) error {
+	return db.Exec(`
+		UPDATE users SET email = lower(btrim(email))
+		WHERE email <> lower(btrim(email))
+		  AND NOT EXISTS (
+			SELECT 1 FROM users other
+			WHERE other.id <> users.id AND lower(btrim(other.email)) = lower(btrim(users.email))
+		  )`).Error
+}
+
+// grantAdmins sets the admin flag on the accounts with the given emails, and
+// returns how many it changed. Emails without an account are ignored.
+func grantAdmins(db *gorm.DB, emails []string) (int64, error) {
+	if len(emails) == 0 {
+		return 0, nil
+	}
+	normalized := make([]string, len(emails))
+	for i, email := range emails {
+		normalized[i] = strings.ToLower(strings.TrimSpace(email))
+	}
+	res := db.Model(&models.User{}).Where("email IN ? AND NOT is_admin", normalized).Update("is_admin", true)
+	return res.RowsAffected, res.Error
+}
+
+// searchVector is the expression for jobs.search_vector: the payload's
+// strings and numbers plus the job type. %s qualifies the columns.
+const searchVector = `to_tsvector('simple', %[1]stype) || jsonb_to_tsvector('simple', %[1]spayload::jsonb, '["string", "numeric"]')`
+
+// migrateJobSearch adds what job search needs and gorm cannot declare: a GIN
+// index on jobs.payload for jsonpath predicates, and jobs.search_vector,
+// GIN-indexed for free text and kept up to date by a trigger. The column is
+// added nullable and the indexes built concurrently so that neither rewrites
+// nor locks the jobs table; backfillJobSearch fills in existing jobs.
+func migrateJobSearch(db *gorm.DB) error {
+	if !db.Migrator().HasColumn(&models.Job{}, "search_vector") {
+		if err := db.Exec(`ALTER TABLE jobs ADD COLUMN search_vector tsvector`).Error; err != nil {
+			return err
+		}
+	}
+	err := db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Exec(`
+			CREATE OR REPLACE FUNCTION jobs_search_vector() RETURNS trigger AS $$
+			BEGIN
+				NEW.search_vector := ` + fmt.Sprintf(searchVector, "NEW.") + `;
+				RETURN NEW;
+			END
+			$$ LANGUAGE plpgsql`).Error
+		if err != nil {
+			return err
+		}
+		if err := tx.Exec(`DROP TRIGGER IF EXISTS jobs_search_vector ON jobs`).Error; err != nil {
+			return err
+		}
+		return tx.Exec(`
+			CREATE TRIGGER jobs_search_vector BEFORE INSERT OR UPDATE OF type, payload ON jobs
+			FOR EACH ROW EXECUTE FUNCTION jobs_search_vector()`).Error
+	})
+	if err != nil {
+		return err
+	}
+	if err := db.Exec(`CREATE INDEX CONCURRENTLY IF NOT EXISTS idx_jobs_payload ON jobs USING GIN (payload jsonb_path_ops)`).Error; err != nil {
+		return err
+	}
+	return db.Exec(`CREATE INDEX CONCURRENTLY IF NOT EXISTS idx_jobs_search_vector ON jobs USING GIN (search_vector)`).Error
+}
+
+// backfillJobSearch fills in search_vector for jobs created before it
+// existed, a batch at a time so that no statement holds many row locks for
+// long. Replicas doing the same skip each other's batches. Until it is done
+// those jobs do not match free-text searches.
+func backfillJobSearch(ctx context.Context, db *gorm.DB, logger *zap.Logger) {
+	var total int64
+	for ctx.Err() == nil {
+		res := db.WithContext(ctx).Exec(`
+			UPDATE jobs SET search_vector = `+fmt.Sprintf(searchVector, "")+`
+			WHERE id IN (
+				SELECT id FROM jobs WHERE search_vector IS NULL
+				LIMIT ? FOR UPDATE SKIP LOCKED
+			)`, config.JobSearchBackfillBatchSize)
+		if res.Error != nil {
+			if ctx.Err() == nil {
+				logger.Error("failed to backfill job search", zap.Error(res.Error))
+			}
+			return
+		}
+		if res.RowsAffected == 0 {
+			break
+		}
+		total += res.RowsAffected
+	}
+	if total > 0 {
+		logger.Info("backfilled job search", zap.Int64("jobs", total))
+	}
+}
+
+// migrateQueueKeys moves jobs left on the untagged keys of queues, by a
+// version from before queue keys were hash-tagged, onto the current keys.
+// Workers only read the current keys, so without this those jobs would never
+// run. Failures are logged and the queue is retried on the next start.
+func (a *App) migrateQueueKeys(ctx context.Context, queues []string) {
+	for _, queueName := range queues {
+		n, err := queue.MigrateLegacy(ctx, a.Redis, queueName)
+		if err != nil {
+			a.Logger.Error("failed to move jobs off legacy queue keys", zap.Error(err), zap.String("queue", queueName))
+			continue
+		}
+		if n > 0 {
+			a.Logger.Info("moved jobs off legacy queue keys", zap.String("queue", queueName), zap.Int64("jobs", n))
+		}
+	}
+}
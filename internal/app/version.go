@@ -0,0 +1,5 @@
+package app
+
+// Version is reported in the cluster registry. Release builds set it with
+// -ldflags "-X jobqueue/internal/app.Version=<version>".
+var Version = "dev"
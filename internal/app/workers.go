@@ -0,0 +1,73 @@
+package app
+
+import (
+	"context"
+
+	"jobqueue/internal/config"
+	"jobqueue/internal/heuristics"
+	"jobqueue/internal/leader"
+	"jobqueue/internal/workers"
+)
+
+// Workers is the set of worker pools and background loops started for a
+// process.
+type Workers struct {
+	pools []*workers.Pool
+}
+
+// StartWorkers starts:
+//   - a pool and autoscaler for each queue,
+//   - a manager that applies runtime pool settings to the pools,
+//   - when elected leader, the reaper and scheduler for those queues and the
+//     remote worker queues, and the usage flush,
+//   - expiry of remote worker leases.
+//
+// They stop when ctx is cancelled; call Shutdown to wait for in-flight jobs.
+// Jobs still on the queue keys used before they were hash-tagged are moved
+// over first.
+func (a *App) StartWorkers(ctx context.Context, queues []string) *Workers {
+	cfg := a.Config
+	background := append([]string(nil), queues...)
+	for _, jobType := range cfg.RemoteJobTypes {
+		background = append(background, heuristics.RemoteQueue(jobType))
+	}
+	a.migrateQueueKeys(ctx, background)
+
+	// Worker Pools & Autoscalers
+	w := &Workers{}
+	manager := workers.NewPoolManager(config.PoolSyncInterval, cfg.AutoscaleDryRun, a.Redis, a.Logger)
+	for _, queueName := range queues {
+		pool := workers.NewPool(ctx, queueName, cfg.WorkerMin, cfg.WorkerMax, cfg.ShutdownGrace, a.Lifecycle, a.Registry, a.Redis, a.Controls, a.Metrics, a.Logger)
+		scaling := a.Scaling.For(queueName)
+		scaling.DryRun = scaling.DryRun || cfg.AutoscaleDryRun
+		scaler := workers.NewAutoScaler(pool, scaling, a.DB, a.Redis, a.Metrics, a.Logger)
+		go scaler.Run(ctx)
+		manager.Add(pool, scaler)
+		w.pools = append(w.pools, pool)
+	}
+	go manager.Run(ctx)
+	a.Heartbeat.ReportPools(manager.Status)
+
+	reaper := workers.NewReaper(a.DB, a.Redis, background, config.ProcessTTL, a.Metrics, a.Logger)
+	scheduler := workers.NewScheduler(a.Redis, background, config.ProcessTTL, a.Logger)
+	go a.elector("reaper").Run(ctx, reaper.Run)
+	go a.elector("scheduler").Run(ctx, scheduler.Run)
+	go a.elector("usage").Run(ctx, func(ctx context.Context) {
+		a.Meter.Run(ctx, config.UsageFlushInterval)
+	})
+	go a.Remote.Run(ctx)
+
+	return w
+}
+
+// elector elects the one process that runs the named singleton loop.
+func (a *App) elector(name string) *leader.Elector {
+	return leader.NewElector(a.Redis, name, workers.InstanceID(), config.LeaderTTL, a.Metrics, a.Logger)
+}
+
+// Shutdown waits for every pool to stop.
+func (w *Workers) Shutdown() {
+	for _, pool := range w.pools {
+		pool.Shutdown()
+	}
+}
@@ -0,0 +1,79 @@
+// Package auth holds the credentials users authenticate with.
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+)
+
+// API key scopes. A key may only be used for what its scopes allow.
+const (
+	ScopeSubmit = "submit" // submit jobs
+	ScopeRead   = "read"   // read jobs, projects and job types
+	ScopeAdmin  = "admin"  // manage projects, members and keys, and use the admin API
+)
+
+// AllScopes are every scope, as held by a login session.
+var AllScopes = []string{ScopeSubmit, ScopeRead, ScopeAdmin}
+
+// DefaultScopes are the scopes of the key issued when a user registers. Keys
+// with the admin scope are created from a login session.
+var DefaultScopes = []string{ScopeSubmit, ScopeRead}
+
+// ValidScope reports whether scope is one of the API key scopes.
+func ValidScope(scope string) bool {
+	return scope == ScopeSubmit || scope == ScopeRead || scope == ScopeAdmin
+}
+
+// HasScope reports whether scopes contains scope.
+func HasScope(scopes []string, scope string) bool {
+	for _, s := range scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// keyPrefix marks the keys issued by this service, so they are easy to spot
+// in logs and secret scanners.
+const keyPrefix = "jq_"
+
+// GenerateAPIKey returns a new random key, the prefix by which it is shown
+// after creation, and the hash it is stored under. The key itself is never
+// stored.
+func GenerateAPIKey() (key, prefix, hash string, err error) {
+	id := make([]byte, 6)
+	secret := make([]byte, 32)
+	if _, err := rand.Read(id); err != nil {
+		return "", "", "", fmt.Errorf("generate api key: %w", err)
+	}
+	if _, err := rand.Read(secret); err != nil {
+		return "", "", "", fmt.Errorf("generate api key: %w", err)
+	}
+	prefix = keyPrefix + hex.EncodeToString(id)
+	key = prefix + "_" + base64.RawURLEncoding.EncodeToString(secret)
+	return key, prefix, HashToken(key), nil
+}
+
+// GenerateInvitationToken returns a new random secret for a project
+// invitation and the hash it is stored under. Only the inviter is given the
+// secret, and the invitee needs it to accept.
+func GenerateInvitationToken() (token, hash string, err error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", "", fmt.Errorf("generate invitation token: %w", err)
+	}
+	token = "jqi_" + base64.RawURLEncoding.EncodeToString(secret)
+	return token, HashToken(token), nil
+}
+
+// HashToken returns the hash an API key or refresh token is stored and looked
+// up under. Both are long and random, so a fast unsalted hash is enough.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
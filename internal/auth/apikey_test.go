@@ -0,0 +1,39 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGenerateAPIKey(t *testing.T) {
+	key, prefix, hash, err := GenerateAPIKey()
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(key, prefix+"_"))
+	assert.True(t, strings.HasPrefix(prefix, "jq_"))
+	assert.Equal(t, HashToken(key), hash)
+	assert.NotContains(t, hash, key)
+
+	other, _, _, err := GenerateAPIKey()
+	require.NoError(t, err)
+	assert.NotEqual(t, key, other)
+}
+
+func TestGenerateInvitationToken(t *testing.T) {
+	token, hash, err := GenerateInvitationToken()
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(token, "jqi_"))
+	assert.Equal(t, HashToken(token), hash)
+
+	other, _, err := GenerateInvitationToken()
+	require.NoError(t, err)
+	assert.NotEqual(t, token, other)
+}
+
+func TestHasScope(t *testing.T) {
+	assert.True(t, HasScope([]string{ScopeRead, ScopeSubmit}, ScopeSubmit))
+	assert.False(t, HasScope([]string{ScopeRead}, ScopeAdmin))
+	assert.False(t, ValidScope("write"))
+}
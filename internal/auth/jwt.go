@@ -0,0 +1,245 @@
+package auth
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Claims are what an access token says about its bearer.
+type Claims struct {
+	Subject   string `json:"sub"` // user ID
+	SessionID string `json:"sid"`
+	IssuedAt  int64  `json:"iat"`
+	ExpiresAt int64  `json:"exp"`
+}
+
+// JWK is a symmetric key in a JSON Web Key Set.
+type JWK struct {
+	KeyID     string `json:"kid"`
+	KeyType   string `json:"kty"`
+	Algorithm string `json:"alg,omitempty"`
+	K         string `json:"k"` // base64url-encoded secret
+}
+
+type signingKey struct {
+	id     string
+	secret []byte
+}
+
+// minSecretLen is the shortest HS256 secret accepted, as RFC 7518 requires
+// keys at least as long as the hash output.
+const minSecretLen = 32
+
+// KeySet signs access tokens with HS256. The first key signs; every key
+// verifies. To rotate, put a new key first and drop the old one once the
+// tokens it signed have expired.
+type KeySet struct {
+	mu   sync.RWMutex
+	keys []signingKey
+}
+
+// ParseKeySet reads a JWKS document such as
+//
+//	{"keys": [{"kid": "2026-10", "kty": "oct", "alg": "HS256", "k": "<base64url>"}]}
+func ParseKeySet(data []byte) (*KeySet, error) {
+	var doc struct {
+		Keys []JWK `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("parse key set: %w", err)
+	}
+	if len(doc.Keys) == 0 {
+		return nil, errors.New("key set has no keys")
+	}
+
+	set := &KeySet{}
+	seen := make(map[string]bool)
+	for _, jwk := range doc.Keys {
+		if jwk.KeyID == "" || seen[jwk.KeyID] {
+			return nil, fmt.Errorf("key set: kid must be set and unique, got %q", jwk.KeyID)
+		}
+		seen[jwk.KeyID] = true
+		if jwk.KeyType != "oct" || (jwk.Algorithm != "" && jwk.Algorithm != "HS256") {
+			return nil, fmt.Errorf("key %s: only oct keys for HS256 are supported", jwk.KeyID)
+		}
+		secret, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(jwk.K, "="))
+		if err != nil {
+			return nil, fmt.Errorf("key %s: %w", jwk.KeyID, err)
+		}
+		if len(secret) < minSecretLen {
+			return nil, fmt.Errorf("key %s: secret must be at least %d bytes", jwk.KeyID, minSecretLen)
+		}
+		set.keys = append(set.keys, signingKey{id: jwk.KeyID, secret: secret})
+	}
+	return set, nil
+}
+
+// LoadKeySet reads a key set from the JWKS file at path.
+func LoadKeySet(path string) (*KeySet, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read key set: %w", err)
+	}
+	return ParseKeySet(data)
+}
+
+// GenerateKeySet returns a set with a single random key. Tokens it signs are
+// only valid in this process until it exits.
+func GenerateKeySet() (*KeySet, error) {
+	secret := make([]byte, minSecretLen)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, fmt.Errorf("generate signing key: %w", err)
+	}
+	return &KeySet{keys: []signingKey{{id: "ephemeral", secret: secret}}}, nil
+}
+
+// Watch reloads the set from path every interval while the file changes,
+// until ctx is done. A file that fails to load leaves the current keys in
+// place.
+func (s *KeySet) Watch(ctx context.Context, path string, interval time.Duration, logger *zap.Logger) {
+	logger = logger.With(zap.String("component", "signing_keys"), zap.String("path", path))
+	var modTime time.Time
+	if info, err := os.Stat(path); err == nil {
+		modTime = info.ModTime()
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			logger.Error("failed to stat signing keys", zap.Error(err))
+			continue
+		}
+		if info.ModTime().Equal(modTime) {
+			continue
+		}
+		loaded, err := LoadKeySet(path)
+		if err != nil {
+			logger.Error("failed to reload signing keys", zap.Error(err))
+			continue
+		}
+		modTime = info.ModTime()
+		s.mu.Lock()
+		s.keys = loaded.keys
+		s.mu.Unlock()
+		logger.Info("reloaded signing keys", zap.String("kid", loaded.keys[0].id), zap.Int("keys", len(loaded.keys)))
+	}
+}
+
+var b64 = base64.RawURLEncoding
+
+// Sign returns a compact JWS of claims signed with the current key.
+func (s *KeySet) Sign(claims Claims) (string, error) {
+	s.mu.RLock()
+	key := s.keys[0]
+	s.mu.RUnlock()
+
+	header, err := json.Marshal(map[string]string{"alg": "HS256", "typ": "JWT", "kid": key.id})
+	if err != nil {
+		return "", err
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	signingInput := b64.EncodeToString(header) + "." + b64.EncodeToString(payload)
+	return signingInput + "." + b64.EncodeToString(sign(key.secret, signingInput)), nil
+}
+
+// ErrInvalidToken is returned for tokens that are malformed, signed with an
+// unknown key, tampered with or expired.
+var ErrInvalidToken = errors.New("invalid token")
+
+// Verify checks token's signature and expiry and returns its claims.
+func (s *KeySet) Verify(token string, now time.Time) (Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return Claims{}, ErrInvalidToken
+	}
+	headerJSON, err := b64.DecodeString(parts[0])
+	if err != nil {
+		return Claims{}, ErrInvalidToken
+	}
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	// Only HS256 is accepted, whatever the header claims, so that "none" or
+	// a public-key algorithm cannot be substituted.
+	if err := json.Unmarshal(headerJSON, &header); err != nil || header.Alg != "HS256" {
+		return Claims{}, ErrInvalidToken
+	}
+	secret, ok := s.secret(header.Kid)
+	if !ok {
+		return Claims{}, ErrInvalidToken
+	}
+	signature, err := b64.DecodeString(parts[2])
+	if err != nil || !hmac.Equal(signature, sign(secret, parts[0]+"."+parts[1])) {
+		return Claims{}, ErrInvalidToken
+	}
+
+	payload, err := b64.DecodeString(parts[1])
+	if err != nil {
+		return Claims{}, ErrInvalidToken
+	}
+	var claims Claims
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return Claims{}, ErrInvalidToken
+	}
+	if claims.Subject == "" || now.Unix() >= claims.ExpiresAt {
+		return Claims{}, ErrInvalidToken
+	}
+	return claims, nil
+}
+
+func (s *KeySet) secret(kid string) ([]byte, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, k := range s.keys {
+		if k.id == kid {
+			return k.secret, true
+		}
+	}
+	return nil, false
+}
+
+func sign(secret []byte, input string) []byte {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(input))
+	return mac.Sum(nil)
+}
+
+// IsJWT reports whether token has the shape of a compact JWS rather than an
+// API key.
+func IsJWT(token string) bool {
+	return strings.Count(token, ".") == 2
+}
+
+// GenerateRefreshToken returns a new opaque refresh token and the hash it is
+// stored under.
+func GenerateRefreshToken() (token, hash string, err error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", "", fmt.Errorf("generate refresh token: %w", err)
+	}
+	token = "jqr_" + b64.EncodeToString(secret)
+	return token, HashToken(token), nil
+}
@@ -0,0 +1,73 @@
+package auth
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func keySet(t *testing.T, kids ...string) *KeySet {
+	t.Helper()
+	var jwks []string
+	for _, kid := range kids {
+		secret := base64.RawURLEncoding.EncodeToString([]byte(strings.Repeat(kid, 32)))
+		jwks = append(jwks, fmt.Sprintf(`{"kid": %q, "kty": "oct", "alg": "HS256", "k": %q}`, kid, secret))
+	}
+	set, err := ParseKeySet([]byte(`{"keys": [` + strings.Join(jwks, ",") + `]}`))
+	require.NoError(t, err)
+	return set
+}
+
+func TestSignVerify(t *testing.T) {
+	now := time.Now()
+	keys := keySet(t, "a")
+	token, err := keys.Sign(Claims{Subject: "user", SessionID: "session", IssuedAt: now.Unix(), ExpiresAt: now.Add(time.Minute).Unix()})
+	require.NoError(t, err)
+	assert.True(t, IsJWT(token))
+
+	claims, err := keys.Verify(token, now)
+	require.NoError(t, err)
+	assert.Equal(t, "user", claims.Subject)
+	assert.Equal(t, "session", claims.SessionID)
+
+	_, err = keys.Verify(token, now.Add(time.Minute))
+	assert.ErrorIs(t, err, ErrInvalidToken, "expired")
+
+	parts := strings.Split(token, ".")
+	forged := base64.RawURLEncoding.EncodeToString([]byte(`{"sub":"admin","sid":"session","exp":9999999999}`))
+	_, err = keys.Verify(parts[0]+"."+forged+"."+parts[2], now)
+	assert.ErrorIs(t, err, ErrInvalidToken, "tampered")
+
+	none := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"none","kid":"a"}`))
+	_, err = keys.Verify(none+"."+parts[1]+".", now)
+	assert.ErrorIs(t, err, ErrInvalidToken, "alg none")
+}
+
+func TestKeyRotation(t *testing.T) {
+	now := time.Now()
+	claims := Claims{Subject: "user", ExpiresAt: now.Add(time.Minute).Unix()}
+	old, err := keySet(t, "a").Sign(claims)
+	require.NoError(t, err)
+
+	// The new key signs; the old one still verifies until it is dropped.
+	rotated := keySet(t, "b", "a")
+	_, err = rotated.Verify(old, now)
+	assert.NoError(t, err)
+	fresh, err := rotated.Sign(claims)
+	require.NoError(t, err)
+	_, err = keySet(t, "a").Verify(fresh, now)
+	assert.ErrorIs(t, err, ErrInvalidToken)
+
+	_, err = keySet(t, "b").Verify(old, now)
+	assert.ErrorIs(t, err, ErrInvalidToken)
+}
+
+func TestParseKeySetRejectsShortSecrets(t *testing.T) {
+	_, err := ParseKeySet([]byte(`{"keys": [{"kid": "a", "kty": "oct", "k": "c2hvcnQ"}]}`))
+	assert.Error(t, err)
+}
@@ -1 +1,102 @@
-package config
\ No newline at end of file
+package config
+
+import "time"
+
+// DefaultWorkerQueues are the queues worker pools run for when WORKER_QUEUES
+// is not set.
+var DefaultWorkerQueues = []string{"queue:high", "queue:default"}
+
+const (
+	// DefaultWorkerMin and DefaultWorkerMax bound the size of each pool.
+	DefaultWorkerMin = 1
+	DefaultWorkerMax = 10
+
+	// DefaultShutdownGrace is how long a worker that is scaled down or shut
+	// down may keep running its current job before the job is aborted and
+	// requeued.
+	DefaultShutdownGrace = 30 * time.Second
+
+	// DefaultSemaphoreLease is how long a concurrency slot is held before it
+	// expires if the holder stops refreshing it (e.g. the process died).
+	DefaultSemaphoreLease = 1 * time.Minute
+
+	// DefaultDeferDelay is how long a job that could not run yet (no free
+	// concurrency slot) waits in the scheduled set before it is retried.
+	DefaultDeferDelay = 2 * time.Second
+
+	// ControlCacheTTL is how long a replica trusts its local copy of the
+	// paused/draining states before re-reading them from Redis.
+	ControlCacheTTL = 2 * time.Second
+
+	// PausedPollInterval is how often a worker on a paused queue checks
+	// whether it has been resumed.
+	PausedPollInterval = 1 * time.Second
+
+	// PausedJobDelay is how long a job of a paused type is set aside before
+	// a worker looks at it again.
+	PausedJobDelay = 15 * time.Second
+
+	// PoolSyncInterval is how often each process applies pool settings
+	// changed through the admin API and reports its pools' status.
+	PoolSyncInterval = 2 * time.Second
+
+	// HeartbeatInterval is how often each process refreshes its entry in
+	// the cluster registry. A process silent for ProcessTTL is considered
+	// dead and the jobs its workers were running are reclaimed.
+	HeartbeatInterval = 5 * time.Second
+	ProcessTTL        = 3 * HeartbeatInterval
+
+	// LeaderTTL is how long a leader's lock outlives its last renewal, and
+	// so how long singleton loops may go unattended after a leader dies.
+	LeaderTTL = 15 * time.Second
+
+	// UsageFlushInterval is how often usage counters are moved from Redis to
+	// Postgres, and so how far the usage endpoint may lag behind.
+	UsageFlushInterval = 1 * time.Minute
+
+	// DefaultBacklogSoftWatermark is the fraction of a backlog limit at which
+	// submits start logging warnings.
+	DefaultBacklogSoftWatermark = 0.8
+
+	// DefaultBacklogRetryAfter is the Retry-After sent when a submit is
+	// rejected because a backlog is full.
+	DefaultBacklogRetryAfter = 30 * time.Second
+
+	// DefaultAccessTokenTTL and DefaultRefreshTokenTTL are how long the
+	// access tokens issued at login and on refresh, and the sessions they
+	// belong to, stay valid.
+	DefaultAccessTokenTTL  = 15 * time.Minute
+	DefaultRefreshTokenTTL = 30 * 24 * time.Hour
+
+	// DefaultPlan is the plan of users who have not been given another one;
+	// plans select API rate limits.
+	DefaultPlan = "free"
+
+	// SigningKeysReloadInterval is how often JWT_KEYS_FILE is checked for
+	// rotated keys.
+	SigningKeysReloadInterval = 30 * time.Second
+
+	// MaxAPIKeyRotationGrace bounds how long a rotated API key may keep
+	// working alongside its replacement.
+	MaxAPIKeyRotationGrace = 24 * time.Hour
+
+	// DefaultJobPageSize and MaxJobPageSize are the default and largest
+	// number of jobs returned per page by the job listing.
+	DefaultJobPageSize = 50
+	MaxJobPageSize     = 500
+
+	// MaxBulkSubmitJobs and MaxBulkSubmitBytes bound one bulk submit;
+	// BulkInsertBatchSize is how many of its jobs are inserted per statement.
+	MaxBulkSubmitJobs   = 10000
+	MaxBulkSubmitBytes  = 32 << 20
+	BulkInsertBatchSize = 500
+
+	// JobSearchBackfillBatchSize is how many existing jobs are given a search
+	// vector per statement after the column is added.
+	JobSearchBackfillBatchSize = 1000
+
+	// DefaultRemoteLease and MaxRemoteLease bound how long a remote worker
+	// may hold a job between heartbeats.
+	DefaultRemoteLease = 1 * time.Minute
+	MaxRemoteLease     = 10 * time.Minute
+)
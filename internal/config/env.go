@@ -1,7 +1,11 @@
 package config
 
 import (
+	"fmt"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
 )
@@ -11,6 +15,94 @@ type Config struct {
 	PostgresDSN string
 	RedisURL    string
 	Port        string
+
+	// WorkerQueues are the queues this process runs worker pools for, each
+	// sized between WorkerMin and WorkerMax workers. Processes that do not
+	// serve the API expose metrics on MetricsPort instead.
+	WorkerQueues []string
+	WorkerMin    int
+	WorkerMax    int
+	MetricsPort  string
+	// ShutdownGrace bounds how long in-flight jobs may run once their worker
+	// has been told to stop (WORKER_SHUTDOWN_GRACE).
+	ShutdownGrace time.Duration
+	// AutoscaleFile points to the JSON autoscaling policies per queue; when
+	// AutoscaleDryRun is set the autoscalers only log their decisions.
+	AutoscaleFile   string
+	AutoscaleDryRun bool
+
+	// RedisAddrs, when set, replaces RedisURL with a Sentinel (if
+	// RedisMasterName is set) or Cluster (if several addresses are given or
+	// RedisCluster is true) deployment.
+	RedisAddrs            []string
+	RedisMasterName       string
+	RedisCluster          bool
+	RedisUsername         string
+	RedisPassword         string
+	RedisSentinelPassword string
+	RedisDB               int
+
+	// JobConcurrencyLimits caps how many jobs of a type may run at once
+	// across all replicas. Types not listed are unlimited.
+	JobConcurrencyLimits map[string]int
+	// ProjectConcurrencyLimits caps how many jobs of a type may run at once
+	// for any single project.
+	ProjectConcurrencyLimits map[string]int
+	SemaphoreLease           time.Duration
+	DeferDelay               time.Duration
+
+	// JobRateLimits caps how fast jobs of a type are started across all
+	// replicas, e.g. JOB_RATE_LIMITS="send_email=100/m".
+	JobRateLimits map[string]RateLimit
+
+	// RemoteJobTypes are served by remote workers over HTTP, which
+	// authenticate with one of RemoteWorkerTokens (worker name -> token).
+	RemoteJobTypes     []string
+	RemoteWorkerTokens map[string]string
+
+	// JobTimeouts bounds how long a single run of a job type may take,
+	// e.g. JOB_TIMEOUTS="send_email=30s".
+	JobTimeouts map[string]time.Duration
+
+	// ExecTasksFile points to the JSON allow-list of commands that may be
+	// run as jobs, keyed by job type.
+	ExecTasksFile string
+
+	// QueueMaxDepths and ProjectMaxBacklogs bound how many jobs may be
+	// waiting per queue and per project; submits beyond that are rejected.
+	// The defaults apply to queues/projects not listed; zero is unlimited.
+	QueueMaxDepths           map[string]int
+	DefaultQueueMaxDepth     int
+	ProjectMaxBacklogs       map[string]int
+	DefaultProjectMaxBacklog int
+	BacklogSoftWatermark     float64
+	BacklogRetryAfter        time.Duration
+	// JWTKeysFile points to the JWKS file holding the keys that sign access
+	// tokens; without it each process signs with a random key of its own.
+	// AccessTokenTTL and RefreshTokenTTL bound access tokens and sessions.
+	JWTKeysFile     string
+	AccessTokenTTL  time.Duration
+	RefreshTokenTTL time.Duration
+	// ProjectMonthlyQuotas caps how many jobs each project may submit per
+	// calendar month (UTC); DefaultProjectMonthlyQuota applies to projects
+	// not listed. Zero is unlimited.
+	ProjectMonthlyQuotas       map[string]int
+	DefaultProjectMonthlyQuota int
+	// AdminEmails are the accounts given the admin flag, which the
+	// /api/v1/admin API requires, at startup, e.g.
+	// ADMIN_EMAILS="ops@example.com". An account must exist before it can be
+	// made admin, and is not demoted when dropped from the list; to revoke,
+	// run UPDATE users SET is_admin = false WHERE email = '...'.
+	AdminEmails []string
+	// RateLimitsFile points to the JSON API rate limits per user, plan,
+	// project and route.
+	RateLimitsFile string
+}
+
+// RateLimit allows Count events every Per.
+type RateLimit struct {
+	Count int
+	Per   time.Duration
 }
 
 // Load reads configuration from environment variables.
@@ -27,9 +119,333 @@ func Load() (*Config, error) {
 		port = "8080"
 	}
 
+	metricsPort := os.Getenv("METRICS_PORT")
+	if metricsPort == "" {
+		metricsPort = "9091"
+	}
+
+	workerQueues := ParseList(os.Getenv("WORKER_QUEUES"))
+	if len(workerQueues) == 0 {
+		workerQueues = DefaultWorkerQueues
+	}
+	workerMin, err := parseInt("WORKER_MIN", DefaultWorkerMin)
+	if err != nil {
+		return nil, err
+	}
+	workerMax, err := parseInt("WORKER_MAX", DefaultWorkerMax)
+	if err != nil {
+		return nil, err
+	}
+	if workerMax < workerMin {
+		return nil, fmt.Errorf("WORKER_MAX (%d) must not be less than WORKER_MIN (%d)", workerMax, workerMin)
+	}
+	shutdownGrace, err := parseDuration("WORKER_SHUTDOWN_GRACE", DefaultShutdownGrace)
+	if err != nil {
+		return nil, err
+	}
+	autoscaleDryRun, err := parseBool("AUTOSCALE_DRY_RUN", false)
+	if err != nil {
+		return nil, err
+	}
+
+	redisAddrs := ParseList(os.Getenv("REDIS_ADDRS"))
+	redisCluster, err := parseBool("REDIS_CLUSTER", false)
+	if err != nil {
+		return nil, err
+	}
+	redisDB, err := parseInt("REDIS_DB", 0)
+	if err != nil {
+		return nil, err
+	}
+	if redisCluster && redisDB != 0 {
+		return nil, fmt.Errorf("REDIS_DB must be 0 in cluster mode, got %d", redisDB)
+	}
+
+	concurrency, err := parseIntMap("JOB_CONCURRENCY_LIMITS")
+	if err != nil {
+		return nil, err
+	}
+	projectConcurrency, err := parseIntMap("JOB_PROJECT_CONCURRENCY_LIMITS")
+	if err != nil {
+		return nil, err
+	}
+	lease, err := parseDuration("SEMAPHORE_LEASE", DefaultSemaphoreLease)
+	if err != nil {
+		return nil, err
+	}
+	if lease <= 0 {
+		return nil, fmt.Errorf("SEMAPHORE_LEASE must be positive, got %s", lease)
+	}
+	deferDelay, err := parseDuration("JOB_DEFER_DELAY", DefaultDeferDelay)
+	if err != nil {
+		return nil, err
+	}
+	rateLimits, err := parseRateMap("JOB_RATE_LIMITS")
+	if err != nil {
+		return nil, err
+	}
+
+	timeouts, err := parseDurationMap("JOB_TIMEOUTS")
+	if err != nil {
+		return nil, err
+	}
+	workerTokens, err := parseStringMap("REMOTE_WORKER_TOKENS")
+	if err != nil {
+		return nil, err
+	}
+
+	queueDepths, err := parseIntMap("QUEUE_MAX_DEPTHS")
+	if err != nil {
+		return nil, err
+	}
+	defaultQueueDepth, err := parseInt("DEFAULT_QUEUE_MAX_DEPTH", 0)
+	if err != nil {
+		return nil, err
+	}
+	projectBacklogs, err := parseIntMap("PROJECT_MAX_BACKLOGS")
+	if err != nil {
+		return nil, err
+	}
+	defaultProjectBacklog, err := parseInt("DEFAULT_PROJECT_MAX_BACKLOG", 0)
+	if err != nil {
+		return nil, err
+	}
+	watermark, err := parseFloat("BACKLOG_SOFT_WATERMARK", DefaultBacklogSoftWatermark)
+	if err != nil {
+		return nil, err
+	}
+	if watermark <= 0 || watermark > 1 {
+		return nil, fmt.Errorf("BACKLOG_SOFT_WATERMARK must be in (0, 1], got %v", watermark)
+	}
+	retryAfter, err := parseDuration("BACKLOG_RETRY_AFTER", DefaultBacklogRetryAfter)
+	if err != nil {
+		return nil, err
+	}
+
+	monthlyQuotas, err := parseIntMap("PROJECT_MONTHLY_QUOTAS")
+	if err != nil {
+		return nil, err
+	}
+	defaultMonthlyQuota, err := parseInt("DEFAULT_PROJECT_MONTHLY_QUOTA", 0)
+	if err != nil {
+		return nil, err
+	}
+
+	accessTTL, err := parseDuration("ACCESS_TOKEN_TTL", DefaultAccessTokenTTL)
+	if err != nil {
+		return nil, err
+	}
+	refreshTTL, err := parseDuration("REFRESH_TOKEN_TTL", DefaultRefreshTokenTTL)
+	if err != nil {
+		return nil, err
+	}
+	if accessTTL <= 0 || refreshTTL < accessTTL {
+		return nil, fmt.Errorf("ACCESS_TOKEN_TTL must be positive and not exceed REFRESH_TOKEN_TTL, got %s and %s", accessTTL, refreshTTL)
+	}
+
 	return &Config{
-		PostgresDSN: dsn,
-		RedisURL:    redisURL,
-		Port:        port,
+		PostgresDSN:                dsn,
+		RedisURL:                   redisURL,
+		Port:                       port,
+		WorkerQueues:               workerQueues,
+		WorkerMin:                  workerMin,
+		WorkerMax:                  workerMax,
+		ShutdownGrace:              shutdownGrace,
+		AutoscaleFile:              os.Getenv("AUTOSCALE_FILE"),
+		AutoscaleDryRun:            autoscaleDryRun,
+		MetricsPort:                metricsPort,
+		RedisAddrs:                 redisAddrs,
+		RedisMasterName:            os.Getenv("REDIS_MASTER_NAME"),
+		RedisCluster:               redisCluster,
+		RedisUsername:              os.Getenv("REDIS_USERNAME"),
+		RedisPassword:              os.Getenv("REDIS_PASSWORD"),
+		RedisSentinelPassword:      os.Getenv("REDIS_SENTINEL_PASSWORD"),
+		RedisDB:                    redisDB,
+		JobConcurrencyLimits:       concurrency,
+		ProjectConcurrencyLimits:   projectConcurrency,
+		SemaphoreLease:             lease,
+		DeferDelay:                 deferDelay,
+		JobRateLimits:              rateLimits,
+		RemoteJobTypes:             ParseList(os.Getenv("REMOTE_JOB_TYPES")),
+		RemoteWorkerTokens:         workerTokens,
+		JobTimeouts:                timeouts,
+		ExecTasksFile:              os.Getenv("EXEC_TASKS_FILE"),
+		QueueMaxDepths:             queueDepths,
+		DefaultQueueMaxDepth:       defaultQueueDepth,
+		ProjectMaxBacklogs:         projectBacklogs,
+		DefaultProjectMaxBacklog:   defaultProjectBacklog,
+		BacklogSoftWatermark:       watermark,
+		BacklogRetryAfter:          retryAfter,
+		JWTKeysFile:                os.Getenv("JWT_KEYS_FILE"),
+		AccessTokenTTL:             accessTTL,
+		RefreshTokenTTL:            refreshTTL,
+		RateLimitsFile:             os.Getenv("RATE_LIMITS_FILE"),
+		AdminEmails:                ParseList(os.Getenv("ADMIN_EMAILS")),
+		ProjectMonthlyQuotas:       monthlyQuotas,
+		DefaultProjectMonthlyQuota: defaultMonthlyQuota,
 	}, nil
-}
\ No newline at end of file
+}
+
+// ParseList splits a comma-separated list, dropping empty items.
+func ParseList(raw string) []string {
+	var out []string
+	for _, item := range strings.Split(raw, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			out = append(out, item)
+		}
+	}
+	return out
+}
+
+// parseStringMap reads a "key=value,key=value" list from env.
+func parseStringMap(env string) (map[string]string, error) {
+	out := make(map[string]string)
+	for _, pair := range ParseList(os.Getenv(env)) {
+		key, value, ok := strings.Cut(pair, "=")
+		if !ok || strings.TrimSpace(key) == "" || strings.TrimSpace(value) == "" {
+			return nil, fmt.Errorf("%s: expected key=value, got %q", env, pair)
+		}
+		out[strings.TrimSpace(key)] = strings.TrimSpace(value)
+	}
+	return out, nil
+}
+
+// parseDurationMap reads a "key=duration,key=duration" list from env.
+func parseDurationMap(env string) (map[string]time.Duration, error) {
+	raw, err := parseStringMap(env)
+	if err != nil {
+		return nil, err
+	}
+	out := make(map[string]time.Duration, len(raw))
+	for key, value := range raw {
+		d, err := time.ParseDuration(value)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("%s: invalid duration for %q: %q", env, key, value)
+		}
+		out[key] = d
+	}
+	return out, nil
+}
+
+// parseIntMap reads a "key=value,key=value" list of integers from env.
+func parseIntMap(env string) (map[string]int, error) {
+	out := make(map[string]int)
+	raw := strings.TrimSpace(os.Getenv(env))
+	if raw == "" {
+		return out, nil
+	}
+	for _, pair := range strings.Split(raw, ",") {
+		key, value, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok {
+			return nil, fmt.Errorf("%s: expected key=value, got %q", env, pair)
+		}
+		n, err := strconv.Atoi(strings.TrimSpace(value))
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("%s: invalid value for %q: %q", env, key, value)
+		}
+		out[strings.TrimSpace(key)] = n
+	}
+	return out, nil
+}
+
+// parseRateMap reads a "key=count/period" list from env. The period is either
+// a single unit (s, m, h) or a Go duration such as 30s.
+func parseRateMap(env string) (map[string]RateLimit, error) {
+	out := make(map[string]RateLimit)
+	raw := strings.TrimSpace(os.Getenv(env))
+	if raw == "" {
+		return out, nil
+	}
+	for _, pair := range strings.Split(raw, ",") {
+		key, value, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok {
+			return nil, fmt.Errorf("%s: expected key=count/period, got %q", env, pair)
+		}
+		rl, err := ParseRateLimit(strings.TrimSpace(value))
+		if err != nil {
+			return nil, fmt.Errorf("%s: invalid value for %q: %w", env, key, err)
+		}
+		out[strings.TrimSpace(key)] = rl
+	}
+	return out, nil
+}
+
+// ParseRateLimit parses a "count/period" spec such as "100/m" or "5/10s".
+// Limits are kept in milliseconds, so the period must be at least 1ms.
+func ParseRateLimit(spec string) (RateLimit, error) {
+	countStr, periodStr, ok := strings.Cut(spec, "/")
+	if !ok {
+		return RateLimit{}, fmt.Errorf("expected count/period, got %q", spec)
+	}
+	count, err := strconv.Atoi(countStr)
+	if err != nil || count <= 0 {
+		return RateLimit{}, fmt.Errorf("invalid count %q", countStr)
+	}
+	var per time.Duration
+	switch periodStr {
+	case "s":
+		per = time.Second
+	case "m":
+		per = time.Minute
+	case "h":
+		per = time.Hour
+	default:
+		per, err = time.ParseDuration(periodStr)
+		if err != nil || per < time.Millisecond {
+			return RateLimit{}, fmt.Errorf("invalid period %q", periodStr)
+		}
+	}
+	return RateLimit{Count: count, Per: per}, nil
+}
+
+// parseInt reads a non-negative integer from env, falling back to def if unset.
+func parseInt(env string, def int) (int, error) {
+	raw := os.Getenv(env)
+	if raw == "" {
+		return def, nil
+	}
+	n, err := strconv.Atoi(raw)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("%s: invalid value %q", env, raw)
+	}
+	return n, nil
+}
+
+// parseBool reads a boolean from env, falling back to def if unset.
+func parseBool(env string, def bool) (bool, error) {
+	raw := os.Getenv(env)
+	if raw == "" {
+		return def, nil
+	}
+	b, err := strconv.ParseBool(raw)
+	if err != nil {
+		return false, fmt.Errorf("%s: %w", env, err)
+	}
+	return b, nil
+}
+
+// parseFloat reads a float from env, falling back to def if unset.
+func parseFloat(env string, def float64) (float64, error) {
+	raw := os.Getenv(env)
+	if raw == "" {
+		return def, nil
+	}
+	f, err := strconv.ParseFloat(raw, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", env, err)
+	}
+	return f, nil
+}
+
+// parseDuration reads a time.Duration from env, falling back to def if unset.
+func parseDuration(env string, def time.Duration) (time.Duration, error) {
+	raw := os.Getenv(env)
+	if raw == "" {
+		return def, nil
+	}
+	d, err := time.ParseDuration(raw)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", env, err)
+	}
+	return d, nil
+}
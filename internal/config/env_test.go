@@ -0,0 +1,38 @@
+package config
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseIntMap(t *testing.T) {
+	t.Setenv("TEST_LIMITS", "send_email=5, generate_receipt = 10")
+	limits, err := parseIntMap("TEST_LIMITS")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]int{"send_email": 5, "generate_receipt": 10}, limits)
+
+	t.Setenv("TEST_LIMITS", "send_email")
+	_, err = parseIntMap("TEST_LIMITS")
+	assert.Error(t, err)
+
+	t.Setenv("TEST_LIMITS", "send_email=-1")
+	_, err = parseIntMap("TEST_LIMITS")
+	assert.Error(t, err)
+}
+
+func TestParseRateLimit(t *testing.T) {
+	rl, err := ParseRateLimit("100/m")
+	assert.NoError(t, err)
+	assert.Equal(t, RateLimit{Count: 100, Per: time.Minute}, rl)
+
+	rl, err = ParseRateLimit("5/10s")
+	assert.NoError(t, err)
+	assert.Equal(t, RateLimit{Count: 5, Per: 10 * time.Second}, rl)
+
+	for _, bad := range []string{"100", "0/m", "x/m", "10/fortnight", "5/500us", "5/0s"} {
+		_, err := ParseRateLimit(bad)
+		assert.Error(t, err, bad)
+	}
+}
@@ -0,0 +1,164 @@
+package control
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// Operator-controlled states for a queue or a job type. Anything without an
+// explicit state is active.
+const (
+	StateActive   = "active"
+	StatePaused   = "paused"   // workers stop taking jobs; submits are still accepted
+	StateDraining = "draining" // submits are rejected; workers finish the backlog
+)
+
+// Targets a state can be applied to.
+const (
+	KindQueue = "queue"
+	KindType  = "type"
+)
+
+// Entry is the state of a single queue or job type.
+type Entry struct {
+	Kind  string `json:"kind"`
+	Name  string `json:"name"`
+	State string `json:"state"`
+}
+
+// Store keeps queue and job type states in Redis so every replica honors them.
+// Reads are served from a short-lived local snapshot to keep them off the
+// worker hot path.
+type Store struct {
+	rdb redis.UniversalClient
+	ttl time.Duration
+
+	mu      sync.Mutex
+	states  map[string]map[string]string
+	fetched time.Time
+}
+
+func NewStore(rdb redis.UniversalClient, ttl time.Duration) *Store {
+	return &Store{rdb: rdb, ttl: ttl}
+}
+
+func hashKey(kind string) string {
+	return fmt.Sprintf("control:%s", kind)
+}
+
+func validKind(kind string) bool {
+	return kind == KindQueue || kind == KindType
+}
+
+// ValidState reports whether state can be set on a queue or job type.
+func ValidState(state string) bool {
+	return state == StateActive || state == StatePaused || state == StateDraining
+}
+
+// Set changes the state of a queue or job type. Setting StateActive clears it.
+func (s *Store) Set(ctx context.Context, kind, name, state string) error {
+	if !validKind(kind) {
+		return fmt.Errorf("unknown control kind: %s", kind)
+	}
+	if !ValidState(state) {
+		return fmt.Errorf("unknown state: %s", state)
+	}
+
+	var err error
+	if state == StateActive {
+		err = s.rdb.HDel(ctx, hashKey(kind), name).Err()
+	} else {
+		err = s.rdb.HSet(ctx, hashKey(kind), name, state).Err()
+	}
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.fetched = time.Time{} // force the next read to see the change
+	s.mu.Unlock()
+	return nil
+}
+
+// Get returns the state of a queue or job type. If Redis cannot be reached it
+// returns the last known state along with the error.
+func (s *Store) Get(ctx context.Context, kind, name string) (string, error) {
+	states, err := s.snapshot(ctx)
+	if state, ok := states[kind][name]; ok {
+		return state, err
+	}
+	return StateActive, err
+}
+
+// Draining reports whether a job's queue or its type is draining, in which
+// case submits are rejected even if the other is paused. If Redis cannot be
+// reached it answers from the last known states along with the error.
+func (s *Store) Draining(ctx context.Context, queueName, jobType string) (bool, error) {
+	queueState, err := s.Get(ctx, KindQueue, queueName)
+	typeState, _ := s.Get(ctx, KindType, jobType)
+	return queueState == StateDraining || typeState == StateDraining, err
+}
+
+// Effective combines the state of a job's queue and its type for display:
+// paused wins over draining, which wins over active. Use Draining to decide
+// whether to accept a submit.
+func (s *Store) Effective(ctx context.Context, queueName, jobType string) (string, error) {
+	queueState, err := s.Get(ctx, KindQueue, queueName)
+	typeState, _ := s.Get(ctx, KindType, jobType)
+	for _, state := range []string{StatePaused, StateDraining} {
+		if queueState == state || typeState == state {
+			return state, err
+		}
+	}
+	return StateActive, err
+}
+
+// List returns every queue and job type that is not active.
+func (s *Store) List(ctx context.Context) ([]Entry, error) {
+	states, err := s.snapshot(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var entries []Entry
+	for kind, names := range states {
+		for name, state := range names {
+			entries = append(entries, Entry{Kind: kind, Name: name, State: state})
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Kind != entries[j].Kind {
+			return entries[i].Kind < entries[j].Kind
+		}
+		return entries[i].Name < entries[j].Name
+	})
+	return entries, nil
+}
+
+func (s *Store) snapshot(ctx context.Context) (map[string]map[string]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.states != nil && time.Since(s.fetched) < s.ttl {
+		return s.states, nil
+	}
+
+	states := make(map[string]map[string]string)
+	for _, kind := range []string{KindQueue, KindType} {
+		names, err := s.rdb.HGetAll(ctx, hashKey(kind)).Result()
+		if err != nil {
+			if s.states != nil {
+				return s.states, err // serve the stale snapshot rather than nothing
+			}
+			return nil, err
+		}
+		states[kind] = names
+	}
+	s.states = states
+	s.fetched = time.Now()
+	return states, nil
+}
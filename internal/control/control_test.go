@@ -0,0 +1,45 @@
+package control
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPausedAndDraining(t *testing.T) {
+	redisURL := os.Getenv("REDIS_URL")
+	if redisURL == "" {
+		t.Skip("REDIS_URL environment variable not set, skipping test")
+	}
+	opts, err := redis.ParseURL(redisURL)
+	require.NoError(t, err)
+	rdb := redis.NewClient(opts)
+	defer rdb.Close()
+
+	ctx := context.Background()
+	suffix := time.Now().Format("150405.000000")
+	queueName, jobType := "test:queue:"+suffix, "test-type-"+suffix
+	s := NewStore(rdb, 0)
+	defer s.Set(ctx, KindQueue, queueName, StateActive)
+	defer s.Set(ctx, KindType, jobType, StateActive)
+
+	require.NoError(t, s.Set(ctx, KindQueue, queueName, StatePaused))
+	require.NoError(t, s.Set(ctx, KindType, jobType, StateDraining))
+
+	state, err := s.Effective(ctx, queueName, jobType)
+	require.NoError(t, err)
+	assert.Equal(t, StatePaused, state)
+	draining, err := s.Draining(ctx, queueName, jobType)
+	require.NoError(t, err)
+	assert.True(t, draining, "a paused queue must still reject submits while its type drains")
+
+	require.NoError(t, s.Set(ctx, KindType, jobType, StateActive))
+	draining, err = s.Draining(ctx, queueName, jobType)
+	require.NoError(t, err)
+	assert.False(t, draining)
+}
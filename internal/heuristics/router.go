@@ -1,6 +1,36 @@
 package heuristics
 
+import "sync"
+
+var (
+    remoteMu    sync.RWMutex
+    remoteTypes = make(map[string]bool)
+)
+
+// RegisterRemote routes jobType to a queue of its own that is served by
+// remote workers over HTTP rather than by the in-process pools.
+func RegisterRemote(jobType string) {
+    remoteMu.Lock()
+    defer remoteMu.Unlock()
+    remoteTypes[jobType] = true
+}
+
+// IsRemote reports whether jobType is served by remote workers.
+func IsRemote(jobType string) bool {
+    remoteMu.RLock()
+    defer remoteMu.RUnlock()
+    return remoteTypes[jobType]
+}
+
+// RemoteQueue returns the queue remote workers lease jobType from.
+func RemoteQueue(jobType string) string {
+    return "queue:remote:" + jobType
+}
+
 func GetPriorityQueue(jobType string) string {
+    if IsRemote(jobType) {
+        return RemoteQueue(jobType)
+    }
     switch jobType {
     case "email":
         return "queue:priority:1"
@@ -11,4 +41,4 @@ func GetPriorityQueue(jobType string) string {
     default:
         return "queue:priority:2"
     }
-}
\ No newline at end of file
+}
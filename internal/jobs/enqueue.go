@@ -7,9 +7,10 @@ import(
 	"time"
 	"encoding/json"
 	"jobqueue/internal/heuristics"
+	"jobqueue/internal/queue"
 )
 
-func EnqueueJob(rdb *redis.Client, job Job) error {
+func EnqueueJob(rdb redis.UniversalClient, job Job) error {
 	if job.MaxRetries == 0 {
 		job.MaxRetries = 3
 	}
@@ -24,5 +25,5 @@ func EnqueueJob(rdb *redis.Client, job Job) error {
 	// For now, use a simple queue name since heuristics router is not implemented
 	// queueName := "queue:priority:1"
 	queueName := heuristics.GetPriorityQueue(job.Type)
-	return rdb.LPush(context.Background(), queueName, data).Err()
+	return queue.Push(context.Background(), rdb, queueName, string(data))
 }
\ No newline at end of file
@@ -6,7 +6,8 @@ import (
     "fmt"
     "github.com/go-redis/redis/v8"
     "github.com/stretchr/testify/assert"
-  
+    "jobqueue/internal/queue"
+    "os"
     "testing"
     "time"
 )
@@ -15,7 +16,7 @@ func TestEnqueueJob(t *testing.T) {
     fmt.Println("=== Starting EnqueueJob Test ===")
     
     // Get Redis URL from environment variable
-    redisURL := 
+    redisURL := os.Getenv("REDIS_URL")
     if redisURL == "" {
         fmt.Println("❌ REDIS_URL environment variable not set, skipping test")
         t.Skip("REDIS_URL environment variable not set, skipping test")
@@ -36,8 +37,8 @@ func TestEnqueueJob(t *testing.T) {
     defer rdb.Close()
     fmt.Println("✅ Redis client created")
 
-    // Test queue name
-    queueName := "queue:priority:1"
+    // Test queue name, as the tagged key queue.Push writes to
+    queueName := queue.Key("queue:priority:1")
     fmt.Printf("📋 Using queue name: %s\n", queueName)
     
     // Clean up any existing data in the test queue
@@ -0,0 +1,51 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"jobqueue/internal/heuristics"
+	"jobqueue/internal/models"
+	"jobqueue/internal/queue"
+	"jobqueue/internal/tasks"
+)
+
+// Enqueue submits a job of jobType with a typed payload to projectID and
+// returns its ID. Producers and the handler registered with
+// tasks.RegisterTyped share T, and the payload is validated here the same way
+// the handler will validate it, so bad payloads fail at the producer.
+//
+// Enqueue is for trusted in-process producers: it does not apply the
+// membership, drain or backlog checks the HTTP submit endpoint does.
+func Enqueue[T any](ctx context.Context, db *gorm.DB, rdb redis.UniversalClient, projectID, jobType string, payload T) (string, error) {
+	if err := tasks.ValidatePayload(payload); err != nil {
+		return "", fmt.Errorf("invalid %s payload: %w", jobType, err)
+	}
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return "", fmt.Errorf("encode %s payload: %w", jobType, err)
+	}
+
+	now := time.Now()
+	job := models.Job{
+		ID:        uuid.NewString(),
+		Type:      jobType,
+		Payload:   string(data),
+		Status:    models.StatusQueued,
+		CreatedAt: now,
+		UpdatedAt: now,
+		ProjectID: projectID,
+	}
+	if err := db.WithContext(ctx).Create(&job).Error; err != nil {
+		return "", err
+	}
+	if err := queue.Push(ctx, rdb, heuristics.GetPriorityQueue(jobType), job.ID); err != nil {
+		return job.ID, err
+	}
+	return job.ID, nil
+}
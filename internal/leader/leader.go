@@ -0,0 +1,226 @@
+// Package leader elects a single process among the replicas to run singleton
+// background loops such as the reaper and the scheduler.
+package leader
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"go.uber.org/zap"
+	"jobqueue/internal/monitoring"
+)
+
+// The lock and its term counter share a hash tag so the scripts can use both
+// on Redis Cluster.
+func lockKey(name string) string {
+	return "leader:{" + name + "}"
+}
+
+func termKey(name string) string {
+	return lockKey(name) + ":term"
+}
+
+// acquireScript takes the lock if it is free, stamping it with the holder
+// and a term that grows with every new leader.
+var acquireScript = redis.NewScript(`
+if redis.call('EXISTS', KEYS[1]) == 1 then
+	return 0
+end
+local term = redis.call('INCR', KEYS[2])
+redis.call('SET', KEYS[1], ARGV[1] .. ':' .. term, 'PX', ARGV[2])
+return term
+`)
+
+var renewScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('PEXPIRE', KEYS[1], ARGV[2])
+end
+return 0
+`)
+
+var releaseScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('DEL', KEYS[1])
+end
+return 0
+`)
+
+// Lease is held by the current leader. Term increases with every change of
+// leader, which tells successive leaders apart in logs. It is not a fencing
+// token: nothing the leader writes is checked against it.
+type Lease struct {
+	Name string
+	Term int64
+
+	value string
+	rdb   redis.UniversalClient
+}
+
+// Held reports whether the lease is still the current one. Leaders should
+// check it before each change they make, since a pause (GC, network) can
+// outlast the lease without the leader noticing. This only narrows the
+// window: a leader can still be replaced between the check and the write, so
+// the work done under a lease must tolerate being done twice.
+func (l *Lease) Held(ctx context.Context) bool {
+	value, err := l.rdb.Get(ctx, lockKey(l.Name)).Result()
+	return err == nil && value == l.value
+}
+
+type leaseKey struct{}
+
+// FromContext returns the lease a function run by an Elector holds.
+func FromContext(ctx context.Context) (*Lease, bool) {
+	lease, ok := ctx.Value(leaseKey{}).(*Lease)
+	return lease, ok
+}
+
+// Holds reports whether ctx may still act as leader: either it is not run
+// under an Elector at all, or its lease is still held.
+func Holds(ctx context.Context) bool {
+	lease, ok := FromContext(ctx)
+	return !ok || lease.Held(ctx)
+}
+
+// Elector runs a function on one process at a time. The leader keeps a
+// Redis lock alive by renewing it every third of its TTL; if it cannot, the
+// function's context is cancelled and another process takes over once the
+// lock expires.
+type Elector struct {
+	rdb     redis.UniversalClient
+	name    string
+	id      string
+	ttl     time.Duration
+	metrics *monitoring.Metrics
+	logger  *zap.Logger
+}
+
+// NewElector elects among processes that use the same name; id identifies
+// this process.
+func NewElector(rdb redis.UniversalClient, name, id string, ttl time.Duration, metrics *monitoring.Metrics, logger *zap.Logger) *Elector {
+	return &Elector{
+		rdb:     rdb,
+		name:    name,
+		id:      id,
+		ttl:     ttl,
+		metrics: metrics,
+		logger:  logger.With(zap.String("component", "leader"), zap.String("election", name)),
+	}
+}
+
+// Run campaigns until ctx is done, calling fn whenever this process becomes
+// leader. fn must return when its context is cancelled.
+func (e *Elector) Run(ctx context.Context, fn func(ctx context.Context)) {
+	e.setLeader(false)
+	for {
+		lease, err := e.acquire(ctx)
+		if err != nil && ctx.Err() == nil {
+			e.logger.Error("failed to campaign for leadership", zap.Error(err))
+		}
+		if lease != nil {
+			e.lead(ctx, lease, fn)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(e.ttl / 3):
+		}
+	}
+}
+
+func (e *Elector) acquire(ctx context.Context) (*Lease, error) {
+	term, err := acquireScript.Run(ctx, e.rdb,
+		[]string{lockKey(e.name), termKey(e.name)},
+		e.id, e.ttl.Milliseconds(),
+	).Int64()
+	if err != nil || term == 0 {
+		return nil, err
+	}
+	return &Lease{
+		Name:  e.name,
+		Term:  term,
+		value: fmt.Sprintf("%s:%d", e.id, term),
+		rdb:   e.rdb,
+	}, nil
+}
+
+// lead runs fn while renewing the lease, and stops it as soon as the lease
+// may have been lost.
+func (e *Elector) lead(ctx context.Context, lease *Lease, fn func(ctx context.Context)) {
+	logger := e.logger.With(zap.Int64("term", lease.Term))
+	logger.Info("became leader")
+	e.setLeader(true)
+	defer e.setLeader(false)
+
+	leaderCtx, cancel := context.WithCancel(context.WithValue(ctx, leaseKey{}, lease))
+	defer cancel()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		fn(leaderCtx)
+	}()
+
+	ticker := time.NewTicker(e.ttl / 3)
+	defer ticker.Stop()
+	renewed := time.Now()
+	for {
+		select {
+		case <-ctx.Done():
+			cancel()
+			<-done
+			e.release(lease)
+			logger.Info("stepped down")
+			return
+		case <-done:
+			e.release(lease)
+			return
+		case <-ticker.C:
+			err := e.renew(ctx, lease)
+			if err == nil {
+				renewed = time.Now()
+				continue
+			}
+			// A failed renewal is retried until the lease would have
+			// expired anyway; losing the lock outright ends it at once.
+			if errors.Is(err, errLost) || time.Since(renewed) >= e.ttl {
+				logger.Warn("lost leadership", zap.Error(err))
+				cancel()
+				<-done
+				return
+			}
+			logger.Error("failed to renew leadership", zap.Error(err))
+		}
+	}
+}
+
+var errLost = errors.New("lease is held by another process")
+
+func (e *Elector) renew(ctx context.Context, lease *Lease) error {
+	ok, err := renewScript.Run(ctx, e.rdb, []string{lockKey(e.name)}, lease.value, e.ttl.Milliseconds()).Int64()
+	if err != nil {
+		return err
+	}
+	if ok == 0 {
+		return errLost
+	}
+	return nil
+}
+
+// release gives up the lock early so that another process need not wait for
+// it to expire.
+func (e *Elector) release(lease *Lease) {
+	if err := releaseScript.Run(context.Background(), e.rdb, []string{lockKey(e.name)}, lease.value).Err(); err != nil {
+		e.logger.Error("failed to release leadership", zap.Error(err))
+	}
+}
+
+func (e *Elector) setLeader(leading bool) {
+	v := 0.0
+	if leading {
+		v = 1
+	}
+	e.metrics.Leader.WithLabelValues(e.name, e.id).Set(v)
+}
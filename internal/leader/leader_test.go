@@ -0,0 +1,54 @@
+package leader
+
+import (
+	"context"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"jobqueue/internal/monitoring"
+)
+
+func TestSingleLeader(t *testing.T) {
+	redisURL := os.Getenv("REDIS_URL")
+	if redisURL == "" {
+		t.Skip("REDIS_URL environment variable not set, skipping test")
+	}
+	opts, err := redis.ParseURL(redisURL)
+	require.NoError(t, err)
+	rdb := redis.NewClient(opts)
+	defer rdb.Close()
+
+	name := "test-" + time.Now().Format("150405.000000")
+	defer rdb.Del(context.Background(), lockKey(name), termKey(name))
+	metrics := monitoring.NewMetrics()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	var leaders, maxLeaders int32
+	run := func(ctx context.Context) {
+		n := atomic.AddInt32(&leaders, 1)
+		if n > atomic.LoadInt32(&maxLeaders) {
+			atomic.StoreInt32(&maxLeaders, n)
+		}
+		lease, ok := FromContext(ctx)
+		assert.True(t, ok)
+		assert.True(t, lease.Held(ctx))
+		<-ctx.Done()
+		atomic.AddInt32(&leaders, -1)
+	}
+	for _, id := range []string{"a", "b", "c"} {
+		go NewElector(rdb, name, id, time.Second, metrics, zap.NewNop()).Run(ctx, run)
+	}
+
+	time.Sleep(500 * time.Millisecond)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&leaders))
+	<-ctx.Done()
+	assert.Equal(t, int32(1), atomic.LoadInt32(&maxLeaders))
+}
@@ -2,9 +2,12 @@ package middleware
 
 import (
 	"context"
+	"errors"
 	"net/http"
 	"strings"
+	"time"
 
+	"jobqueue/internal/auth"
 	"jobqueue/internal/models"
 
 	"gorm.io/gorm"
@@ -12,27 +15,149 @@ import (
 
 type ctxKey string
 
-const userCtxKey = ctxKey("user")
+const (
+	userCtxKey    = ctxKey("user")
+	apiKeyCtxKey  = ctxKey("api_key")
+	sessionCtxKey = ctxKey("session")
+	scopesCtxKey  = ctxKey("scopes")
+)
+
+// lastUsedResolution is how stale an API key's LastUsedAt may get before a
+// request refreshes it, so that busy keys do not cost a write per request.
+const lastUsedResolution = time.Minute
+
+var errUnauthorized = errors.New("unauthorized")
 
-func (m *Middleware) APIKeyAuth(next http.Handler) http.Handler {
+// Authenticate accepts either an access token issued at login or an API key
+// as the bearer credential, and stores the user and what the credential
+// allows in the request context. Sessions get every scope.
+func (m *Middleware) Authenticate(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		auth := r.Header.Get("Authorization")
-		apiKey := strings.TrimPrefix(auth, "Bearer ")
-		var user models.User
-		if err := m.DB.Where("api_key = ?", apiKey).First(&user).Error; err != nil {
-			if err == gorm.ErrRecordNotFound {
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if token == "" {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		var ctx context.Context
+		var err error
+		if auth.IsJWT(token) {
+			ctx, err = m.sessionAuth(r.Context(), token)
+		} else {
+			ctx, err = m.apiKeyAuth(r.Context(), token)
+		}
+		if err != nil {
+			if err == errUnauthorized || err == gorm.ErrRecordNotFound {
 				http.Error(w, "Unauthorized", http.StatusUnauthorized)
 				return
 			}
 			http.Error(w, "Server error", http.StatusInternalServerError)
 			return
 		}
-		ctx := context.WithValue(r.Context(), userCtxKey, user)
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
 
+// sessionAuth verifies an access token and checks that its session has not
+// been revoked by a logout.
+func (m *Middleware) sessionAuth(ctx context.Context, token string) (context.Context, error) {
+	claims, err := m.Tokens.Verify(token, time.Now())
+	if err != nil {
+		return nil, errUnauthorized
+	}
+	var user models.User
+	err = m.DB.Joins("JOIN sessions ON sessions.user_id = users.id").
+		Where("sessions.id = ? AND users.id = ? AND sessions.revoked_at IS NULL", claims.SessionID, claims.Subject).
+		First(&user).Error
+	if err != nil {
+		return nil, err
+	}
+	ctx = context.WithValue(ctx, userCtxKey, user)
+	ctx = context.WithValue(ctx, sessionCtxKey, claims.SessionID)
+	return context.WithValue(ctx, scopesCtxKey, auth.AllScopes), nil
+}
+
+func (m *Middleware) apiKeyAuth(ctx context.Context, apiKey string) (context.Context, error) {
+	now := time.Now()
+	var key models.APIKey
+	if err := m.DB.Where("hash = ?", auth.HashToken(apiKey)).First(&key).Error; err != nil {
+		return nil, err
+	}
+	if !key.Active(now) {
+		return nil, errUnauthorized
+	}
+	var user models.User
+	if err := m.DB.First(&user, "id = ?", key.UserID).Error; err != nil {
+		return nil, err
+	}
+
+	// Best effort: a failed update only makes LastUsedAt lag.
+	m.DB.Model(&models.APIKey{}).
+		Where("id = ? AND (last_used_at IS NULL OR last_used_at < ?)", key.ID, now.Add(-lastUsedResolution)).
+		Update("last_used_at", now)
+
+	ctx = context.WithValue(ctx, userCtxKey, user)
+	ctx = context.WithValue(ctx, apiKeyCtxKey, key)
+	return context.WithValue(ctx, scopesCtxKey, key.Scopes), nil
+}
+
+// GetAPIKey returns the API key the request was authenticated with, if any.
+func GetAPIKey(r *http.Request) (models.APIKey, bool) {
+	key, ok := r.Context().Value(apiKeyCtxKey).(models.APIKey)
+	return key, ok
+}
+
+// GetSession returns the ID of the login session the request was
+// authenticated with, if any.
+func GetSession(r *http.Request) (string, bool) {
+	id, ok := r.Context().Value(sessionCtxKey).(string)
+	return id, ok
+}
+
+// GetScopes returns the scopes of the request's credential: those of its API
+// key, or all of them for a login session.
+func GetScopes(r *http.Request) ([]string, bool) {
+	scopes, ok := r.Context().Value(scopesCtxKey).([]string)
+	return scopes, ok
+}
+
+// RequireScope rejects requests whose credential lacks scope. It must run
+// after Authenticate.
+func (m *Middleware) RequireScope(scope string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			scopes, ok := GetScopes(r)
+			if !ok {
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+			if !auth.HasScope(scopes, scope) {
+				http.Error(w, "Forbidden: API key lacks the "+scope+" scope", http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
 func GetUser(r *http.Request) (models.User, bool) {
 	user, ok := r.Context().Value(userCtxKey).(models.User)
 	return user, ok
 }
+
+// RequireAdmin rejects requests from users without the admin flag. It must run
+// after Authenticate.
+func (m *Middleware) RequireAdmin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, ok := GetUser(r)
+		if !ok {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if !user.IsAdmin {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
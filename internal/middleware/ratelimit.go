@@ -2,27 +2,26 @@ package middleware
 
 import (
 	"net/http"
-	"time"
 
-	"github.com/patrickmn/go-cache"
+	"github.com/go-chi/chi/v5"
+	"go.uber.org/zap"
 	"gorm.io/gorm"
-	"golang.org/x/time/rate"
+	"jobqueue/internal/auth"
+	"jobqueue/internal/throttle"
 )
 
 type Middleware struct {
-	DB    *gorm.DB
-	Cache *cache.Cache
-}
-
-func (m *Middleware) getLimiter(apiKey string) *rate.Limiter {
-	limiter, found := m.Cache.Get(apiKey)
-	if !found {
-		limiter = rate.NewLimiter(5, 10) // 5 req/sec, burst 10
-		m.Cache.Set(apiKey, limiter, 1*time.Hour)
-	}
-	return limiter.(*rate.Limiter)
+	DB           *gorm.DB
+	Limiter      *throttle.APILimiter
+	Tokens       *auth.KeySet      // signs and verifies access tokens
+	WorkerTokens map[string]string // remote worker name -> token
+	Logger       *zap.Logger
 }
 
+// RateLimit applies the caller's limit and the route's limit across all
+// replicas. Project limits are left to the handlers, which apply them once
+// membership has been checked. It must run after Authenticate. If Redis is unavailable requests are let through
+// rather than failing the whole API.
 func (m *Middleware) RateLimit(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		user, ok := GetUser(r)
@@ -30,8 +29,22 @@ func (m *Middleware) RateLimit(next http.Handler) http.Handler {
 			http.Error(w, "Unauthorized", http.StatusUnauthorized)
 			return
 		}
-		limiter := m.getLimiter(user.APIKey)
-		if !limiter.Allow() {
+
+		limits := m.Limiter.Limits()
+		checks := []throttle.Check{{Key: "user:" + user.ID, Limit: limits.ForUser(user)}}
+		pattern := chi.RouteContext(r.Context()).RoutePattern()
+		if limit, ok := limits.ForRoute(r.Method, pattern); ok {
+			checks = append(checks, throttle.Check{Key: "user:" + user.ID + ":route:" + r.Method + " " + pattern, Limit: limit})
+		}
+
+		decision, err := m.Limiter.AllowAll(r.Context(), checks, 1)
+		if err != nil {
+			m.Logger.Error("failed to check rate limit", zap.Error(err), zap.String("user_id", user.ID))
+			next.ServeHTTP(w, r)
+			return
+		}
+		decision.WriteHeaders(w.Header())
+		if !decision.Allowed {
 			http.Error(w, "Too Many Requests", http.StatusTooManyRequests)
 			return
 		}
@@ -0,0 +1,32 @@
+package middleware
+
+import (
+	"context"
+	"crypto/subtle"
+	"net/http"
+	"strings"
+)
+
+const workerCtxKey = ctxKey("worker")
+
+// WorkerAuth authenticates remote workers by their shared token and stores
+// the worker's name in the request context.
+func (m *Middleware) WorkerAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		for name, expected := range m.WorkerTokens {
+			if subtle.ConstantTimeCompare([]byte(token), []byte(expected)) == 1 {
+				ctx := context.WithValue(r.Context(), workerCtxKey, name)
+				next.ServeHTTP(w, r.WithContext(ctx))
+				return
+			}
+		}
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+	})
+}
+
+// GetWorker returns the name of the remote worker making the request.
+func GetWorker(r *http.Request) (string, bool) {
+	name, ok := r.Context().Value(workerCtxKey).(string)
+	return name, ok
+}
@@ -14,29 +14,144 @@ type User struct {
     ID        string    `gorm:"primaryKey;type:uuid;default:gen_random_uuid()"`
     Email     string    `gorm:"unique;not null"`
     Password  string    `gorm:"not null"`
-    APIKey    string    `gorm:"unique;not null"`
+    IsAdmin   bool      `gorm:"not null;default:false"`
+    Plan      string    `gorm:"not null;default:'free'"` // selects API rate limits
     CreatedAt time.Time
-    Projects  []Project
+    Memberships []ProjectMember
+    APIKeys     []APIKey
+    Sessions    []Session
+}
+
+// Session is a login. Its access tokens are short-lived JWTs; its refresh
+// token, stored hashed, obtains new ones until the session expires or is
+// revoked by a logout. Each refresh replaces the refresh token.
+type Session struct {
+    ID          string    `gorm:"primaryKey;type:uuid;default:gen_random_uuid()"`
+    UserID      string    `gorm:"type:uuid;not null;index"`
+    RefreshHash string    `gorm:"not null;uniqueIndex" json:"-"`
+    UserAgent   string
+    ExpiresAt   time.Time
+    RevokedAt   *time.Time
+    CreatedAt   time.Time
+    UpdatedAt   time.Time
+}
+
+// APIKey authenticates requests on behalf of a user. Only a hash of the key
+// is stored; Prefix is what identifies it to the user afterwards. A key with
+// a ProjectID can only be used for that project.
+type APIKey struct {
+    ID         string     `gorm:"primaryKey;type:uuid;default:gen_random_uuid()"`
+    UserID     string     `gorm:"type:uuid;not null;index"`
+    ProjectID  *string    `gorm:"type:uuid;index"`
+    Name       string     `gorm:"not null"`
+    Prefix     string     `gorm:"not null"`
+    Hash       string     `gorm:"not null;uniqueIndex" json:"-"`
+    Scopes     []string   `gorm:"serializer:json;type:jsonb;not null"`
+    ExpiresAt  *time.Time
+    LastUsedAt *time.Time
+    RevokedAt  *time.Time
+    CreatedAt  time.Time
+}
+
+// Active reports whether the key can still be used at now.
+func (k APIKey) Active(now time.Time) bool {
+    return k.RevokedAt == nil && (k.ExpiresAt == nil || now.Before(*k.ExpiresAt))
 }
 
 type Project struct {
     ID        string    `gorm:"primaryKey;type:uuid;default:gen_random_uuid()"`
     Name      string    `gorm:"not null"`
-    UserID    string    `gorm:"type:uuid;not null"`
     CreatedAt time.Time
+    UpdatedAt time.Time
+    Members   []ProjectMember
     Jobs      []Job
 }
 
+// Project roles, from least to most privileged. Each role can do everything
+// the ones before it can.
+const (
+    RoleViewer = "viewer" // read jobs
+    RoleMember = "member" // submit jobs
+    RoleAdmin  = "admin"  // rename the project, manage members and invitations
+    RoleOwner  = "owner"  // delete the project, manage admins and owners
+)
+
+var roleRank = map[string]int{RoleViewer: 1, RoleMember: 2, RoleAdmin: 3, RoleOwner: 4}
+
+// ValidRole reports whether role is one of the project roles.
+func ValidRole(role string) bool {
+    return roleRank[role] > 0
+}
+
+// RoleAllows reports whether role grants at least the rights of required.
+func RoleAllows(role, required string) bool {
+    return ValidRole(role) && roleRank[role] >= roleRank[required]
+}
+
+// ProjectMember gives a user a role in a project.
+type ProjectMember struct {
+    ProjectID string    `gorm:"primaryKey;type:uuid"`
+    UserID    string    `gorm:"primaryKey;type:uuid;index"`
+    Role      string    `gorm:"not null"`
+    CreatedAt time.Time
+    UpdatedAt time.Time
+}
+
+// ProjectInvitation offers a role in a project to the user with Email who
+// presents the invitation's token, until it is accepted or expires. Only the
+// token's hash is stored.
+type ProjectInvitation struct {
+    ID         string     `gorm:"primaryKey;type:uuid;default:gen_random_uuid()"`
+    ProjectID  string     `gorm:"type:uuid;not null;index"`
+    Email      string     `gorm:"not null;index"`
+    Role       string     `gorm:"not null"`
+    TokenHash  string     `json:"-"`
+    InvitedBy  string     `gorm:"type:uuid;not null"`
+    ExpiresAt  time.Time
+    AcceptedAt *time.Time
+    CreatedAt  time.Time
+}
+
 type Job struct {
-    ID         string    `gorm:"primaryKey;type:uuid;default:gen_random_uuid()"`
-    Type       string    `gorm:"not null"`
+    ID         string    `gorm:"primaryKey;type:uuid;default:gen_random_uuid();index:idx_jobs_project_created,priority:3;index:idx_jobs_project_updated,priority:3"`
+    Type       string    `gorm:"not null;index:idx_jobs_project_type_created,priority:2"`
     Payload    string    `gorm:"type:jsonb;not null"`
-    Status     string    `gorm:"not null;default:'queued'"`
+    Status     string    `gorm:"not null;default:'queued';index:idx_jobs_project_status,priority:2;index:idx_jobs_project_status_created,priority:2"`
     ExecuteAt  time.Time `gorm:"index"`
     Duration   int64     // in milliseconds
-    ProjectID  string    `gorm:"type:uuid;not null"`
+    ProjectID  string    `gorm:"type:uuid;not null;index:idx_jobs_project_status,priority:1;index:idx_jobs_project_status_created,priority:1;index:idx_jobs_project_type_created,priority:1;index:idx_jobs_project_created,priority:1;index:idx_jobs_project_updated,priority:1;index:idx_jobs_project_workflow,priority:1"`
+    BatchID    *string   `gorm:"type:uuid;index"` // shared by the jobs of one bulk submit
+    WorkflowID *string   `gorm:"index:idx_jobs_project_workflow,priority:2"` // set by the caller to group related jobs
     MaxRetries int       `gorm:"not null;default:3"`
     RetryCount int       `gorm:"not null;default:0"`
-    CreatedAt  time.Time
+    Result     string    `gorm:"type:text"` // output reported by the processor, if any
+    LastError  string    `gorm:"type:text"`
+    WorkerID   string    `gorm:"index"` // worker that last claimed the job, see workers.WorkerName
+    CreatedAt  time.Time `gorm:"index:idx_jobs_project_created,priority:2;index:idx_jobs_project_status_created,priority:3;index:idx_jobs_project_type_created,priority:3"`
+    UpdatedAt  time.Time `gorm:"index:idx_jobs_project_updated,priority:2"`
+}
+
+// JobAttempt records one run of a job, successful or not.
+type JobAttempt struct {
+    ID         string    `gorm:"primaryKey;type:uuid;default:gen_random_uuid()"`
+    JobID      string    `gorm:"type:uuid;not null;index"`
+    Attempt    int       `gorm:"not null"`
+    Status     string    `gorm:"not null"` // completed, failed or aborted
+    Error      string    `gorm:"type:text"`
+    Stack      string    `gorm:"type:text"` // set when the processor panicked
+    Duration   int64     // in milliseconds
+    StartedAt  time.Time
+    FinishedAt time.Time
+}
+
+// DailyUsage is what a project used of one job type on one day (UTC).
+type DailyUsage struct {
+    ProjectID  string    `gorm:"primaryKey;type:uuid"`
+    Day        time.Time `gorm:"primaryKey;type:date"`
+    JobType    string    `gorm:"primaryKey"`
+    Submitted  int64     `gorm:"not null;default:0"`
+    Executed   int64     `gorm:"not null;default:0"` // finished runs, successful or not
+    Failed     int64     `gorm:"not null;default:0"` // failed runs
+    DurationMs int64     `gorm:"not null;default:0"` // total run time
     UpdatedAt  time.Time
 }
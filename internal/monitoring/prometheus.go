@@ -10,9 +10,16 @@ type Metrics struct {
 	JobsProcessedTotal  *prometheus.CounterVec
 	JobFailuresTotal    *prometheus.CounterVec
 	JobsReapedTotal     *prometheus.CounterVec
+	JobPanicsTotal      *prometheus.CounterVec
+	JobsThrottledTotal  *prometheus.CounterVec
+	BacklogRejections   *prometheus.CounterVec
+	BacklogWarnings     *prometheus.CounterVec
 	JobDurationSeconds  *prometheus.HistogramVec
+	TaskDurationSeconds *prometheus.HistogramVec
 	ActiveWorkers       *prometheus.GaugeVec
 	QueueLength         *prometheus.GaugeVec
+	DesiredWorkers      *prometheus.GaugeVec
+	Leader              *prometheus.GaugeVec
 }
 
 // NewMetrics creates and registers the Prometheus metrics.
@@ -42,6 +49,38 @@ func NewMetrics() *Metrics {
 			},
 			[]string{"queue"},
 		),
+		JobPanicsTotal: promauto.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: "jobqueue",
+				Name:      "job_panics_total",
+				Help:      "Total number of job runs that ended in a processor panic.",
+			},
+			[]string{"queue", "type"},
+		),
+		JobsThrottledTotal: promauto.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: "jobqueue",
+				Name:      "jobs_throttled_total",
+				Help:      "Total number of jobs deferred because a limit was reached, partitioned by reason.",
+			},
+			[]string{"queue", "type", "reason"}, // reason can be "concurrency", "rate_limit", "paused"
+		),
+		BacklogRejections: promauto.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: "jobqueue",
+				Name:      "backlog_rejections_total",
+				Help:      "Total number of submits rejected because a backlog was at its hard limit.",
+			},
+			[]string{"scope", "queue"}, // scope can be "queue", "project"
+		),
+		BacklogWarnings: promauto.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: "jobqueue",
+				Name:      "backlog_soft_limit_exceeded_total",
+				Help:      "Total number of submits accepted while a backlog was above its soft watermark.",
+			},
+			[]string{"scope", "queue"},
+		),
 		JobDurationSeconds: promauto.NewHistogramVec(
 			prometheus.HistogramOpts{
 				Namespace: "jobqueue",
@@ -51,6 +90,15 @@ func NewMetrics() *Metrics {
 			},
 			[]string{"queue", "type"},
 		),
+		TaskDurationSeconds: promauto.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Namespace: "jobqueue",
+				Name:      "task_duration_seconds",
+				Help:      "Histogram of time spent inside task processors.",
+				Buckets:   prometheus.DefBuckets,
+			},
+			[]string{"type", "outcome"}, // outcome can be "success", "error"
+		),
 		ActiveWorkers: promauto.NewGaugeVec(
 			prometheus.GaugeOpts{
 				Namespace: "jobqueue",
@@ -67,6 +115,22 @@ func NewMetrics() *Metrics {
 			},
 			[]string{"queue"},
 		),
+		DesiredWorkers: promauto.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace: "jobqueue",
+				Name:      "autoscaler_desired_workers",
+				Help:      "Pool size the autoscaler last decided on, including in dry-run mode.",
+			},
+			[]string{"queue"},
+		),
+		Leader: promauto.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace: "jobqueue",
+				Name:      "leader",
+				Help:      "1 if this process is the leader of the election, 0 otherwise.",
+			},
+			[]string{"election", "instance"},
+		),
 	}
 	return m
 }
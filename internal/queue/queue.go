@@ -0,0 +1,178 @@
+package queue
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// Key returns the Redis list backing the named queue. The name is wrapped in a
+// hash tag so that the list, its processing list and its scheduled set always
+// live in the same Redis Cluster slot and can be used together in one script
+// or MULTI block.
+func Key(name string) string {
+	return "{" + name + "}"
+}
+
+// ProcessingKey returns the list holding job IDs that have been taken off the
+// named queue by a worker and not yet acknowledged.
+func ProcessingKey(name string) string {
+	return Key(name) + ":processing"
+}
+
+// Push adds job IDs to the head of the named queue.
+func Push(ctx context.Context, rdb redis.UniversalClient, name string, jobIDs ...string) error {
+	values := make([]interface{}, len(jobIDs))
+	for i, id := range jobIDs {
+		values[i] = id
+	}
+	return rdb.LPush(ctx, Key(name), values...).Err()
+}
+
+// PushAll adds job IDs to several queues, keyed by queue name, in one
+// pipeline.
+func PushAll(ctx context.Context, rdb redis.UniversalClient, jobIDs map[string][]string) error {
+	_, err := rdb.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for name, ids := range jobIDs {
+			values := make([]interface{}, len(ids))
+			for i, id := range ids {
+				values[i] = id
+			}
+			pipe.LPush(ctx, Key(name), values...)
+		}
+		return nil
+	})
+	return err
+}
+
+// Pop blocks for up to timeout waiting for a job on the named queue and moves
+// it onto the processing list, so it is not lost if the worker dies before the
+// job's state is recorded. It returns redis.Nil on timeout.
+func Pop(ctx context.Context, rdb redis.UniversalClient, name string, timeout time.Duration) (string, error) {
+	return rdb.BRPopLPush(ctx, Key(name), ProcessingKey(name), timeout).Result()
+}
+
+// TryPop is Pop without blocking. It returns redis.Nil if the queue is empty.
+func TryPop(ctx context.Context, rdb redis.UniversalClient, name string) (string, error) {
+	return rdb.RPopLPush(ctx, Key(name), ProcessingKey(name)).Result()
+}
+
+// AckedKey returns the counter of jobs acknowledged on the named queue, which
+// lets the autoscaler measure throughput across all replicas.
+func AckedKey(name string) string {
+	return Key(name) + ":acked"
+}
+
+// Ack removes a job from the processing list once the worker is done with it.
+func Ack(ctx context.Context, rdb redis.UniversalClient, name, jobID string) error {
+	_, err := rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.LRem(ctx, ProcessingKey(name), 1, jobID)
+		pipe.Incr(ctx, AckedKey(name))
+		return nil
+	})
+	return err
+}
+
+// Requeue atomically moves a job from the processing list back onto the queue.
+func Requeue(ctx context.Context, rdb redis.UniversalClient, name, jobID string) error {
+	_, err := rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.LRem(ctx, ProcessingKey(name), 1, jobID)
+		pipe.LPush(ctx, Key(name), jobID)
+		return nil
+	})
+	return err
+}
+
+// Len returns the number of jobs waiting on the named queue.
+func Len(ctx context.Context, rdb redis.UniversalClient, name string) (int64, error) {
+	return rdb.LLen(ctx, Key(name)).Result()
+}
+
+// InFlight returns the job IDs currently on the named queue's processing list.
+func InFlight(ctx context.Context, rdb redis.UniversalClient, name string) ([]string, error) {
+	return rdb.LRange(ctx, ProcessingKey(name), 0, -1).Result()
+}
+
+// Stats is a snapshot of a queue's size and throughput counter.
+type Stats struct {
+	Length   int64 // jobs waiting
+	InFlight int64 // jobs taken by a worker and not yet acknowledged
+	Acked    int64 // jobs acknowledged since the counter was created
+}
+
+// ReadStats reads the named queue's Stats in one round trip.
+func ReadStats(ctx context.Context, rdb redis.UniversalClient, name string) (Stats, error) {
+	var length, inFlight *redis.IntCmd
+	var acked *redis.StringCmd
+	_, err := rdb.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		length = pipe.LLen(ctx, Key(name))
+		inFlight = pipe.LLen(ctx, ProcessingKey(name))
+		acked = pipe.Get(ctx, AckedKey(name))
+		return nil
+	})
+	if err != nil && err != redis.Nil {
+		return Stats{}, err
+	}
+	stats := Stats{Length: length.Val(), InFlight: inFlight.Val()}
+	if acked.Err() == nil {
+		stats.Acked, _ = acked.Int64()
+	}
+	return stats, nil
+}
+
+// Oldest returns the ID of the job that has waited longest on the named
+// queue. It returns redis.Nil if the queue is empty.
+func Oldest(ctx context.Context, rdb redis.UniversalClient, name string) (string, error) {
+	return rdb.LIndex(ctx, Key(name), -1).Result()
+}
+
+// MigrateLegacy moves the named queue's jobs from the keys used before queue
+// keys were hash-tagged, the bare name and "<name>:scheduled", onto Key and
+// ScheduledKey, and returns how many it moved. Waiting jobs are taken before
+// any already on the new list. The old and new keys may live in different
+// cluster slots, so the move is not atomic: a crash midway, or two processes
+// migrating at once, can leave a job on both lists, and workers skip the
+// second copy once the job has run.
+func MigrateLegacy(ctx context.Context, rdb redis.UniversalClient, name string) (int64, error) {
+	ids, err := rdb.LRange(ctx, name, 0, -1).Result()
+	if err != nil {
+		return 0, err
+	}
+	if len(ids) > 0 {
+		values := make([]interface{}, len(ids))
+		for i, id := range ids {
+			values[i] = id
+		}
+		// Workers pop from the tail, so the old jobs go behind the new ones
+		// in the order they were waiting.
+		if err := rdb.RPush(ctx, Key(name), values...).Err(); err != nil {
+			return 0, err
+		}
+		// Trim only what was copied, from the tail, in case an older
+		// process pushed more onto the head meanwhile.
+		if err := rdb.LTrim(ctx, name, 0, -int64(len(ids))-1).Err(); err != nil {
+			return 0, err
+		}
+	}
+
+	moved := int64(len(ids))
+	legacyScheduled := name + ":scheduled"
+	scheduled, err := rdb.ZRangeWithScores(ctx, legacyScheduled, 0, -1).Result()
+	if err != nil || len(scheduled) == 0 {
+		return moved, err
+	}
+	members := make([]*redis.Z, len(scheduled))
+	jobIDs := make([]interface{}, len(scheduled))
+	for i := range scheduled {
+		members[i] = &scheduled[i]
+		jobIDs[i] = scheduled[i].Member
+	}
+	if err := rdb.ZAdd(ctx, ScheduledKey(name), members...).Err(); err != nil {
+		return moved, err
+	}
+	if err := rdb.ZRem(ctx, legacyScheduled, jobIDs...).Err(); err != nil {
+		return moved, err
+	}
+	return moved + int64(len(scheduled)), nil
+}
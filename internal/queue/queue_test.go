@@ -0,0 +1,52 @@
+package queue
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMigrateLegacy(t *testing.T) {
+	redisURL := os.Getenv("REDIS_URL")
+	if redisURL == "" {
+		t.Skip("REDIS_URL environment variable not set, skipping test")
+	}
+	opts, err := redis.ParseURL(redisURL)
+	require.NoError(t, err)
+	rdb := redis.NewClient(opts)
+	defer rdb.Close()
+
+	ctx := context.Background()
+	name := "test:queue:" + time.Now().Format("150405.000000")
+	defer rdb.Del(ctx, name, name+":scheduled", Key(name), ProcessingKey(name), ScheduledKey(name))
+
+	require.NoError(t, rdb.LPush(ctx, name, "old-1", "old-2").Err())
+	require.NoError(t, rdb.ZAdd(ctx, name+":scheduled", &redis.Z{Score: 1, Member: "later"}).Err())
+	require.NoError(t, Push(ctx, rdb, name, "new-1"))
+
+	n, err := MigrateLegacy(ctx, rdb, name)
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), n)
+
+	var popped []string
+	for {
+		id, err := TryPop(ctx, rdb, name)
+		if err == redis.Nil {
+			break
+		}
+		require.NoError(t, err)
+		popped = append(popped, id)
+	}
+	assert.Equal(t, []string{"old-1", "old-2", "new-1"}, popped)
+	assert.Equal(t, int64(0), rdb.Exists(ctx, name, name+":scheduled").Val())
+	assert.Equal(t, float64(1), rdb.ZScore(ctx, ScheduledKey(name), "later").Val())
+
+	n, err = MigrateLegacy(ctx, rdb, name)
+	require.NoError(t, err)
+	assert.Zero(t, n)
+}
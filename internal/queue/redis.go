@@ -9,14 +9,40 @@ import (
 
 var Ctx = context.Background()
 
-func NewRedisClient(cfg *config.Config) (*redis.Client, error) {
-	opts, err := redis.ParseURL(cfg.RedisURL)
+// NewRedisClient connects to Redis as configured. A sentinel master name
+// yields a failover client, several addresses (or REDIS_CLUSTER) a cluster
+// client, and otherwise a single-node client built from REDIS_URL.
+func NewRedisClient(cfg *config.Config) (redis.UniversalClient, error) {
+	client, err := newUniversalClient(cfg)
 	if err != nil {
 		return nil, err
 	}
-	client := redis.NewClient(opts)
 	if err := client.Ping(Ctx).Err(); err != nil {
+		client.Close()
 		return nil, err
 	}
 	return client, nil
-}
\ No newline at end of file
+}
+
+func newUniversalClient(cfg *config.Config) (redis.UniversalClient, error) {
+	if len(cfg.RedisAddrs) == 0 {
+		opts, err := redis.ParseURL(cfg.RedisURL)
+		if err != nil {
+			return nil, err
+		}
+		return redis.NewClient(opts), nil
+	}
+
+	opts := &redis.UniversalOptions{
+		Addrs:            cfg.RedisAddrs,
+		MasterName:       cfg.RedisMasterName,
+		Username:         cfg.RedisUsername,
+		Password:         cfg.RedisPassword,
+		SentinelPassword: cfg.RedisSentinelPassword,
+		DB:               cfg.RedisDB,
+	}
+	if cfg.RedisCluster && opts.MasterName == "" {
+		return redis.NewClusterClient(opts.Cluster()), nil
+	}
+	return redis.NewUniversalClient(opts), nil
+}
@@ -0,0 +1,48 @@
+package queue
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// ScheduledKey returns the sorted set holding job IDs that are waiting to be
+// (re-)enqueued onto queueName. Scores are unix milliseconds.
+func ScheduledKey(queueName string) string {
+	return Key(queueName) + ":scheduled"
+}
+
+// Schedule arranges for jobID to be pushed onto queueName at the given time.
+func Schedule(ctx context.Context, rdb redis.UniversalClient, queueName, jobID string, at time.Time) error {
+	return rdb.ZAdd(ctx, ScheduledKey(queueName), &redis.Z{
+		Score:  float64(at.UnixMilli()),
+		Member: jobID,
+	}).Err()
+}
+
+// promoteScript atomically moves up to ARGV[2] due members of the scheduled
+// set KEYS[1] onto the queue KEYS[2], so two replicas never promote the same
+// job twice.
+var promoteScript = redis.NewScript(`
+local due = redis.call('ZRANGEBYSCORE', KEYS[1], '-inf', ARGV[1], 'LIMIT', 0, tonumber(ARGV[2]))
+for _, id in ipairs(due) do
+	redis.call('ZREM', KEYS[1], id)
+	redis.call('LPUSH', KEYS[2], id)
+end
+return #due
+`)
+
+// PromoteDue moves at most limit jobs whose time has come from the scheduled
+// set back onto queueName and reports how many were moved.
+func PromoteDue(ctx context.Context, rdb redis.UniversalClient, queueName string, now time.Time, limit int) (int, error) {
+	n, err := promoteScript.Run(ctx, rdb,
+		[]string{ScheduledKey(queueName), Key(queueName)},
+		strconv.FormatInt(now.UnixMilli(), 10), limit,
+	).Int()
+	if err != nil {
+		return 0, err
+	}
+	return n, nil
+}
@@ -0,0 +1,322 @@
+// Package search parses the job search language into SQL conditions. Queries
+// are never spliced into SQL: every value is a bind parameter and payload
+// paths are restricted to plain key names.
+//
+// A query is a list of terms, all of which must match:
+//
+//	receipt "order 1234"           free text: words, or a quoted phrase
+//	type:email:send status:failed  job type and status
+//	payload.order.id:1234          payload value at a path (number or string)
+//	payload.customer:"Ada L"       quoted values only match strings
+//	payload.amount:>=100           numeric comparison: >, >=, <, <=
+//	payload.coupon:*               the path exists
+//	-status:completed              a leading "-" negates a term
+//
+// Numeric path segments index arrays (payload.items.0.sku); other segments
+// match through arrays (payload.items.sku matches any item's sku).
+package search
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"gorm.io/gorm"
+)
+
+// MaxLength and MaxTerms bound a query, to keep its SQL reasonable.
+const (
+	MaxLength = 1000
+	MaxTerms  = 20
+)
+
+// Term operators.
+const (
+	OpEq     = "="
+	OpGt     = ">"
+	OpGte    = ">="
+	OpLt     = "<"
+	OpLte    = "<="
+	OpExists = "exists"
+)
+
+// Fields a term can name. A Term with no Field is free text.
+const (
+	FieldType    = "type"
+	FieldStatus  = "status"
+	FieldPayload = "payload"
+)
+
+// Term is one condition of a query.
+type Term struct {
+	Negated bool
+	Field   string
+	Path    []string // for FieldPayload
+	Op      string
+	Value   string
+	Quoted  bool // the value was a quoted string
+}
+
+// Query is a parsed search. Every term must match.
+type Query struct {
+	Terms []Term
+}
+
+var (
+	fieldPattern   = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_.-]*$`)
+	segmentPattern = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+	indexPattern   = regexp.MustCompile(`^[0-9]+$`)
+	numberPattern  = regexp.MustCompile(`^-?(0|[1-9][0-9]*)(\.[0-9]+)?$`)
+)
+
+// Parse parses a search query.
+func Parse(s string) (Query, error) {
+	if len(s) > MaxLength {
+		return Query{}, fmt.Errorf("query is longer than %d characters", MaxLength)
+	}
+	p := parser{input: []rune(s)}
+	var q Query
+	for {
+		p.skipSpace()
+		if p.done() {
+			break
+		}
+		term, err := p.term()
+		if err != nil {
+			return Query{}, err
+		}
+		q.Terms = append(q.Terms, term)
+		if len(q.Terms) > MaxTerms {
+			return Query{}, fmt.Errorf("query has more than %d terms", MaxTerms)
+		}
+	}
+	if len(q.Terms) == 0 {
+		return Query{}, errors.New("query is empty")
+	}
+	return q, nil
+}
+
+type parser struct {
+	input []rune
+	pos   int
+}
+
+func (p *parser) done() bool {
+	return p.pos >= len(p.input)
+}
+
+func (p *parser) skipSpace() {
+	for !p.done() && unicode.IsSpace(p.input[p.pos]) {
+		p.pos++
+	}
+}
+
+// term parses [-](field:[op]value | value).
+func (p *parser) term() (Term, error) {
+	var t Term
+	if p.input[p.pos] == '-' && p.pos+1 < len(p.input) && !unicode.IsSpace(p.input[p.pos+1]) {
+		t.Negated = true
+		p.pos++
+	}
+
+	if p.input[p.pos] == '"' {
+		phrase, err := p.quoted()
+		if err != nil {
+			return Term{}, err
+		}
+		t.Op, t.Value, t.Quoted = OpEq, phrase, true
+		return t, p.endOfTerm()
+	}
+
+	start := p.pos
+	for !p.done() && !unicode.IsSpace(p.input[p.pos]) && p.input[p.pos] != ':' {
+		p.pos++
+	}
+	word := string(p.input[start:p.pos])
+	if p.done() || p.input[p.pos] != ':' {
+		t.Op, t.Value = OpEq, word
+		return t, nil
+	}
+	if !fieldPattern.MatchString(word) {
+		return Term{}, fmt.Errorf("invalid field %q; quote text that contains a colon", word)
+	}
+	p.pos++ // the colon
+
+	if err := t.setField(word); err != nil {
+		return Term{}, err
+	}
+	if err := p.value(&t); err != nil {
+		return Term{}, err
+	}
+	return t, t.validate()
+}
+
+func (t *Term) setField(name string) error {
+	head, rest, _ := strings.Cut(name, ".")
+	switch head {
+	case FieldType, FieldStatus:
+		if rest != "" {
+			return fmt.Errorf("field %q has no sub-fields", head)
+		}
+	case FieldPayload:
+		if rest == "" {
+			return errors.New("payload needs a path, e.g. payload.order.id")
+		}
+		for _, seg := range strings.Split(rest, ".") {
+			if !segmentPattern.MatchString(seg) {
+				return fmt.Errorf("invalid payload path segment %q", seg)
+			}
+			t.Path = append(t.Path, seg)
+		}
+	default:
+		return fmt.Errorf("unknown field %q; quote text that contains a colon", head)
+	}
+	t.Field = head
+	return nil
+}
+
+// value parses the [op]value after a field's colon.
+func (p *parser) value(t *Term) error {
+	t.Op = OpEq
+	for _, op := range []string{OpGte, OpLte, OpGt, OpLt} {
+		if strings.HasPrefix(string(p.input[p.pos:]), op) {
+			t.Op = op
+			p.pos += len(op)
+			break
+		}
+	}
+	if p.done() || unicode.IsSpace(p.input[p.pos]) {
+		return fmt.Errorf("missing value for %s", t.Field)
+	}
+
+	if p.input[p.pos] == '"' {
+		value, err := p.quoted()
+		if err != nil {
+			return err
+		}
+		t.Value, t.Quoted = value, true
+		return p.endOfTerm()
+	}
+	start := p.pos
+	for !p.done() && !unicode.IsSpace(p.input[p.pos]) {
+		p.pos++
+	}
+	t.Value = string(p.input[start:p.pos])
+	if t.Value == "*" && t.Op == OpEq {
+		t.Op = OpExists
+	}
+	return nil
+}
+
+// quoted parses a double-quoted string in which \" and \\ are escapes.
+func (p *parser) quoted() (string, error) {
+	p.pos++ // the opening quote
+	var b strings.Builder
+	for !p.done() {
+		c := p.input[p.pos]
+		p.pos++
+		switch {
+		case c == '"':
+			return b.String(), nil
+		case c == '\\' && !p.done():
+			b.WriteRune(p.input[p.pos])
+			p.pos++
+		default:
+			b.WriteRune(c)
+		}
+	}
+	return "", errors.New("unterminated quote")
+}
+
+func (p *parser) endOfTerm() error {
+	if !p.done() && !unicode.IsSpace(p.input[p.pos]) {
+		return errors.New("expected a space after closing quote")
+	}
+	return nil
+}
+
+func (t Term) validate() error {
+	switch t.Op {
+	case OpGt, OpGte, OpLt, OpLte:
+		if t.Field != FieldPayload {
+			return fmt.Errorf("%s only supports exact matches", t.Field)
+		}
+		if t.Quoted || !numberPattern.MatchString(t.Value) {
+			return fmt.Errorf("%s needs a number to compare with, got %q", t.Op, t.Value)
+		}
+	case OpExists:
+		if t.Field != FieldPayload {
+			return fmt.Errorf("%s only supports exact matches", t.Field)
+		}
+	}
+	return nil
+}
+
+// Apply adds the query's conditions to db, which must select from jobs.
+// Free text matches the jobs.search_vector column and payload terms the
+// jobs.payload jsonb column; both are GIN-indexed.
+func (q Query) Apply(db *gorm.DB) *gorm.DB {
+	for _, t := range q.Terms {
+		sql, arg := t.SQL()
+		if t.Negated {
+			sql = "NOT COALESCE(" + sql + ", false)"
+		}
+		db = db.Where(sql, arg)
+	}
+	return db
+}
+
+// SQL returns the term's condition, with one bind parameter, and its value.
+func (t Term) SQL() (string, interface{}) {
+	switch t.Field {
+	case FieldType, FieldStatus:
+		return t.Field + " = ?", t.Value
+	case FieldPayload:
+		return "payload @@ ?::jsonpath", t.jsonPath()
+	}
+	if t.Quoted {
+		return "search_vector @@ phraseto_tsquery('simple', ?)", t.Value
+	}
+	return "search_vector @@ plainto_tsquery('simple', ?)", t.Value
+}
+
+// jsonPath returns the payload term as a jsonpath predicate. Path segments
+// are quoted as keys and values encoded as JSON literals, so neither can
+// change the predicate's structure.
+func (t Term) jsonPath() string {
+	var b strings.Builder
+	b.WriteString("$")
+	for _, seg := range t.Path {
+		if indexPattern.MatchString(seg) {
+			b.WriteString("[" + seg + "]")
+		} else {
+			b.WriteString(`."` + seg + `"`)
+		}
+	}
+	path := b.String()
+
+	switch t.Op {
+	case OpExists:
+		return "exists(" + path + ")"
+	case OpGt, OpGte, OpLt, OpLte:
+		return path + " " + t.Op + " " + t.Value
+	}
+	alternatives := []string{path + " == " + jsonString(t.Value)}
+	if !t.Quoted {
+		switch {
+		case numberPattern.MatchString(t.Value):
+			alternatives = append(alternatives, path+" == "+t.Value)
+		case t.Value == "true" || t.Value == "false" || t.Value == "null":
+			alternatives = append(alternatives, path+" == "+t.Value)
+		}
+	}
+	return strings.Join(alternatives, " || ")
+}
+
+func jsonString(s string) string {
+	data, _ := json.Marshal(s)
+	return string(data)
+}
@@ -0,0 +1,76 @@
+package search
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse(t *testing.T) {
+	q, err := Parse(`receipt "order 1234" type:email:send -status:completed payload.order.id:1234 payload.items.0.sku:"A-1" payload.amount:>=10.5 payload.coupon:*`)
+	require.NoError(t, err)
+	assert.Equal(t, []Term{
+		{Op: OpEq, Value: "receipt"},
+		{Op: OpEq, Value: "order 1234", Quoted: true},
+		{Field: FieldType, Op: OpEq, Value: "email:send"},
+		{Negated: true, Field: FieldStatus, Op: OpEq, Value: "completed"},
+		{Field: FieldPayload, Path: []string{"order", "id"}, Op: OpEq, Value: "1234"},
+		{Field: FieldPayload, Path: []string{"items", "0", "sku"}, Op: OpEq, Value: "A-1", Quoted: true},
+		{Field: FieldPayload, Path: []string{"amount"}, Op: OpGte, Value: "10.5"},
+		{Field: FieldPayload, Path: []string{"coupon"}, Op: OpExists, Value: "*"},
+	}, q.Terms)
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, s := range []string{
+		"",
+		"   ",
+		`"unterminated`,
+		`"phrase"glued`,
+		"http://example.com",
+		"payload:1",
+		"payload.a b:1",
+		"payload.a'):1",
+		`payload.a":1`,
+		"payload.a:",
+		"status:>1",
+		"type:*",
+		"payload.amount:>ten",
+		`payload.amount:>"10"`,
+		"payload.amount:>1e9",
+		"type.name:x",
+		strings.Repeat("a ", MaxTerms+1),
+		strings.Repeat("a", MaxLength+1),
+	} {
+		_, err := Parse(s)
+		assert.Error(t, err, "query %q", s)
+	}
+}
+
+func TestTermSQL(t *testing.T) {
+	cases := []struct {
+		query string
+		sql   string
+		arg   interface{}
+	}{
+		{`payload.order.id:1234`, "payload @@ ?::jsonpath", `$."order"."id" == "1234" || $."order"."id" == 1234`},
+		{`payload.order.id:"1234"`, "payload @@ ?::jsonpath", `$."order"."id" == "1234"`},
+		{`payload.paid:true`, "payload @@ ?::jsonpath", `$."paid" == "true" || $."paid" == true`},
+		{`payload.items.0.sku:x`, "payload @@ ?::jsonpath", `$."items"[0]."sku" == "x"`},
+		{`payload.amount:<-2.5`, "payload @@ ?::jsonpath", `$."amount" < -2.5`},
+		{`payload.coupon:*`, "payload @@ ?::jsonpath", `exists($."coupon")`},
+		{`payload.note:"say \"hi\" || true"`, "payload @@ ?::jsonpath", `$."note" == "say \"hi\" || true"`},
+		{`status:failed`, "status = ?", "failed"},
+		{`receipt`, "search_vector @@ plainto_tsquery('simple', ?)", "receipt"},
+		{`"order 1234"`, "search_vector @@ phraseto_tsquery('simple', ?)", "order 1234"},
+	}
+	for _, c := range cases {
+		q, err := Parse(c.query)
+		require.NoError(t, err, c.query)
+		sql, arg := q.Terms[0].SQL()
+		assert.Equal(t, c.sql, sql, c.query)
+		assert.Equal(t, c.arg, arg, c.query)
+	}
+}
@@ -0,0 +1,19 @@
+package tasks
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPermanent(t *testing.T) {
+	base := errors.New("bad payload")
+	err := fmt.Errorf("processing: %w", Permanent(base))
+
+	assert.True(t, IsPermanent(err))
+	assert.ErrorIs(t, err, base)
+	assert.False(t, IsPermanent(base))
+	assert.Nil(t, Permanent(nil))
+}
@@ -0,0 +1,227 @@
+package tasks
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"time"
+
+	"jobqueue/internal/models"
+)
+
+// Ways an ExecProcessor hands the job payload to the command.
+const (
+	PayloadStdin = "stdin"
+	PayloadEnv   = "env"
+)
+
+const defaultExecMaxOutput = 64 * 1024
+
+// execInheritedEnv are the only variables a command inherits from the
+// server's environment, which also holds database and Redis credentials,
+// worker tokens and signing keys. Anything else it needs goes in Env.
+var execInheritedEnv = []string{"PATH", "HOME", "LANG", "TZ"}
+
+// ExecProcessor runs a fixed, operator-configured command for each job. The
+// payload is passed on stdin or in the JOB_PAYLOAD environment variable and
+// never becomes part of the command line. Stdout and stderr are recorded as
+// the job result, truncated to MaxOutput bytes each. The command's
+// environment is Env plus PATH, HOME, LANG and TZ; nothing else is inherited
+// from the server.
+//
+// A zero exit status completes the job. Exit codes listed in
+// PermanentExitCodes fail it without retries; any other failure, including a
+// timeout, is retried. On timeout or cancellation the command's whole process
+// group is killed.
+type ExecProcessor struct {
+	Command            []string
+	Payload            string
+	Env                []string
+	Dir                string
+	Timeout            time.Duration
+	MaxOutput          int
+	PermanentExitCodes []int
+}
+
+// ExecResult is the result recorded for a job run by an ExecProcessor.
+type ExecResult struct {
+	ExitCode  int    `json:"exit_code"`
+	Stdout    string `json:"stdout"`
+	Stderr    string `json:"stderr"`
+	Truncated bool   `json:"truncated,omitempty"`
+}
+
+func (p *ExecProcessor) Process(ctx context.Context, job models.Job) error {
+	if len(p.Command) == 0 {
+		return Permanent(errors.New("exec processor has no command configured"))
+	}
+	if p.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, p.Timeout)
+		defer cancel()
+	}
+
+	maxOutput := p.MaxOutput
+	if maxOutput <= 0 {
+		maxOutput = defaultExecMaxOutput
+	}
+	stdout := &limitedBuffer{limit: maxOutput}
+	stderr := &limitedBuffer{limit: maxOutput}
+
+	cmd := exec.CommandContext(ctx, p.Command[0], p.Command[1:]...)
+	cmd.Dir = p.Dir
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	cmd.Env = execEnv(p.Env)
+	cmd.Env = append(cmd.Env,
+		"JOB_ID="+job.ID,
+		"JOB_TYPE="+job.Type,
+		"JOB_PROJECT_ID="+job.ProjectID,
+		"JOB_ATTEMPT="+strconv.Itoa(job.RetryCount+1),
+	)
+	if p.Payload == PayloadEnv {
+		cmd.Env = append(cmd.Env, "JOB_PAYLOAD="+job.Payload)
+	} else {
+		cmd.Stdin = bytes.NewReader([]byte(job.Payload))
+	}
+	killProcessGroup(cmd)
+
+	runErr := cmd.Run()
+
+	result := ExecResult{
+		ExitCode:  exitCode(cmd),
+		Stdout:    stdout.String(),
+		Stderr:    stderr.String(),
+		Truncated: stdout.truncated || stderr.truncated,
+	}
+	if data, err := json.Marshal(result); err == nil {
+		SetResult(ctx, data)
+	}
+
+	if runErr == nil {
+		return nil
+	}
+	if ctx.Err() != nil {
+		return fmt.Errorf("command %s: %w", p.Command[0], ctx.Err())
+	}
+
+	var exitErr *exec.ExitError
+	if !errors.As(runErr, &exitErr) {
+		// The command could not be started at all; retrying the same
+		// configuration will not help.
+		return Permanent(fmt.Errorf("command %s: %w", p.Command[0], runErr))
+	}
+	err := fmt.Errorf("command %s exited with status %d: %s", p.Command[0], result.ExitCode, tail(result.Stderr, 512))
+	for _, code := range p.PermanentExitCodes {
+		if code == result.ExitCode {
+			return Permanent(err)
+		}
+	}
+	return err
+}
+
+// execEnv returns the allowed part of the server's environment followed by
+// env.
+func execEnv(env []string) []string {
+	out := make([]string, 0, len(execInheritedEnv)+len(env)+5)
+	for _, name := range execInheritedEnv {
+		if value, ok := os.LookupEnv(name); ok {
+			out = append(out, name+"="+value)
+		}
+	}
+	return append(out, env...)
+}
+
+func exitCode(cmd *exec.Cmd) int {
+	if cmd.ProcessState == nil {
+		return -1
+	}
+	return cmd.ProcessState.ExitCode()
+}
+
+func tail(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[len(s)-n:]
+}
+
+// limitedBuffer keeps the first limit bytes written to it and silently drops
+// the rest, so a chatty command can neither exhaust memory nor block on a
+// full pipe.
+type limitedBuffer struct {
+	buf       bytes.Buffer
+	limit     int
+	truncated bool
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if room := b.limit - b.buf.Len(); room < len(p) {
+		b.truncated = true
+		if room > 0 {
+			b.buf.Write(p[:room])
+		}
+		return len(p), nil
+	}
+	return b.buf.Write(p)
+}
+
+func (b *limitedBuffer) String() string {
+	return b.buf.String()
+}
+
+// execSpec is the on-disk form of an ExecProcessor.
+type execSpec struct {
+	Command            []string `json:"command"`
+	Payload            string   `json:"payload"`
+	Env                []string `json:"env"`
+	Dir                string   `json:"dir"`
+	Timeout            string   `json:"timeout"`
+	MaxOutput          int      `json:"max_output"`
+	PermanentExitCodes []int    `json:"permanent_exit_codes"`
+}
+
+// LoadExecProcessors reads the allow-list of commands that may be run as
+// jobs, keyed by job type, from a JSON file such as:
+//
+//	{"cleanup_reports": {"command": ["/opt/jobs/cleanup.sh", "--all"], "payload": "env", "timeout": "5m"}}
+func LoadExecProcessors(path string) (map[string]*ExecProcessor, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var specs map[string]execSpec
+	if err := json.Unmarshal(data, &specs); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	processors := make(map[string]*ExecProcessor, len(specs))
+	for jobType, spec := range specs {
+		if len(spec.Command) == 0 {
+			return nil, fmt.Errorf("%s: %s: command is required", path, jobType)
+		}
+		if spec.Payload != "" && spec.Payload != PayloadStdin && spec.Payload != PayloadEnv {
+			return nil, fmt.Errorf("%s: %s: payload must be %q or %q", path, jobType, PayloadStdin, PayloadEnv)
+		}
+		p := &ExecProcessor{
+			Command:            spec.Command,
+			Payload:            spec.Payload,
+			Env:                spec.Env,
+			Dir:                spec.Dir,
+			MaxOutput:          spec.MaxOutput,
+			PermanentExitCodes: spec.PermanentExitCodes,
+		}
+		if spec.Timeout != "" {
+			if p.Timeout, err = time.ParseDuration(spec.Timeout); err != nil {
+				return nil, fmt.Errorf("%s: %s: timeout: %w", path, jobType, err)
+			}
+		}
+		processors[jobType] = p
+	}
+	return processors, nil
+}
@@ -0,0 +1,14 @@
+//go:build !unix
+
+package tasks
+
+import (
+	"os/exec"
+	"time"
+)
+
+// killProcessGroup only kills the command itself on platforms without
+// process groups.
+func killProcessGroup(cmd *exec.Cmd) {
+	cmd.WaitDelay = 5 * time.Second
+}
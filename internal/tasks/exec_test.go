@@ -0,0 +1,87 @@
+//go:build unix
+
+package tasks
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"jobqueue/internal/models"
+)
+
+func runExec(t *testing.T, p *ExecProcessor, payload string) (ExecResult, error) {
+	t.Helper()
+	ctx, result := WithResult(context.Background())
+	err := p.Process(ctx, models.Job{ID: "job-1", Type: "script", Payload: payload})
+
+	var res ExecResult
+	assert.NoError(t, json.Unmarshal(result(), &res))
+	return res, err
+}
+
+func TestExecProcessorStdin(t *testing.T) {
+	p := &ExecProcessor{Command: []string{"/bin/sh", "-c", `cat; echo " $JOB_ID" >&2`}}
+	res, err := runExec(t, p, `{"order":1234}`)
+
+	assert.NoError(t, err)
+	assert.Equal(t, 0, res.ExitCode)
+	assert.Equal(t, `{"order":1234}`, res.Stdout)
+	assert.Equal(t, " job-1\n", res.Stderr)
+}
+
+func TestExecProcessorEnvAndTruncation(t *testing.T) {
+	p := &ExecProcessor{
+		Command:   []string{"/bin/sh", "-c", `printf '%s' "$JOB_PAYLOAD"`},
+		Payload:   PayloadEnv,
+		MaxOutput: 4,
+	}
+	res, err := runExec(t, p, `{"a":1}`)
+
+	assert.NoError(t, err)
+	assert.Equal(t, `{"a"`, res.Stdout)
+	assert.True(t, res.Truncated)
+}
+
+func TestExecProcessorExitCodes(t *testing.T) {
+	p := &ExecProcessor{
+		Command:            []string{"/bin/sh", "-c", `exit "$(cat)"`},
+		PermanentExitCodes: []int{2},
+	}
+
+	res, err := runExec(t, p, "1")
+	assert.Error(t, err)
+	assert.False(t, IsPermanent(err))
+	assert.Equal(t, 1, res.ExitCode)
+
+	_, err = runExec(t, p, "2")
+	assert.True(t, IsPermanent(err))
+}
+
+func TestExecProcessorTimeoutKillsGroup(t *testing.T) {
+	p := &ExecProcessor{
+		Command: []string{"/bin/sh", "-c", `sleep 30 & sleep 30`},
+		Timeout: 100 * time.Millisecond,
+	}
+	start := time.Now()
+	_, err := runExec(t, p, "")
+
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.False(t, IsPermanent(err))
+	assert.Less(t, time.Since(start), 5*time.Second)
+}
+
+func TestExecProcessorDoesNotLeakServerEnv(t *testing.T) {
+	t.Setenv("POSTGRES_DSN", "postgres://secret")
+	p := &ExecProcessor{
+		Command: []string{"/bin/sh", "-c", `printf '%s|%s|%s' "${POSTGRES_DSN:-unset}" "$EXTRA" "$JOB_ID"; command -v sh >/dev/null || echo nopath >&2`},
+		Env:     []string{"EXTRA=ok"},
+	}
+	res, err := runExec(t, p, "")
+
+	assert.NoError(t, err)
+	assert.Equal(t, "unset|ok|job-1", res.Stdout)
+	assert.Empty(t, res.Stderr)
+}
@@ -0,0 +1,20 @@
+//go:build unix
+
+package tasks
+
+import (
+	"os/exec"
+	"syscall"
+	"time"
+)
+
+// killProcessGroup starts cmd in its own process group and makes context
+// cancellation kill the whole group, so helpers spawned by a shell script do
+// not outlive the job.
+func killProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+	cmd.WaitDelay = 5 * time.Second
+}
@@ -0,0 +1,140 @@
+package tasks
+
+import (
+	"context"
+	"fmt"
+	"runtime/debug"
+	"time"
+
+	"go.uber.org/zap"
+	"jobqueue/internal/models"
+)
+
+// ProcessorFunc lets an ordinary function be used as a Processor.
+type ProcessorFunc func(ctx context.Context, job models.Job) error
+
+func (f ProcessorFunc) Process(ctx context.Context, job models.Job) error {
+	return f(ctx, job)
+}
+
+// Middleware wraps a Processor with cross-cutting behavior such as logging,
+// metrics or context injection.
+type Middleware func(Processor) Processor
+
+// Use adds middleware that wraps every processor in the default registry.
+// Middleware added first runs outermost.
+func Use(mw ...Middleware) {
+	defaultRegistry.Use(mw...)
+}
+
+// UseFor adds middleware that wraps only the processor for jobType in the
+// default registry. It runs inside any global middleware.
+func UseFor(jobType string, mw ...Middleware) {
+	defaultRegistry.UseFor(jobType, mw...)
+}
+
+// Chain wraps p so that mw[0] is the outermost layer.
+func Chain(p Processor, mw ...Middleware) Processor {
+	for i := len(mw) - 1; i >= 0; i-- {
+		p = mw[i](p)
+	}
+	return p
+}
+
+// PanicError is returned in place of a panic raised by a processor.
+type PanicError struct {
+	Value interface{}
+	Stack []byte
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("processor panicked: %v", e.Value)
+}
+
+// Recover turns a panic in the wrapped processor into a *PanicError.
+func Recover() Middleware {
+	return func(next Processor) Processor {
+		return ProcessorFunc(func(ctx context.Context, job models.Job) (err error) {
+			defer func() {
+				if r := recover(); r != nil {
+					err = &PanicError{Value: r, Stack: debug.Stack()}
+				}
+			}()
+			return next.Process(ctx, job)
+		})
+	}
+}
+
+// Timeout cancels the job's context after d.
+func Timeout(d time.Duration) Middleware {
+	return func(next Processor) Processor {
+		return ProcessorFunc(func(ctx context.Context, job models.Job) error {
+			ctx, cancel := context.WithTimeout(ctx, d)
+			defer cancel()
+			return next.Process(ctx, job)
+		})
+	}
+}
+
+// Timing reports how long each run of the wrapped processor took.
+func Timing(record func(job models.Job, elapsed time.Duration, err error)) Middleware {
+	return func(next Processor) Processor {
+		return ProcessorFunc(func(ctx context.Context, job models.Job) error {
+			start := time.Now()
+			err := next.Process(ctx, job)
+			record(job, time.Since(start), err)
+			return err
+		})
+	}
+}
+
+// Logging writes a structured log line before and after each run.
+func Logging(logger *zap.Logger) Middleware {
+	return func(next Processor) Processor {
+		return ProcessorFunc(func(ctx context.Context, job models.Job) error {
+			fields := []zap.Field{
+				zap.String("job_id", job.ID),
+				zap.String("job_type", job.Type),
+				zap.String("project_id", job.ProjectID),
+				zap.Int("attempt", job.RetryCount+1),
+			}
+			logger.Debug("task started", fields...)
+
+			start := time.Now()
+			err := next.Process(ctx, job)
+			fields = append(fields, zap.Duration("elapsed", time.Since(start)))
+			if err != nil {
+				logger.Info("task failed", append(fields, zap.Error(err))...)
+			} else {
+				logger.Info("task finished", fields...)
+			}
+			return err
+		})
+	}
+}
+
+// Span is a unit of work started by a Tracer.
+type Span interface {
+	End(err error)
+}
+
+// Tracer starts spans. It is small enough to adapt any tracing library to.
+type Tracer interface {
+	Start(ctx context.Context, name string, attrs map[string]string) (context.Context, Span)
+}
+
+// Tracing runs each job inside a span named after its type.
+func Tracing(tracer Tracer) Middleware {
+	return func(next Processor) Processor {
+		return ProcessorFunc(func(ctx context.Context, job models.Job) error {
+			ctx, span := tracer.Start(ctx, "job "+job.Type, map[string]string{
+				"job.id":         job.ID,
+				"job.type":       job.Type,
+				"job.project_id": job.ProjectID,
+			})
+			err := next.Process(ctx, job)
+			span.End(err)
+			return err
+		})
+	}
+}
@@ -0,0 +1,41 @@
+package tasks
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"jobqueue/internal/models"
+)
+
+func TestChainOrder(t *testing.T) {
+	var calls []string
+	layer := func(name string) Middleware {
+		return func(next Processor) Processor {
+			return ProcessorFunc(func(ctx context.Context, job models.Job) error {
+				calls = append(calls, name)
+				return next.Process(ctx, job)
+			})
+		}
+	}
+	p := Chain(ProcessorFunc(func(ctx context.Context, job models.Job) error {
+		calls = append(calls, "processor")
+		return nil
+	}), layer("outer"), layer("inner"))
+
+	assert.NoError(t, p.Process(context.Background(), models.Job{}))
+	assert.Equal(t, []string{"outer", "inner", "processor"}, calls)
+}
+
+func TestRecover(t *testing.T) {
+	p := Chain(ProcessorFunc(func(ctx context.Context, job models.Job) error {
+		panic("boom")
+	}), Recover())
+
+	err := p.Process(context.Background(), models.Job{})
+	var panicErr *PanicError
+	assert.True(t, errors.As(err, &panicErr))
+	assert.Equal(t, "boom", panicErr.Value)
+	assert.NotEmpty(t, panicErr.Stack)
+}
@@ -12,20 +12,14 @@ type Processor interface {
 	Process(ctx context.Context, job models.Job) error
 }
 
-var processors = make(map[string]Processor)
-
-// Register associates a job type with a processor.
-func Register(jobType string, p Processor) {
-	processors[jobType] = p
+// Register associates a job type with a processor in the default registry.
+func Register(jobType string, p Processor, opts ...Option) {
+	defaultRegistry.Register(jobType, p, opts...)
 }
 
-// Get returns the processor for a given job type.
+// Get returns the processor for a given job type from the default registry.
 func Get(jobType string) (Processor, error) {
-	p, ok := processors[jobType]
-	if !ok {
-		return nil, fmt.Errorf("no processor registered for job type: %s", jobType)
-	}
-	return p, nil
+	return defaultRegistry.Get(jobType)
 }
 
 // MockEmailSender is a placeholder for a real email service.
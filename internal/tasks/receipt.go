@@ -2,7 +2,7 @@ package tasks
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
 
 	"github.com/jung-kurt/gofpdf"
@@ -18,11 +18,27 @@ type ReceiptPayload struct {
 	IsPaid  bool    `json:"is_paid"`
 }
 
+// defaultReceiptRecipient is addressed by receipts submitted without a
+// recipient, which were accepted before "to" was checked.
+const defaultReceiptRecipient = "Customer"
+
+// Validate leaves "to" optional so that receipts already queued without one
+// still go through; they are addressed to defaultReceiptRecipient.
+func (p ReceiptPayload) Validate() error {
+	if p.Amount < 0 {
+		return errors.New("amount must not be negative")
+	}
+	return nil
+}
+
 func (g *ReceiptGenerator) Process(ctx context.Context, job models.Job) error {
-	var p ReceiptPayload
-	if err := json.Unmarshal([]byte(job.Payload), &p); err != nil {
-		// Non-retryable error, payload is malformed.
-		return fmt.Errorf("failed to unmarshal receipt payload: %w", err)
+	// Non-retryable error if the payload is malformed.
+	p, err := DecodePayload[ReceiptPayload](job)
+	if err != nil {
+		return err
+	}
+	if p.To == "" {
+		p.To = defaultReceiptRecipient
 	}
 
 	pdf := gofpdf.New("P", "mm", "A4", "")
@@ -48,7 +64,7 @@ func (g *ReceiptGenerator) Process(ctx context.Context, job models.Job) error {
 
 	// Save to a file named after the job ID. In a real app, this might be uploaded to S3.
 	filePath := fmt.Sprintf("receipt-%s.pdf", job.ID)
-	err := pdf.OutputFileAndClose(filePath)
+	err = pdf.OutputFileAndClose(filePath)
 	if err != nil {
 		return fmt.Errorf("failed to generate PDF: %w", err)
 	}
@@ -0,0 +1,145 @@
+package tasks
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// TypeInfo describes a registered job type.
+type TypeInfo struct {
+	Type string
+	// Timeout bounds each run of the processor; zero means no limit.
+	Timeout time.Duration
+	// MaxRetries overrides the default retry count of submitted jobs when
+	// positive.
+	MaxRetries int
+	// Schema is a JSON Schema for the payload, if known.
+	Schema json.RawMessage
+}
+
+// Option sets metadata on a job type at registration.
+type Option func(*TypeInfo)
+
+// WithTimeout runs the processor under Timeout(d).
+func WithTimeout(d time.Duration) Option {
+	return func(info *TypeInfo) { info.Timeout = d }
+}
+
+// WithMaxRetries sets how many times jobs of the type are retried.
+func WithMaxRetries(n int) Option {
+	return func(info *TypeInfo) { info.MaxRetries = n }
+}
+
+// WithSchema records the payload's JSON Schema.
+func WithSchema(schema json.RawMessage) Option {
+	return func(info *TypeInfo) { info.Schema = schema }
+}
+
+type registration struct {
+	processor Processor
+	info      TypeInfo
+}
+
+// Registry maps job types to processors and the middleware they run under.
+// It is safe for concurrent use, so processors can be registered or removed
+// while workers are running.
+type Registry struct {
+	mu               sync.RWMutex
+	processors       map[string]registration
+	globalMiddleware []Middleware
+	typeMiddleware   map[string][]Middleware
+}
+
+var defaultRegistry = NewRegistry()
+
+// NewRegistry returns an empty registry.
+func NewRegistry() *Registry {
+	return &Registry{
+		processors:     make(map[string]registration),
+		typeMiddleware: make(map[string][]Middleware),
+	}
+}
+
+// DefaultRegistry returns the registry used by the package-level functions.
+func DefaultRegistry() *Registry {
+	return defaultRegistry
+}
+
+// Register associates a job type with a processor, replacing any earlier one.
+func (r *Registry) Register(jobType string, p Processor, opts ...Option) {
+	info := TypeInfo{Type: jobType}
+	for _, opt := range opts {
+		opt(&info)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.processors[jobType] = registration{processor: p, info: info}
+}
+
+// Unregister removes the processor for jobType. Jobs of that type fail
+// permanently until a processor is registered again.
+func (r *Registry) Unregister(jobType string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.processors, jobType)
+}
+
+// Use adds middleware that wraps every processor. Middleware added first runs
+// outermost.
+func (r *Registry) Use(mw ...Middleware) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.globalMiddleware = append(r.globalMiddleware, mw...)
+}
+
+// UseFor adds middleware that wraps only the processor for jobType. It runs
+// inside any global middleware.
+func (r *Registry) UseFor(jobType string, mw ...Middleware) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.typeMiddleware[jobType] = append(r.typeMiddleware[jobType], mw...)
+}
+
+// Get returns the processor for a given job type, wrapped in its timeout and
+// the global and per-type middleware.
+func (r *Registry) Get(jobType string) (Processor, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	reg, ok := r.processors[jobType]
+	if !ok {
+		// Retrying cannot help until a processor is deployed for this type.
+		return nil, Permanent(fmt.Errorf("no processor registered for job type: %s", jobType))
+	}
+	p := reg.processor
+	if reg.info.Timeout > 0 {
+		p = Timeout(reg.info.Timeout)(p)
+	}
+	p = Chain(p, r.typeMiddleware[jobType]...)
+	return Chain(p, r.globalMiddleware...), nil
+}
+
+// Info returns the metadata of a registered job type.
+func (r *Registry) Info(jobType string) (TypeInfo, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	reg, ok := r.processors[jobType]
+	return reg.info, ok
+}
+
+// List returns the metadata of every registered job type, sorted by type.
+func (r *Registry) List() []TypeInfo {
+	r.mu.RLock()
+	infos := make([]TypeInfo, 0, len(r.processors))
+	for _, reg := range r.processors {
+		infos = append(infos, reg.info)
+	}
+	r.mu.RUnlock()
+
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Type < infos[j].Type })
+	return infos
+}
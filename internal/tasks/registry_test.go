@@ -0,0 +1,68 @@
+package tasks
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"jobqueue/internal/models"
+)
+
+func TestRegistryConcurrentUse(t *testing.T) {
+	r := NewRegistry()
+	noop := ProcessorFunc(func(ctx context.Context, job models.Job) error { return nil })
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(2)
+		jobType := fmt.Sprintf("type_%02d", i)
+		go func() {
+			defer wg.Done()
+			r.Register(jobType, noop, WithMaxRetries(5))
+		}()
+		go func() {
+			defer wg.Done()
+			r.Get(jobType)
+			r.List()
+		}()
+	}
+	wg.Wait()
+
+	infos := r.List()
+	require.Len(t, infos, 50)
+	assert.Equal(t, "type_00", infos[0].Type)
+	assert.Equal(t, 5, infos[0].MaxRetries)
+
+	r.Unregister("type_00")
+	_, err := r.Get("type_00")
+	assert.True(t, IsPermanent(err))
+	assert.Len(t, r.List(), 49)
+}
+
+type order struct {
+	ID    int      `json:"id"`
+	Notes string   `json:"notes,omitempty"`
+	Tags  []string `json:"tags"`
+}
+
+func TestRegisterTypedSchema(t *testing.T) {
+	r := NewRegistry()
+	RegisterTypedIn(r, "order", TypedHandler[order](func(ctx context.Context, job models.Job, payload order) error {
+		return nil
+	}))
+
+	info, ok := r.Info("order")
+	require.True(t, ok)
+	assert.JSONEq(t, `{
+		"type": "object",
+		"properties": {
+			"id": {"type": "integer"},
+			"notes": {"type": "string"},
+			"tags": {"type": "array", "items": {"type": "string"}}
+		},
+		"required": ["id", "tags"]
+	}`, string(info.Schema))
+}
@@ -0,0 +1,36 @@
+package tasks
+
+import (
+	"context"
+	"sync"
+)
+
+type resultKey struct{}
+
+type resultHolder struct {
+	mu   sync.Mutex
+	data []byte
+}
+
+// WithResult returns a context that processors can record a job result into
+// with SetResult, and a func returning whatever was recorded.
+func WithResult(ctx context.Context) (context.Context, func() []byte) {
+	h := &resultHolder{}
+	return context.WithValue(ctx, resultKey{}, h), func() []byte {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		return h.data
+	}
+}
+
+// SetResult records the output of the job being processed. It is stored on
+// the job when it completes. Calling it again replaces the previous result.
+func SetResult(ctx context.Context, data []byte) {
+	h, ok := ctx.Value(resultKey{}).(*resultHolder)
+	if !ok {
+		return
+	}
+	h.mu.Lock()
+	h.data = data
+	h.mu.Unlock()
+}
@@ -0,0 +1,66 @@
+package tasks
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"jobqueue/internal/models"
+)
+
+// Validator is implemented by payload types that can check themselves once
+// decoded, e.g. for required fields.
+type Validator interface {
+	Validate() error
+}
+
+// TypedHandler processes a job whose payload has already been decoded into T.
+type TypedHandler[T any] func(ctx context.Context, job models.Job, payload T) error
+
+// Process lets a TypedHandler be used anywhere a Processor is expected. A
+// payload that fails to decode or validate is a permanent failure.
+func (h TypedHandler[T]) Process(ctx context.Context, job models.Job) error {
+	payload, err := DecodePayload[T](job)
+	if err != nil {
+		return err
+	}
+	return h(ctx, job, payload)
+}
+
+// RegisterTyped associates a job type with a handler for payloads of type T
+// in the default registry.
+func RegisterTyped[T any](jobType string, h TypedHandler[T], opts ...Option) {
+	RegisterTypedIn(defaultRegistry, jobType, h, opts...)
+}
+
+// RegisterTypedIn is RegisterTyped for a specific registry. The payload
+// schema is derived from T unless opts supply one.
+func RegisterTypedIn[T any](r *Registry, jobType string, h TypedHandler[T], opts ...Option) {
+	opts = append([]Option{WithSchema(SchemaOf[T]())}, opts...)
+	r.Register(jobType, h, opts...)
+}
+
+// DecodePayload decodes a job's payload into T and validates it. Errors are
+// marked permanent since retrying the same payload cannot succeed.
+func DecodePayload[T any](job models.Job) (T, error) {
+	var payload T
+	if err := json.Unmarshal([]byte(job.Payload), &payload); err != nil {
+		return payload, Permanent(fmt.Errorf("decode %s payload: %w", job.Type, err))
+	}
+	if err := ValidatePayload(payload); err != nil {
+		return payload, Permanent(fmt.Errorf("invalid %s payload: %w", job.Type, err))
+	}
+	return payload, nil
+}
+
+// ValidatePayload runs the payload's Validate method, if it has one, whether
+// it is declared on T or on *T.
+func ValidatePayload[T any](payload T) error {
+	if v, ok := any(payload).(Validator); ok {
+		return v.Validate()
+	}
+	if v, ok := any(&payload).(Validator); ok {
+		return v.Validate()
+	}
+	return nil
+}
@@ -0,0 +1,49 @@
+package tasks
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"jobqueue/internal/models"
+)
+
+type greeting struct {
+	Name string `json:"name"`
+}
+
+func (g *greeting) Validate() error {
+	if g.Name == "" {
+		return errors.New("name is required")
+	}
+	return nil
+}
+
+func TestTypedHandler(t *testing.T) {
+	var got greeting
+	h := TypedHandler[greeting](func(ctx context.Context, job models.Job, payload greeting) error {
+		got = payload
+		return nil
+	})
+
+	err := h.Process(context.Background(), models.Job{Type: "greet", Payload: `{"name":"ada"}`})
+	assert.NoError(t, err)
+	assert.Equal(t, "ada", got.Name)
+
+	err = h.Process(context.Background(), models.Job{Type: "greet", Payload: `{"name":`})
+	assert.True(t, IsPermanent(err))
+
+	err = h.Process(context.Background(), models.Job{Type: "greet", Payload: `{}`})
+	assert.True(t, IsPermanent(err))
+	assert.Contains(t, err.Error(), "name is required")
+}
+
+func TestReceiptPayloadWithoutRecipient(t *testing.T) {
+	p, err := DecodePayload[ReceiptPayload](models.Job{Type: "pdf", Payload: `{"item":"book","amount":12.5}`})
+	assert.NoError(t, err)
+	assert.Equal(t, "book", p.Item)
+
+	_, err = DecodePayload[ReceiptPayload](models.Job{Type: "pdf", Payload: `{"to":"ada","amount":-1}`})
+	assert.True(t, IsPermanent(err))
+}
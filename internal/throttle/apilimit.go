@@ -0,0 +1,298 @@
+package throttle
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"jobqueue/internal/config"
+	"jobqueue/internal/models"
+)
+
+// APILimit allows Rate requests on average, in bursts of up to Burst.
+type APILimit struct {
+	Rate  config.RateLimit
+	Burst int
+}
+
+func (l *APILimit) UnmarshalJSON(data []byte) error {
+	var raw struct {
+		Rate  string `json:"rate"`
+		Burst int    `json:"burst"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	rate, err := config.ParseRateLimit(raw.Rate)
+	if err != nil {
+		return err
+	}
+	if raw.Burst < 0 {
+		return fmt.Errorf("burst must not be negative, got %d", raw.Burst)
+	}
+	if raw.Burst == 0 {
+		raw.Burst = rate.Count
+	}
+	*l = APILimit{Rate: rate, Burst: raw.Burst}
+	return nil
+}
+
+// APILimits configures API rate limiting. Every user is limited by their
+// entry in Users, else their plan's, else Default. Routes and Projects add
+// further limits: a route's limit applies to each user separately, a
+// project's to everyone using the project together.
+type APILimits struct {
+	Default  APILimit            `json:"default"`
+	Plans    map[string]APILimit `json:"plans,omitempty"`
+	Users    map[string]APILimit `json:"users,omitempty"`
+	Projects map[string]APILimit `json:"projects,omitempty"`
+	// Routes are keyed by method and chi route pattern, e.g.
+	// "POST /api/v1/job/submit".
+	Routes map[string]APILimit `json:"routes,omitempty"`
+}
+
+// DefaultAPILimits limits every user to 5 requests per second in bursts of
+// up to 10.
+func DefaultAPILimits() APILimits {
+	return APILimits{Default: APILimit{Rate: config.RateLimit{Count: 5, Per: time.Second}, Burst: 10}}
+}
+
+// ForUser returns the limit for user.
+func (c APILimits) ForUser(user models.User) APILimit {
+	if l, ok := c.Users[user.ID]; ok {
+		return l
+	}
+	if l, ok := c.Plans[user.Plan]; ok {
+		return l
+	}
+	return c.Default
+}
+
+// ForProject returns the limit shared by everyone using projectID, if any.
+func (c APILimits) ForProject(projectID string) (APILimit, bool) {
+	l, ok := c.Projects[projectID]
+	return l, ok
+}
+
+// ForRoute returns the per-user limit of a route, if any.
+func (c APILimits) ForRoute(method, pattern string) (APILimit, bool) {
+	l, ok := c.Routes[method+" "+pattern]
+	return l, ok
+}
+
+// HasPlan reports whether plan is the default plan or has limits of its own.
+func (c APILimits) HasPlan(plan string) bool {
+	_, ok := c.Plans[plan]
+	return ok || plan == config.DefaultPlan
+}
+
+// LoadAPILimits reads API rate limits from the JSON file at path, e.g.
+//
+//	{
+//	  "default": {"rate": "5/s", "burst": 10},
+//	  "plans": {"pro": {"rate": "50/s", "burst": 100}},
+//	  "users": {"<user id>": {"rate": "200/s"}},
+//	  "projects": {"<project id>": {"rate": "100/s"}},
+//	  "routes": {"POST /api/v1/job/submit": {"rate": "20/s", "burst": 40}}
+//	}
+//
+// A burst defaults to the rate's count. An empty path, or a file without a
+// default, uses DefaultAPILimits.
+func LoadAPILimits(path string) (APILimits, error) {
+	limits := DefaultAPILimits()
+	if path == "" {
+		return limits, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return APILimits{}, fmt.Errorf("read rate limits: %w", err)
+	}
+	var file struct {
+		Default *APILimit `json:"default"`
+		APILimits
+	}
+	if err := json.Unmarshal(data, &file); err != nil {
+		return APILimits{}, fmt.Errorf("parse rate limits: %w", err)
+	}
+	if file.Default != nil {
+		file.APILimits.Default = *file.Default
+	} else {
+		file.APILimits.Default = limits.Default
+	}
+	return file.APILimits, nil
+}
+
+// Decision is the outcome of a rate limit check.
+type Decision struct {
+	Allowed bool
+	// Limit is the burst size, Remaining how many more requests would be
+	// allowed right now, and Reset how long until the limit is fully
+	// replenished.
+	Limit     int
+	Remaining int
+	Reset     time.Duration
+	// RetryAfter is how long to wait before the denied request would be
+	// allowed.
+	RetryAfter time.Duration
+}
+
+// WriteHeaders sets the RateLimit-Limit, RateLimit-Remaining and
+// RateLimit-Reset headers, and Retry-After if the request was denied.
+func (d Decision) WriteHeaders(h http.Header) {
+	h.Set("RateLimit-Limit", strconv.Itoa(d.Limit))
+	h.Set("RateLimit-Remaining", strconv.Itoa(d.Remaining))
+	h.Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(d.Reset)))
+	if !d.Allowed {
+		h.Set("Retry-After", strconv.Itoa(ceilSeconds(d.RetryAfter)))
+	}
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
+
+// gcraScript implements the generic cell rate algorithm. KEYS[1] holds the
+// theoretical arrival time (TAT) in ms: the time at which the limit would be
+// fully replenished. A request is allowed if, after adding its cost, the TAT
+// is no more than the burst tolerance ahead of now.
+//
+// ARGV: now_ms, emission interval in ms, burst tolerance in ms, cost.
+// Returns {allowed, remaining, retry_after_ms, reset_ms}.
+var gcraScript = redis.NewScript(`
+local now = tonumber(ARGV[1])
+local interval = tonumber(ARGV[2])
+local tolerance = tonumber(ARGV[3])
+local cost = tonumber(ARGV[4])
+
+local tat = tonumber(redis.call('GET', KEYS[1]))
+if tat == nil or tat < now then
+	tat = now
+end
+
+local new_tat = tat + interval * cost
+local diff = now - (new_tat - tolerance)
+if diff < 0 then
+	return {0, math.max(0, math.floor((now - (tat - tolerance)) / interval)), math.ceil(-diff), math.ceil(tat - now)}
+end
+
+redis.call('SET', KEYS[1], tostring(new_tat), 'PX', math.ceil(new_tat - now))
+return {1, math.floor(diff / interval), 0, math.ceil(new_tat - now)}
+`)
+
+// APILimiter enforces APILimits across all replicas.
+type APILimiter struct {
+	rdb    redis.UniversalClient
+	limits APILimits
+}
+
+func NewAPILimiter(rdb redis.UniversalClient, limits APILimits) *APILimiter {
+	return &APILimiter{rdb: rdb, limits: limits}
+}
+
+// Limits returns the configured limits.
+func (l *APILimiter) Limits() APILimits {
+	return l.limits
+}
+
+// Allow counts cost requests against limit under key. A cost above the
+// limit's burst is never allowed.
+func (l *APILimiter) Allow(ctx context.Context, key string, limit APILimit, cost int) (Decision, error) {
+	interval := float64(limit.Rate.Per.Milliseconds()) / float64(limit.Rate.Count)
+	res, err := gcraScript.Run(ctx, l.rdb, []string{"ratelimit:api:" + key},
+		time.Now().UnixMilli(), interval, interval*float64(limit.Burst), cost,
+	).Int64Slice()
+	if err != nil {
+		return Decision{}, err
+	}
+	return Decision{
+		Allowed:    res[0] == 1,
+		Limit:      limit.Burst,
+		Remaining:  int(res[1]),
+		RetryAfter: time.Duration(res[2]) * time.Millisecond,
+		Reset:      time.Duration(res[3]) * time.Millisecond,
+	}, nil
+}
+
+// Check is one limit to apply to a request.
+type Check struct {
+	Key   string
+	Limit APILimit
+}
+
+// AllowAll applies each check in turn and stops at the first that denies
+// the request. It returns the tightest decision: the denial, or else the
+// check with the fewest requests remaining. Requests allowed by the checks
+// before a denial stay counted.
+func (l *APILimiter) AllowAll(ctx context.Context, checks []Check, cost int) (Decision, error) {
+	tightest := Decision{Allowed: true, Remaining: math.MaxInt}
+	for _, c := range checks {
+		d, err := l.Allow(ctx, c.Key, c.Limit, cost)
+		if err != nil {
+			return Decision{}, err
+		}
+		if !d.Allowed {
+			return d, nil
+		}
+		if d.Remaining < tightest.Remaining {
+			tightest = d
+		}
+	}
+	return tightest, nil
+}
+
+// gcraTakeScript is gcraScript for a batch: rather than all of the cost or
+// nothing, it counts as much of it as the limit allows right now.
+//
+// ARGV: now_ms, emission interval in ms, burst tolerance in ms, cost.
+// Returns {taken, remaining, retry_after_ms, reset_ms}; retry_after_ms is how
+// long until one more request would be allowed, if not all were taken.
+var gcraTakeScript = redis.NewScript(`
+local now = tonumber(ARGV[1])
+local interval = tonumber(ARGV[2])
+local tolerance = tonumber(ARGV[3])
+local cost = tonumber(ARGV[4])
+
+local tat = tonumber(redis.call('GET', KEYS[1]))
+if tat == nil or tat < now then
+	tat = now
+end
+
+local taken = math.min(cost, math.max(0, math.floor((now + tolerance - tat) / interval)))
+local new_tat = tat + interval * taken
+if taken > 0 then
+	redis.call('SET', KEYS[1], tostring(new_tat), 'PX', math.ceil(new_tat - now))
+end
+
+local retry_after = 0
+if taken < cost then
+	retry_after = math.ceil(new_tat + interval - tolerance - now)
+end
+return {taken, math.max(0, math.floor((now + tolerance - new_tat) / interval)), retry_after, math.ceil(new_tat - now)}
+`)
+
+// Take counts up to n requests against limit under key, as many as it allows
+// right now, and returns how many it counted. The decision is allowed only
+// if all n were.
+func (l *APILimiter) Take(ctx context.Context, key string, limit APILimit, n int) (int, Decision, error) {
+	interval := float64(limit.Rate.Per.Milliseconds()) / float64(limit.Rate.Count)
+	res, err := gcraTakeScript.Run(ctx, l.rdb, []string{"ratelimit:api:" + key},
+		time.Now().UnixMilli(), interval, interval*float64(limit.Burst), n,
+	).Int64Slice()
+	if err != nil {
+		return 0, Decision{}, err
+	}
+	return int(res[0]), Decision{
+		Allowed:    int(res[0]) == n,
+		Limit:      limit.Burst,
+		Remaining:  int(res[1]),
+		RetryAfter: time.Duration(res[2]) * time.Millisecond,
+		Reset:      time.Duration(res[3]) * time.Millisecond,
+	}, nil
+}
@@ -0,0 +1,96 @@
+package throttle
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"jobqueue/internal/config"
+	"jobqueue/internal/models"
+)
+
+func TestLoadAPILimits(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "limits.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{
+		"plans": {"pro": {"rate": "50/s", "burst": 100}},
+		"users": {"u1": {"rate": "1/m"}},
+		"routes": {"POST /api/v1/job/submit": {"rate": "2/s"}}
+	}`), 0o644))
+
+	limits, err := LoadAPILimits(path)
+	require.NoError(t, err)
+	assert.Equal(t, DefaultAPILimits().Default, limits.Default)
+	assert.Equal(t, 100, limits.ForUser(models.User{ID: "u2", Plan: "pro"}).Burst)
+	assert.Equal(t, APILimit{Rate: config.RateLimit{Count: 1, Per: time.Minute}, Burst: 1}, limits.ForUser(models.User{ID: "u1", Plan: "pro"}))
+	assert.Equal(t, limits.Default, limits.ForUser(models.User{ID: "u3", Plan: config.DefaultPlan}))
+
+	route, ok := limits.ForRoute("POST", "/api/v1/job/submit")
+	assert.True(t, ok)
+	assert.Equal(t, 2, route.Burst)
+	assert.True(t, limits.HasPlan("pro"))
+	assert.False(t, limits.HasPlan("enterprise"))
+}
+
+func TestAPILimiterBurst(t *testing.T) {
+	redisURL := os.Getenv("REDIS_URL")
+	if redisURL == "" {
+		t.Skip("REDIS_URL environment variable not set, skipping test")
+	}
+	opts, err := redis.ParseURL(redisURL)
+	require.NoError(t, err)
+	rdb := redis.NewClient(opts)
+	defer rdb.Close()
+
+	ctx := context.Background()
+	key := "test:" + time.Now().Format("150405.000000")
+	defer rdb.Del(ctx, "ratelimit:api:"+key)
+
+	limiter := NewAPILimiter(rdb, DefaultAPILimits())
+	limit := APILimit{Rate: config.RateLimit{Count: 1, Per: time.Minute}, Burst: 3}
+	for i := 0; i < 3; i++ {
+		d, err := limiter.Allow(ctx, key, limit, 1)
+		require.NoError(t, err)
+		assert.True(t, d.Allowed)
+		assert.Equal(t, 2-i, d.Remaining)
+	}
+
+	d, err := limiter.Allow(ctx, key, limit, 1)
+	require.NoError(t, err)
+	assert.False(t, d.Allowed)
+	assert.InDelta(t, time.Minute.Seconds(), d.RetryAfter.Seconds(), 1)
+}
+
+func TestAPILimiterTake(t *testing.T) {
+	redisURL := os.Getenv("REDIS_URL")
+	if redisURL == "" {
+		t.Skip("REDIS_URL environment variable not set, skipping test")
+	}
+	opts, err := redis.ParseURL(redisURL)
+	require.NoError(t, err)
+	rdb := redis.NewClient(opts)
+	defer rdb.Close()
+
+	ctx := context.Background()
+	key := "test:" + time.Now().Format("150405.000000")
+	defer rdb.Del(ctx, "ratelimit:api:"+key)
+
+	limiter := NewAPILimiter(rdb, DefaultAPILimits())
+	limit := APILimit{Rate: config.RateLimit{Count: 1, Per: time.Minute}, Burst: 5}
+	taken, d, err := limiter.Take(ctx, key, limit, 3)
+	require.NoError(t, err)
+	assert.Equal(t, 3, taken)
+	assert.True(t, d.Allowed)
+	assert.Equal(t, 2, d.Remaining)
+
+	taken, d, err = limiter.Take(ctx, key, limit, 4)
+	require.NoError(t, err)
+	assert.Equal(t, 2, taken)
+	assert.False(t, d.Allowed)
+	assert.Equal(t, 0, d.Remaining)
+	assert.InDelta(t, time.Minute.Seconds(), d.RetryAfter.Seconds(), 1)
+}
@@ -0,0 +1,133 @@
+package throttle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"gorm.io/gorm"
+	"jobqueue/internal/models"
+	"jobqueue/internal/queue"
+)
+
+// Backlog scopes.
+const (
+	ScopeQueue   = "queue"
+	ScopeProject = "project"
+)
+
+// BacklogUsage is how full one backlog is. Limit and Soft are zero when the
+// backlog is unbounded.
+type BacklogUsage struct {
+	Scope string
+	Name  string
+	Depth int64
+	Limit int64
+	Soft  int64
+}
+
+// Full reports whether the backlog has reached its hard limit.
+func (u BacklogUsage) Full() bool {
+	return u.Limit > 0 && u.Depth >= u.Limit
+}
+
+// Room returns how many more jobs fit in the backlog before it is full.
+func (u BacklogUsage) Room() int64 {
+	if u.Limit == 0 {
+		return math.MaxInt64
+	}
+	if u.Depth >= u.Limit {
+		return 0
+	}
+	return u.Limit - u.Depth
+}
+
+// AboveWatermark reports whether the backlog has reached its soft watermark.
+func (u BacklogUsage) AboveWatermark() bool {
+	return u.Soft > 0 && u.Depth >= u.Soft
+}
+
+// Backlog measures queue depth and per-project backlog against their limits
+// so submits can be refused before the queue grows without bound.
+type Backlog struct {
+	db  *gorm.DB
+	rdb redis.UniversalClient
+
+	queueLimits         map[string]int
+	defaultQueueLimit   int
+	projectLimits       map[string]int
+	defaultProjectLimit int
+	softWatermark       float64
+	retryAfter          time.Duration
+}
+
+func NewBacklog(db *gorm.DB, rdb redis.UniversalClient, queueLimits map[string]int, defaultQueueLimit int, projectLimits map[string]int, defaultProjectLimit int, softWatermark float64, retryAfter time.Duration) *Backlog {
+	return &Backlog{
+		db:                  db,
+		rdb:                 rdb,
+		queueLimits:         queueLimits,
+		defaultQueueLimit:   defaultQueueLimit,
+		projectLimits:       projectLimits,
+		defaultProjectLimit: defaultProjectLimit,
+		softWatermark:       softWatermark,
+		retryAfter:          retryAfter,
+	}
+}
+
+// RetryAfter is how long clients should wait before resubmitting after a
+// full backlog rejected their job.
+func (b *Backlog) RetryAfter() time.Duration {
+	return b.retryAfter
+}
+
+func (b *Backlog) usage(scope, name string, depth int64, limit int) BacklogUsage {
+	u := BacklogUsage{Scope: scope, Name: name, Depth: depth}
+	if limit > 0 {
+		u.Limit = int64(limit)
+		u.Soft = int64(math.Ceil(float64(limit) * b.softWatermark))
+	}
+	return u
+}
+
+func limitFor(limits map[string]int, name string, def int) int {
+	if limit, ok := limits[name]; ok {
+		return limit
+	}
+	return def
+}
+
+// Check returns the usage of the queue and the project a new job would be
+// added to. Unbounded backlogs are not measured. If one backlog cannot be
+// measured, the usage of the other is still returned along with the error.
+func (b *Backlog) Check(ctx context.Context, queueName, projectID string) ([]BacklogUsage, error) {
+	var usages []BacklogUsage
+	var errs []error
+
+	if limit := limitFor(b.queueLimits, queueName, b.defaultQueueLimit); limit > 0 {
+		pipe := b.rdb.Pipeline()
+		waiting := pipe.LLen(ctx, queue.Key(queueName))
+		scheduled := pipe.ZCard(ctx, queue.ScheduledKey(queueName))
+		if _, err := pipe.Exec(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("queue backlog: %w", err))
+		} else {
+			usages = append(usages, b.usage(ScopeQueue, queueName, waiting.Val()+scheduled.Val(), limit))
+		}
+	}
+
+	if limit := limitFor(b.projectLimits, projectID, b.defaultProjectLimit); limit > 0 {
+		var depth int64
+		err := b.db.WithContext(ctx).Model(&models.Job{}).
+			Where("project_id = ? AND status IN ?", projectID, []string{models.StatusQueued, models.StatusScheduled}).
+			Count(&depth).Error
+		if err != nil {
+			errs = append(errs, fmt.Errorf("project backlog: %w", err))
+		} else {
+			usages = append(usages, b.usage(ScopeProject, projectID, depth, limit))
+		}
+	}
+
+	return usages, errors.Join(errs...)
+}
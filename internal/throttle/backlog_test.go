@@ -0,0 +1,38 @@
+package throttle
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+	"jobqueue/internal/models"
+)
+
+func TestBacklogCheckMeasuresProjectWhenRedisFails(t *testing.T) {
+	dsn := os.Getenv("POSTGRES_DSN")
+	if dsn == "" {
+		t.Skip("POSTGRES_DSN environment variable not set, skipping test")
+	}
+	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{Logger: logger.Discard})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&models.Job{}))
+	// Nothing listens on port 1, so every Redis command fails.
+	rdb := redis.NewClient(&redis.Options{Addr: "127.0.0.1:1", MaxRetries: -1, DialTimeout: time.Second})
+	defer rdb.Close()
+
+	projectID := uuid.NewString()
+	b := NewBacklog(db, rdb, nil, 10, map[string]int{projectID: 5}, 0, 0.8, time.Second)
+	usages, err := b.Check(context.Background(), "queue:test", projectID)
+	assert.Error(t, err)
+	require.Len(t, usages, 1)
+	assert.Equal(t, ScopeProject, usages[0].Scope)
+	assert.Equal(t, int64(5), usages[0].Room())
+}
@@ -0,0 +1,76 @@
+package throttle
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"jobqueue/internal/config"
+)
+
+// RateLimiter is a distributed token bucket per job type. Each bucket holds up
+// to Count tokens and refills at Count per Per, so a type may burst up to its
+// limit and then runs at the steady rate.
+type RateLimiter struct {
+	rdb    redis.UniversalClient
+	limits map[string]config.RateLimit
+}
+
+func NewRateLimiter(rdb redis.UniversalClient, limits map[string]config.RateLimit) *RateLimiter {
+	return &RateLimiter{rdb: rdb, limits: limits}
+}
+
+// takeScript refills the bucket KEYS[1] for the time elapsed since it was
+// last touched and takes one token if available. It returns the number of
+// milliseconds to wait before a token will be available, or 0 on success.
+//
+// ARGV: now_ms, capacity, refill interval in ms per token.
+var takeScript = redis.NewScript(`
+local now = tonumber(ARGV[1])
+local capacity = tonumber(ARGV[2])
+local interval = tonumber(ARGV[3])
+
+local bucket = redis.call('HMGET', KEYS[1], 'tokens', 'ts')
+local tokens = tonumber(bucket[1])
+local ts = tonumber(bucket[2])
+if tokens == nil then
+	tokens = capacity
+	ts = now
+end
+
+local elapsed = math.max(0, now - ts)
+tokens = math.min(capacity, tokens + elapsed / interval)
+
+local wait = 0
+if tokens >= 1 then
+	tokens = tokens - 1
+else
+	wait = math.ceil((1 - tokens) * interval)
+end
+
+redis.call('HSET', KEYS[1], 'tokens', tostring(tokens), 'ts', now)
+redis.call('PEXPIRE', KEYS[1], math.ceil(capacity * interval) + 1000)
+return wait
+`)
+
+func bucketKey(jobType string) string {
+	return fmt.Sprintf("ratelimit:type:%s", jobType)
+}
+
+// Take consumes a token for jobType. If the bucket is empty it returns how
+// long to wait before trying again; a zero wait means the job may run now.
+func (l *RateLimiter) Take(ctx context.Context, jobType string) (time.Duration, error) {
+	limit, ok := l.limits[jobType]
+	if !ok {
+		return 0, nil
+	}
+	interval := float64(limit.Per.Milliseconds()) / float64(limit.Count)
+	wait, err := takeScript.Run(ctx, l.rdb, []string{bucketKey(jobType)},
+		time.Now().UnixMilli(), limit.Count, interval,
+	).Int64()
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(wait) * time.Millisecond, nil
+}
@@ -0,0 +1,39 @@
+package throttle
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"jobqueue/internal/config"
+)
+
+func TestRateLimiterTake(t *testing.T) {
+	rdb := testRedis(t)
+	ctx := context.Background()
+	jobType := "test-type-" + time.Now().Format("150405.000000")
+	defer rdb.Del(ctx, bucketKey(jobType))
+
+	l := NewRateLimiter(rdb, map[string]config.RateLimit{jobType: {Count: 3, Per: 300 * time.Millisecond}})
+	for i := 0; i < 3; i++ {
+		wait, err := l.Take(ctx, jobType)
+		require.NoError(t, err)
+		assert.Zero(t, wait, "the bucket must allow a burst of Count")
+	}
+
+	wait, err := l.Take(ctx, jobType)
+	require.NoError(t, err)
+	assert.Greater(t, wait, time.Duration(0))
+	assert.LessOrEqual(t, wait, 100*time.Millisecond)
+
+	time.Sleep(wait + 10*time.Millisecond)
+	wait, err = l.Take(ctx, jobType)
+	require.NoError(t, err)
+	assert.Zero(t, wait, "a token must be back after the refill interval")
+
+	wait, err = l.Take(ctx, "unlimited-"+jobType)
+	require.NoError(t, err)
+	assert.Zero(t, wait)
+}
@@ -0,0 +1,130 @@
+package throttle
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"jobqueue/internal/models"
+)
+
+// Semaphore enforces cluster-wide concurrency limits per job type and,
+// optionally, per project and job type. Slots live in Redis sorted sets keyed
+// by holder with the lease expiry as score, so a slot held by a crashed
+// process frees itself once its lease runs out.
+type Semaphore struct {
+	rdb           redis.UniversalClient
+	lease         time.Duration
+	typeLimits    map[string]int
+	projectLimits map[string]int
+}
+
+func NewSemaphore(rdb redis.UniversalClient, lease time.Duration, typeLimits, projectLimits map[string]int) *Semaphore {
+	return &Semaphore{
+		rdb:           rdb,
+		lease:         lease,
+		typeLimits:    typeLimits,
+		projectLimits: projectLimits,
+	}
+}
+
+// Lease returns how long an acquired slot is held without a refresh.
+func (s *Semaphore) Lease() time.Duration {
+	return s.lease
+}
+
+// acquireScript drops expired holders, then takes a slot for ARGV[4] if one is
+// free. Re-acquiring a slot that is already held just extends it.
+var acquireScript = redis.NewScript(`
+redis.call('ZREMRANGEBYSCORE', KEYS[1], '-inf', ARGV[1])
+if redis.call('ZSCORE', KEYS[1], ARGV[4]) then
+	redis.call('ZADD', KEYS[1], ARGV[2], ARGV[4])
+	redis.call('PEXPIRE', KEYS[1], ARGV[5])
+	return 1
+end
+if redis.call('ZCARD', KEYS[1]) < tonumber(ARGV[3]) then
+	redis.call('ZADD', KEYS[1], ARGV[2], ARGV[4])
+	redis.call('PEXPIRE', KEYS[1], ARGV[5])
+	return 1
+end
+return 0
+`)
+
+// refreshScript extends a slot only if the holder still owns it.
+var refreshScript = redis.NewScript(`
+if redis.call('ZSCORE', KEYS[1], ARGV[2]) then
+	redis.call('ZADD', KEYS[1], ARGV[1], ARGV[2])
+	redis.call('PEXPIRE', KEYS[1], ARGV[3])
+	return 1
+end
+return 0
+`)
+
+func typeKey(jobType string) string {
+	return fmt.Sprintf("semaphore:type:%s", jobType)
+}
+
+func projectKey(projectID, jobType string) string {
+	return fmt.Sprintf("semaphore:project:%s:%s", projectID, jobType)
+}
+
+// keys returns the semaphores that apply to job along with their limits.
+func (s *Semaphore) keys(job models.Job) (keys []string, limits []int) {
+	if limit, ok := s.typeLimits[job.Type]; ok {
+		keys = append(keys, typeKey(job.Type))
+		limits = append(limits, limit)
+	}
+	if limit, ok := s.projectLimits[job.Type]; ok {
+		keys = append(keys, projectKey(job.ProjectID, job.Type))
+		limits = append(limits, limit)
+	}
+	return keys, limits
+}
+
+// Acquire tries to take every slot that applies to job. It returns false
+// without holding anything if any of them is full.
+func (s *Semaphore) Acquire(ctx context.Context, job models.Job) (bool, error) {
+	keys, limits := s.keys(job)
+	now := time.Now()
+	expires := strconv.FormatInt(now.Add(s.lease).UnixMilli(), 10)
+	for i, key := range keys {
+		ok, err := acquireScript.Run(ctx, s.rdb, []string{key},
+			now.UnixMilli(), expires, limits[i], job.ID, s.lease.Milliseconds(),
+		).Int()
+		if err != nil || ok == 0 {
+			s.release(ctx, keys[:i], job.ID)
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// Refresh extends every slot held by job for another lease period.
+func (s *Semaphore) Refresh(ctx context.Context, job models.Job) error {
+	keys, _ := s.keys(job)
+	expires := time.Now().Add(s.lease).UnixMilli()
+	for _, key := range keys {
+		if err := refreshScript.Run(ctx, s.rdb, []string{key}, expires, job.ID, s.lease.Milliseconds()).Err(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Release gives back every slot held by job.
+func (s *Semaphore) Release(ctx context.Context, job models.Job) error {
+	keys, _ := s.keys(job)
+	return s.release(ctx, keys, job.ID)
+}
+
+func (s *Semaphore) release(ctx context.Context, keys []string, holder string) error {
+	var firstErr error
+	for _, key := range keys {
+		if err := s.rdb.ZRem(ctx, key, holder).Err(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
@@ -0,0 +1,116 @@
+package throttle
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"jobqueue/internal/models"
+)
+
+func testRedis(t *testing.T) *redis.Client {
+	t.Helper()
+	redisURL := os.Getenv("REDIS_URL")
+	if redisURL == "" {
+		t.Skip("REDIS_URL environment variable not set, skipping test")
+	}
+	opts, err := redis.ParseURL(redisURL)
+	require.NoError(t, err)
+	rdb := redis.NewClient(opts)
+	t.Cleanup(func() { rdb.Close() })
+	return rdb
+}
+
+func TestSemaphoreLimit(t *testing.T) {
+	rdb := testRedis(t)
+	ctx := context.Background()
+	jobType := "test-type-" + time.Now().Format("150405.000000")
+	defer rdb.Del(ctx, typeKey(jobType))
+
+	s := NewSemaphore(rdb, time.Minute, map[string]int{jobType: 2}, nil)
+	a := models.Job{ID: "a", Type: jobType}
+	b := models.Job{ID: "b", Type: jobType}
+	c := models.Job{ID: "c", Type: jobType}
+
+	for _, job := range []models.Job{a, b} {
+		ok, err := s.Acquire(ctx, job)
+		require.NoError(t, err)
+		assert.True(t, ok)
+	}
+	ok, err := s.Acquire(ctx, c)
+	require.NoError(t, err)
+	assert.False(t, ok, "a job over the limit must be refused")
+
+	require.NoError(t, s.Release(ctx, a))
+	ok, err = s.Acquire(ctx, c)
+	require.NoError(t, err)
+	assert.True(t, ok, "a released slot must be free again")
+}
+
+func TestSemaphoreLeaseExpiry(t *testing.T) {
+	rdb := testRedis(t)
+	ctx := context.Background()
+	jobType := "test-type-" + time.Now().Format("150405.000000")
+	defer rdb.Del(ctx, typeKey(jobType))
+
+	s := NewSemaphore(rdb, 200*time.Millisecond, map[string]int{jobType: 1}, nil)
+	dead := models.Job{ID: "dead", Type: jobType}
+	next := models.Job{ID: "next", Type: jobType}
+
+	ok, err := s.Acquire(ctx, dead)
+	require.NoError(t, err)
+	require.True(t, ok)
+	ok, err = s.Acquire(ctx, next)
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	// The holder never refreshes or releases, as if its process died.
+	time.Sleep(300 * time.Millisecond)
+	ok, err = s.Acquire(ctx, next)
+	require.NoError(t, err)
+	assert.True(t, ok, "a dead holder's slot must free once its lease expires")
+}
+
+func TestSemaphoreReacquireExtendsKey(t *testing.T) {
+	rdb := testRedis(t)
+	ctx := context.Background()
+	jobType := "test-type-" + time.Now().Format("150405.000000")
+	defer rdb.Del(ctx, typeKey(jobType))
+
+	s := NewSemaphore(rdb, time.Minute, map[string]int{jobType: 1}, nil)
+	job := models.Job{ID: "a", Type: jobType}
+	ok, err := s.Acquire(ctx, job)
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	require.NoError(t, rdb.PExpire(ctx, typeKey(jobType), 50*time.Millisecond).Err())
+	ok, err = s.Acquire(ctx, job)
+	require.NoError(t, err)
+	require.True(t, ok)
+	assert.Greater(t, rdb.PTTL(ctx, typeKey(jobType)).Val(), 30*time.Second)
+}
+
+func TestSemaphoreProjectFullHoldsNothing(t *testing.T) {
+	rdb := testRedis(t)
+	ctx := context.Background()
+	jobType := "test-type-" + time.Now().Format("150405.000000")
+	defer rdb.Del(ctx, typeKey(jobType), projectKey("p1", jobType))
+
+	s := NewSemaphore(rdb, time.Minute, map[string]int{jobType: 5}, map[string]int{jobType: 1})
+	a := models.Job{ID: "a", Type: jobType, ProjectID: "p1"}
+	b := models.Job{ID: "b", Type: jobType, ProjectID: "p1"}
+
+	ok, err := s.Acquire(ctx, a)
+	require.NoError(t, err)
+	require.True(t, ok)
+	ok, err = s.Acquire(ctx, b)
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	assert.Equal(t, redis.Nil, rdb.ZScore(ctx, typeKey(jobType), b.ID).Err(), "the type slot taken before the project check must be given back")
+	assert.Equal(t, int64(1), rdb.ZCard(ctx, typeKey(jobType)).Val())
+}
@@ -0,0 +1,328 @@
+// Package usage meters what each project uses, for billing, and enforces
+// monthly job quotas.
+package usage
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"jobqueue/internal/models"
+)
+
+// Counters kept per project, day and job type.
+const (
+	CounterSubmitted  = "submitted"
+	CounterExecuted   = "executed"    // finished runs, successful or not
+	CounterFailed     = "failed"      // failed runs
+	CounterDurationMs = "duration_ms" // total run time
+)
+
+// Usage counters live in Redis until they are flushed. All keys share a hash
+// tag so the scripts can touch several of them on Redis Cluster.
+const (
+	pendingKey   = "{usage}:pending"
+	dayKeyPrefix = "{usage}:day:"
+)
+
+func dayKey(day, projectID string) string {
+	return dayKeyPrefix + day + ":" + projectID
+}
+
+func monthKey(month, projectID string) string {
+	return "{usage}:month:" + month + ":" + projectID
+}
+
+const (
+	dayLayout   = "2006-01-02"
+	monthLayout = "2006-01"
+)
+
+// addScript increments the counters of KEYS[1] and marks it for flushing.
+//
+// ARGV: field, amount, field, amount, ...
+var addScript = redis.NewScript(`
+for i = 1, #ARGV, 2 do
+	redis.call('HINCRBY', KEYS[1], ARGV[i], ARGV[i + 1])
+end
+redis.call('SADD', KEYS[2], KEYS[1])
+return 1
+`)
+
+// takeScript removes the counters of KEYS[1] and returns them, so that each
+// increment is flushed exactly once whichever process flushes.
+var takeScript = redis.NewScript(`
+local data = redis.call('HGETALL', KEYS[1])
+redis.call('DEL', KEYS[1])
+redis.call('SREM', KEYS[2], KEYS[1])
+return data
+`)
+
+// reserveScript adds ARGV[1] to the month's counter KEYS[1] unless that
+// would exceed the quota ARGV[2] (zero is unlimited). A missing counter starts
+// from ARGV[4], the usage already flushed to Postgres.
+//
+// Returns {reserved, used}.
+var reserveScript = redis.NewScript(`
+local n = tonumber(ARGV[1])
+local limit = tonumber(ARGV[2])
+if redis.call('EXISTS', KEYS[1]) == 0 then
+	redis.call('SET', KEYS[1], ARGV[4], 'PX', ARGV[3])
+end
+local used = tonumber(redis.call('GET', KEYS[1]))
+if limit > 0 and used + n > limit then
+	return {0, used}
+end
+return {1, redis.call('INCRBY', KEYS[1], n)}
+`)
+
+// monthTTL keeps a month's quota counter until the month is surely over.
+const monthTTL = 32 * 24 * time.Hour
+
+// Meter counts usage in Redis and flushes it to daily rows in Postgres.
+// Counting never fails the operation being counted: errors are logged.
+type Meter struct {
+	db     *gorm.DB
+	rdb    redis.UniversalClient
+	quotas map[string]int
+	quota  int
+	logger *zap.Logger
+}
+
+// NewMeter enforces quotas (project ID -> jobs per month) and defaultQuota
+// for projects not listed; zero is unlimited.
+func NewMeter(db *gorm.DB, rdb redis.UniversalClient, quotas map[string]int, defaultQuota int, logger *zap.Logger) *Meter {
+	return &Meter{
+		db:     db,
+		rdb:    rdb,
+		quotas: quotas,
+		quota:  defaultQuota,
+		logger: logger.With(zap.String("component", "usage")),
+	}
+}
+
+// Submitted counts n jobs of jobType submitted to projectID.
+func (m *Meter) Submitted(ctx context.Context, projectID, jobType string, n int) {
+	m.add(ctx, projectID, jobType, CounterSubmitted, int64(n))
+}
+
+// Executed counts a finished run of job that took duration milliseconds.
+func (m *Meter) Executed(ctx context.Context, job models.Job, failed bool, duration int64) {
+	counters := []interface{}{CounterExecuted, int64(1), CounterDurationMs, duration}
+	if failed {
+		counters = append(counters, CounterFailed, int64(1))
+	}
+	m.add(ctx, job.ProjectID, job.Type, counters...)
+}
+
+// add increments counter, amount pairs for projectID and jobType today.
+func (m *Meter) add(ctx context.Context, projectID, jobType string, counters ...interface{}) {
+	args := make([]interface{}, 0, len(counters))
+	for i := 0; i < len(counters); i += 2 {
+		args = append(args, jobType+":"+counters[i].(string), counters[i+1])
+	}
+	key := dayKey(time.Now().UTC().Format(dayLayout), projectID)
+	if err := addScript.Run(ctx, m.rdb, []string{key, pendingKey}, args...).Err(); err != nil {
+		m.logger.Error("failed to count usage", zap.Error(err), zap.String("project_id", projectID), zap.String("job_type", jobType))
+	}
+}
+
+// Run flushes the counters every interval until ctx is done, and once more
+// on the way out.
+func (m *Meter) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			if err := m.Flush(context.WithoutCancel(ctx)); err != nil {
+				m.logger.Error("failed to flush usage", zap.Error(err))
+			}
+			return
+		case <-ticker.C:
+			if err := m.Flush(ctx); err != nil {
+				m.logger.Error("failed to flush usage", zap.Error(err))
+			}
+		}
+	}
+}
+
+// Flush moves the counters from Redis into DailyUsage rows. Counters whose
+// rows cannot be written are put back to be flushed next time.
+func (m *Meter) Flush(ctx context.Context) error {
+	keys, err := m.rdb.SMembers(ctx, pendingKey).Result()
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		data, err := takeScript.Run(ctx, m.rdb, []string{key, pendingKey}).StringSlice()
+		if err != nil {
+			return err
+		}
+		rows, err := parseCounters(key, data)
+		if err != nil {
+			m.logger.Error("dropping malformed usage counters", zap.Error(err), zap.String("key", key))
+			continue
+		}
+		if len(rows) == 0 {
+			continue
+		}
+		if err := m.upsert(ctx, rows); err != nil {
+			args := make([]interface{}, len(data))
+			for i, v := range data {
+				args[i] = v
+			}
+			if restoreErr := addScript.Run(ctx, m.rdb, []string{key, pendingKey}, args...).Err(); restoreErr != nil {
+				m.logger.Error("lost usage counters", zap.Error(restoreErr), zap.String("key", key), zap.Strings("counters", data))
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *Meter) upsert(ctx context.Context, rows []models.DailyUsage) error {
+	return m.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "project_id"}, {Name: "day"}, {Name: "job_type"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{
+			"submitted":   gorm.Expr("daily_usages.submitted + excluded.submitted"),
+			"executed":    gorm.Expr("daily_usages.executed + excluded.executed"),
+			"failed":      gorm.Expr("daily_usages.failed + excluded.failed"),
+			"duration_ms": gorm.Expr("daily_usages.duration_ms + excluded.duration_ms"),
+			"updated_at":  gorm.Expr("excluded.updated_at"),
+		}),
+	}).Create(&rows).Error
+}
+
+// parseCounters turns the fields of a day key ("<type>:<counter>", amount,
+// ...) into one row per job type.
+func parseCounters(key string, data []string) ([]models.DailyUsage, error) {
+	rest := strings.TrimPrefix(key, dayKeyPrefix)
+	dayStr, projectID, ok := strings.Cut(rest, ":")
+	if !ok {
+		return nil, fmt.Errorf("unexpected key %q", key)
+	}
+	day, err := time.Parse(dayLayout, dayStr)
+	if err != nil {
+		return nil, err
+	}
+
+	byType := make(map[string]*models.DailyUsage)
+	var rows []models.DailyUsage
+	for i := 0; i+1 < len(data); i += 2 {
+		sep := strings.LastIndex(data[i], ":")
+		if sep < 0 {
+			return nil, fmt.Errorf("unexpected field %q", data[i])
+		}
+		jobType, counter := data[i][:sep], data[i][sep+1:]
+		amount, err := strconv.ParseInt(data[i+1], 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		row, ok := byType[jobType]
+		if !ok {
+			row = &models.DailyUsage{ProjectID: projectID, Day: day, JobType: jobType, UpdatedAt: time.Now()}
+			byType[jobType] = row
+		}
+		switch counter {
+		case CounterSubmitted:
+			row.Submitted += amount
+		case CounterExecuted:
+			row.Executed += amount
+		case CounterFailed:
+			row.Failed += amount
+		case CounterDurationMs:
+			row.DurationMs += amount
+		}
+	}
+	for _, row := range byType {
+		rows = append(rows, *row)
+	}
+	return rows, nil
+}
+
+// Quota is a project's job allowance for a month. A zero Limit is unlimited.
+type Quota struct {
+	Month string `json:"month"`
+	Used  int64  `json:"used"`
+	Limit int64  `json:"limit"`
+}
+
+// Reset returns when the quota's month ends.
+func (q Quota) Reset() time.Time {
+	start, _ := time.Parse(monthLayout, q.Month)
+	return start.AddDate(0, 1, 0)
+}
+
+// LimitFor returns projectID's monthly job quota, zero if unlimited.
+func (m *Meter) LimitFor(projectID string) int64 {
+	if limit, ok := m.quotas[projectID]; ok {
+		return int64(limit)
+	}
+	return int64(m.quota)
+}
+
+// Reserve takes n jobs from projectID's quota for this month. It reports
+// false, without taking anything, if that would exceed the quota.
+func (m *Meter) Reserve(ctx context.Context, projectID string, n int64) (Quota, bool, error) {
+	now := time.Now().UTC()
+	q := Quota{Month: now.Format(monthLayout), Limit: m.LimitFor(projectID)}
+	key := monthKey(q.Month, projectID)
+
+	var seed int64
+	exists, err := m.rdb.Exists(ctx, key).Result()
+	if err != nil {
+		return q, false, err
+	}
+	if exists == 0 {
+		// The counter expired or Redis lost it: start from what has been
+		// flushed. Submits not flushed yet are missed, which is at most one
+		// flush interval's worth.
+		if seed, err = m.flushedSubmits(ctx, projectID, now); err != nil {
+			return q, false, err
+		}
+	}
+
+	res, err := reserveScript.Run(ctx, m.rdb, []string{key}, n, q.Limit, monthTTL.Milliseconds(), seed).Int64Slice()
+	if err != nil {
+		return q, false, err
+	}
+	q.Used = res[1]
+	return q, res[0] == 1, nil
+}
+
+// Release gives back n jobs reserved this month whose submit then failed.
+func (m *Meter) Release(ctx context.Context, projectID string, n int64) {
+	key := monthKey(time.Now().UTC().Format(monthLayout), projectID)
+	if err := m.rdb.DecrBy(ctx, key, n).Err(); err != nil {
+		m.logger.Error("failed to release quota", zap.Error(err), zap.String("project_id", projectID))
+	}
+}
+
+// Current returns projectID's quota for this month without taking from it.
+func (m *Meter) Current(ctx context.Context, projectID string) (Quota, error) {
+	now := time.Now().UTC()
+	q := Quota{Month: now.Format(monthLayout), Limit: m.LimitFor(projectID)}
+	used, err := m.rdb.Get(ctx, monthKey(q.Month, projectID)).Int64()
+	if err == redis.Nil {
+		used, err = m.flushedSubmits(ctx, projectID, now)
+	}
+	q.Used = used
+	return q, err
+}
+
+func (m *Meter) flushedSubmits(ctx context.Context, projectID string, now time.Time) (int64, error) {
+	start := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	var total int64
+	err := m.db.WithContext(ctx).Model(&models.DailyUsage{}).
+		Where("project_id = ? AND day >= ?", projectID, start).
+		Select("COALESCE(SUM(submitted), 0)").
+		Scan(&total).Error
+	return total, err
+}
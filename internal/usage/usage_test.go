@@ -0,0 +1,39 @@
+package usage
+
+import (
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseCounters(t *testing.T) {
+	key := dayKey("2026-03-14", "6f1c2b9e-0000-4000-8000-000000000001")
+	rows, err := parseCounters(key, []string{
+		"email:send:submitted", "3",
+		"email:send:executed", "2",
+		"email:send:failed", "1",
+		"email:send:duration_ms", "450",
+		"report:submitted", "1",
+	})
+	require.NoError(t, err)
+	require.Len(t, rows, 2)
+	sort.Slice(rows, func(i, j int) bool { return rows[i].JobType < rows[j].JobType })
+
+	assert.Equal(t, "6f1c2b9e-0000-4000-8000-000000000001", rows[0].ProjectID)
+	assert.Equal(t, time.Date(2026, 3, 14, 0, 0, 0, 0, time.UTC), rows[0].Day)
+	assert.Equal(t, "email:send", rows[0].JobType)
+	assert.Equal(t, []int64{3, 2, 1, 450}, []int64{rows[0].Submitted, rows[0].Executed, rows[0].Failed, rows[0].DurationMs})
+	assert.Equal(t, "report", rows[1].JobType)
+	assert.Equal(t, int64(1), rows[1].Submitted)
+
+	_, err = parseCounters("{usage}:day:nonsense", nil)
+	assert.Error(t, err)
+}
+
+func TestQuotaReset(t *testing.T) {
+	q := Quota{Month: "2026-12"}
+	assert.Equal(t, time.Date(2027, 1, 1, 0, 0, 0, 0, time.UTC), q.Reset())
+}
@@ -2,41 +2,63 @@ package workers
 
 import (
 	"context"
+	"errors"
+	"sync"
 	"time"
 
 	"github.com/go-redis/redis/v8"
 	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"jobqueue/internal/models"
 	"jobqueue/internal/monitoring"
+	"jobqueue/internal/queue"
 )
 
+// AutoScaler resizes a pool according to the policies in its ScalingConfig.
 type AutoScaler struct {
-	pool        *Pool
-	rdb         *redis.Client
-	metrics     *monitoring.Metrics
-	logger      *zap.Logger
-	interval    time.Duration
-	scaleUp     int64
-	scaleDown   int64
-	scaleUpInc  int
-	scaleDownInc int
+	pool    *Pool
+	mu      sync.Mutex
+	cfg     ScalingConfig
+	db      *gorm.DB
+	rdb     redis.UniversalClient
+	metrics *monitoring.Metrics
+	logger  *zap.Logger
+
+	last       queue.Stats
+	lastAt     time.Time
+	lastUp     time.Time
+	lastChange time.Time
 }
 
-func NewAutoScaler(pool *Pool, rdb *redis.Client, metrics *monitoring.Metrics, logger *zap.Logger) *AutoScaler {
+func NewAutoScaler(pool *Pool, cfg ScalingConfig, db *gorm.DB, rdb redis.UniversalClient, metrics *monitoring.Metrics, logger *zap.Logger) *AutoScaler {
+	_, queueName := pool.GetStats()
 	return &AutoScaler{
-		pool:        pool,
-		rdb:         rdb,
-		metrics:     metrics,
-		logger:      logger,
-		interval:    5 * time.Second,  // Check every 5 seconds
-		scaleUp:     20,               // Scale up if queue length > 20
-		scaleDown:   5,                // Scale down if queue length < 5
-		scaleUpInc:  2,                // Add 2 workers at a time
-		scaleDownInc: 1,                // Remove 1 worker at a time
+		pool:    pool,
+		cfg:     cfg,
+		db:      db,
+		rdb:     rdb,
+		metrics: metrics,
+		logger:  logger.With(zap.String("queue", queueName)),
 	}
 }
 
+// Config returns the scaler's current config.
+func (as *AutoScaler) Config() ScalingConfig {
+	as.mu.Lock()
+	defer as.mu.Unlock()
+	return as.cfg
+}
+
+// SetConfig replaces the scaler's config. It takes effect at the next tick.
+func (as *AutoScaler) SetConfig(cfg ScalingConfig) {
+	as.mu.Lock()
+	defer as.mu.Unlock()
+	as.cfg = cfg
+}
+
 func (as *AutoScaler) Run(ctx context.Context) {
-	ticker := time.NewTicker(as.interval)
+	interval := as.Config().Interval
+	ticker := time.NewTicker(time.Duration(interval))
 	defer ticker.Stop()
 
 	as.logger.Info("autoscaler started")
@@ -47,22 +69,143 @@ func (as *AutoScaler) Run(ctx context.Context) {
 			as.logger.Info("autoscaler stopped")
 			return
 		case <-ticker.C:
-			numWorkers, queueName := as.pool.GetStats()
-			length, err := as.rdb.LLen(ctx, queueName).Result()
+			sample, err := as.sample(ctx)
 			if err != nil {
-				as.logger.Error("failed to get queue length", zap.Error(err))
+				as.logger.Error("failed to sample queue", zap.Error(err))
 				continue
 			}
+			as.metrics.QueueLength.WithLabelValues(sample.Queue).Set(float64(sample.Length))
+			cfg := as.Config()
+			as.evaluate(cfg, sample)
+			if cfg.Interval != interval {
+				interval = cfg.Interval
+				ticker.Reset(time.Duration(interval))
+			}
+		}
+	}
+}
 
-			as.metrics.QueueLength.WithLabelValues(queueName).Set(float64(length))
+// sample measures the queue. Rates are derived from the change since the
+// previous sample: jobs acknowledged is the completion rate, and that plus
+// the growth of waiting and in-flight jobs is the arrival rate.
+func (as *AutoScaler) sample(ctx context.Context) (Sample, error) {
+	numWorkers, queueName := as.pool.GetStats()
+	stats, err := queue.ReadStats(ctx, as.rdb, queueName)
+	if err != nil {
+		return Sample{}, err
+	}
 
-			as.logger.Debug("checking queue length", zap.Int64("length", length), zap.Int("workers", numWorkers))
+	now := time.Now()
+	s := Sample{
+		Now:      now,
+		Queue:    queueName,
+		Workers:  numWorkers,
+		Length:   stats.Length,
+		InFlight: stats.InFlight,
+	}
+	if !as.lastAt.IsZero() && stats.Acked >= as.last.Acked {
+		elapsed := now.Sub(as.lastAt).Seconds()
+		completed := float64(stats.Acked - as.last.Acked)
+		grown := float64(stats.Length + stats.InFlight - as.last.Length - as.last.InFlight)
+		s.CompletionRate = completed / elapsed
+		s.ArrivalRate = max(0, (completed+grown)/elapsed)
+		s.HasRates = true
+	}
+	as.last, as.lastAt = stats, now
 
-			if length > as.scaleUp {
-				as.pool.ScaleUp(as.scaleUpInc)
-			} else if length < as.scaleDown {
-				as.pool.ScaleDown(as.scaleDownInc)
-			}
+	if as.Config().WaitTime != nil {
+		wait, err := as.oldestWait(ctx, queueName, now)
+		if err != nil {
+			return Sample{}, err
+		}
+		s.OldestWait = wait
+	}
+	return s, nil
+}
+
+// oldestWait returns how long the job at the front of the queue has been
+// queued, going by when its row was last updated.
+func (as *AutoScaler) oldestWait(ctx context.Context, queueName string, now time.Time) (time.Duration, error) {
+	jobID, err := queue.Oldest(ctx, as.rdb, queueName)
+	if errors.Is(err, redis.Nil) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	var job models.Job
+	err = as.db.WithContext(ctx).Select("updated_at").Where("id = ?", jobID).Take(&job).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return now.Sub(job.UpdatedAt), nil
+}
+
+// evaluate asks every policy for a pool size, takes the largest and resizes
+// the pool if the cooldowns allow it.
+func (as *AutoScaler) evaluate(cfg ScalingConfig, s Sample) {
+	desired, reason := -1, ""
+	for _, p := range cfg.Policies() {
+		n, ok := p.Desired(s)
+		if ok && n > desired {
+			desired, reason = n, p.Name()
+		}
+	}
+	if desired < 0 {
+		return // No policy had an opinion.
+	}
+	min, max := as.pool.Bounds()
+	desired = clamp(desired, min, max)
+	as.metrics.DesiredWorkers.WithLabelValues(s.Queue).Set(float64(desired))
+
+	fields := []zap.Field{
+		zap.Int("workers", s.Workers),
+		zap.Int("desired", desired),
+		zap.String("policy", reason),
+		zap.Int64("length", s.Length),
+		zap.Int64("in_flight", s.InFlight),
+		zap.Duration("oldest_wait", s.OldestWait),
+		zap.Float64("arrival_rate", s.ArrivalRate),
+		zap.Float64("completion_rate", s.CompletionRate),
+	}
+	switch {
+	case desired == s.Workers:
+		as.logger.Debug("autoscaler holding", fields...)
+		return
+	case desired > s.Workers && s.Now.Sub(as.lastUp) < time.Duration(cfg.UpCooldown):
+		as.logger.Debug("autoscaler scale-up in cooldown", fields...)
+		return
+	case desired < s.Workers && s.Now.Sub(as.lastChange) < time.Duration(cfg.DownCooldown):
+		as.logger.Debug("autoscaler scale-down in cooldown", fields...)
+		return
+	}
+
+	if cfg.DryRun {
+		as.logger.Info("autoscaler decision (dry run)", fields...)
+	} else {
+		as.logger.Info("autoscaler decision", fields...)
+		if desired > s.Workers {
+			as.pool.ScaleUp(desired - s.Workers)
+		} else {
+			as.pool.ScaleDown(s.Workers - desired)
 		}
 	}
-} 
\ No newline at end of file
+	// Dry runs track cooldowns too, so their log matches what would happen.
+	if desired > s.Workers {
+		as.lastUp = s.Now
+	}
+	as.lastChange = s.Now
+}
+
+func clamp(n, min, max int) int {
+	if n < min {
+		return min
+	}
+	if n > max {
+		return max
+	}
+	return n
+}
@@ -0,0 +1,245 @@
+package workers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+const processesKey = "cluster:processes"
+
+func processKey(instance string) string {
+	return "cluster:process:" + instance
+}
+
+// remoteInstance stands in for the process of jobs leased by remote workers,
+// whose liveness is tracked by their leases instead.
+const remoteInstance = "remote"
+
+var instanceID = newInstanceID()
+
+// newInstanceID names this process after its host and pid, plus a random
+// suffix: a container restarted with the same hostname often gets the same
+// pid, and must not be taken for the process it replaced.
+func newInstanceID() string {
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "unknown"
+	}
+	return fmt.Sprintf("%s-%d-%s", hostname, os.Getpid(), uuid.NewString()[:8])
+}
+
+// InstanceID identifies this process among the replicas.
+func InstanceID() string {
+	return instanceID
+}
+
+// WorkerName returns the cluster-wide name of a worker, "<instance>/<queue>/<id>".
+// Remote workers use the instance "remote" and their own name as id.
+func WorkerName(instance, queueName, id string) string {
+	return instance + "/" + queueName + "/" + id
+}
+
+// ParseWorkerName splits a name made by WorkerName.
+func ParseWorkerName(name string) (instance, queueName string, ok bool) {
+	instance, rest, ok := strings.Cut(name, "/")
+	if !ok {
+		return "", "", false
+	}
+	i := strings.LastIndex(rest, "/")
+	if i < 0 {
+		return "", "", false
+	}
+	return instance, rest[:i], true
+}
+
+// ProcessInfo describes a running process and its pools.
+type ProcessInfo struct {
+	Instance    string       `json:"instance"`
+	Hostname    string       `json:"hostname"`
+	PID         int          `json:"pid"`
+	Version     string       `json:"version"`
+	Queues      []string     `json:"queues"`
+	StartedAt   time.Time    `json:"started_at"`
+	HeartbeatAt time.Time    `json:"heartbeat_at"`
+	Pools       []PoolStatus `json:"pools"`
+}
+
+// Heartbeat registers this process in Redis and refreshes its entry every
+// interval. An entry that is not refreshed for three intervals expires, which
+// is how the rest of the cluster learns that the process is gone.
+type Heartbeat struct {
+	info     ProcessInfo
+	interval time.Duration
+	rdb      redis.UniversalClient
+	logger   *zap.Logger
+
+	mu    sync.Mutex
+	pools func() []PoolStatus
+}
+
+func NewHeartbeat(version string, interval time.Duration, rdb redis.UniversalClient, logger *zap.Logger) *Heartbeat {
+	hostname, _ := os.Hostname()
+	return &Heartbeat{
+		info: ProcessInfo{
+			Instance:  InstanceID(),
+			Hostname:  hostname,
+			PID:       os.Getpid(),
+			Version:   version,
+			StartedAt: time.Now(),
+		},
+		interval: interval,
+		rdb:      rdb,
+		logger:   logger.With(zap.String("component", "heartbeat")),
+	}
+}
+
+// ReportPools makes every heartbeat include the pools returned by status.
+func (h *Heartbeat) ReportPools(status func() []PoolStatus) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.pools = status
+}
+
+// Run sends heartbeats until ctx is done, then removes the process's entry.
+func (h *Heartbeat) Run(ctx context.Context) {
+	ticker := time.NewTicker(h.interval)
+	defer ticker.Stop()
+
+	h.beat(ctx)
+	for {
+		select {
+		case <-ctx.Done():
+			h.rdb.ZRem(context.Background(), processesKey, h.info.Instance)
+			h.rdb.Del(context.Background(), processKey(h.info.Instance))
+			return
+		case <-ticker.C:
+			h.beat(ctx)
+		}
+	}
+}
+
+func (h *Heartbeat) beat(ctx context.Context) {
+	info := h.info
+	info.HeartbeatAt = time.Now()
+	h.mu.Lock()
+	pools := h.pools
+	h.mu.Unlock()
+	if pools != nil {
+		info.Pools = pools()
+		for _, p := range info.Pools {
+			info.Queues = append(info.Queues, p.Queue)
+		}
+	}
+
+	data, err := json.Marshal(info)
+	if err != nil {
+		h.logger.Error("failed to encode heartbeat", zap.Error(err))
+		return
+	}
+	if err := h.rdb.Set(ctx, processKey(info.Instance), data, 3*h.interval).Err(); err != nil {
+		h.logger.Error("failed to send heartbeat", zap.Error(err))
+		return
+	}
+	member := &redis.Z{Score: float64(info.HeartbeatAt.Unix()), Member: info.Instance}
+	if err := h.rdb.ZAdd(ctx, processesKey, member).Err(); err != nil {
+		h.logger.Error("failed to send heartbeat", zap.Error(err))
+	}
+}
+
+// LiveInstances returns the processes that have sent a heartbeat within ttl,
+// dropping the rest from the index.
+func LiveInstances(ctx context.Context, rdb redis.UniversalClient, ttl time.Duration) ([]string, error) {
+	cutoff := strconv.FormatInt(time.Now().Add(-ttl).Unix(), 10)
+	if err := rdb.ZRemRangeByScore(ctx, processesKey, "-inf", "("+cutoff).Err(); err != nil {
+		return nil, err
+	}
+	return rdb.ZRange(ctx, processesKey, 0, -1).Result()
+}
+
+// ListProcesses returns every live process, with how long each of its
+// workers has been on its current job.
+func ListProcesses(ctx context.Context, rdb redis.UniversalClient, ttl time.Duration) ([]ProcessInfo, error) {
+	instances, err := LiveInstances(ctx, rdb, ttl)
+	if err != nil {
+		return nil, err
+	}
+
+	cmds := make([]*redis.StringCmd, len(instances))
+	_, err = rdb.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, instance := range instances {
+			cmds[i] = pipe.Get(ctx, processKey(instance))
+		}
+		return nil
+	})
+	if err != nil && err != redis.Nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	processes := []ProcessInfo{}
+	for _, cmd := range cmds {
+		data, err := cmd.Bytes()
+		if err != nil {
+			continue // Expired between the two reads.
+		}
+		var info ProcessInfo
+		if err := json.Unmarshal(data, &info); err != nil {
+			return nil, err
+		}
+		for _, pool := range info.Pools {
+			for i, w := range pool.Workers {
+				if w.StartedAt != nil {
+					pool.Workers[i].RunningFor = Duration(now.Sub(*w.StartedAt).Round(time.Second))
+				}
+			}
+		}
+		processes = append(processes, info)
+	}
+	return processes, nil
+}
+
+// ListPoolStatus returns the pools of every live process.
+func ListPoolStatus(ctx context.Context, rdb redis.UniversalClient, ttl time.Duration) ([]PoolStatus, error) {
+	processes, err := ListProcesses(ctx, rdb, ttl)
+	if err != nil {
+		return nil, err
+	}
+	pools := []PoolStatus{}
+	for _, p := range processes {
+		pools = append(pools, p.Pools...)
+	}
+	return pools, nil
+}
+
+// withClusterQueues adds the queues served by any live process to own, so
+// that a singleton loop running on one process covers the whole cluster.
+func withClusterQueues(ctx context.Context, rdb redis.UniversalClient, own []string, ttl time.Duration) ([]string, error) {
+	processes, err := ListProcesses(ctx, rdb, ttl)
+	if err != nil {
+		return own, err
+	}
+	seen := make(map[string]bool, len(own))
+	queues := append([]string(nil), own...)
+	for _, q := range own {
+		seen[q] = true
+	}
+	for _, p := range processes {
+		for _, q := range p.Queues {
+			if !seen[q] {
+				seen[q] = true
+				queues = append(queues, q)
+			}
+		}
+	}
+	return queues, nil
+}
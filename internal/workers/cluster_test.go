@@ -0,0 +1,27 @@
+package workers
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseWorkerName(t *testing.T) {
+	instance, queueName, ok := ParseWorkerName(WorkerName("host-12", "queue:high", "3"))
+	assert.True(t, ok)
+	assert.Equal(t, "host-12", instance)
+	assert.Equal(t, "queue:high", queueName)
+
+	_, _, ok = ParseWorkerName("host-12")
+	assert.False(t, ok)
+}
+
+func TestNewInstanceIDIsUnique(t *testing.T) {
+	a, b := newInstanceID(), newInstanceID()
+	assert.NotEqual(t, a, b)
+	assert.NotContains(t, a, "/")
+
+	instance, _, ok := ParseWorkerName(WorkerName(a, "queue:high", "3"))
+	assert.True(t, ok)
+	assert.Equal(t, a, instance)
+}
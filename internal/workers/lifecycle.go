@@ -0,0 +1,299 @@
+package workers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"jobqueue/internal/ai"
+	"jobqueue/internal/config"
+	"jobqueue/internal/control"
+	"jobqueue/internal/models"
+	"jobqueue/internal/monitoring"
+	"jobqueue/internal/queue"
+	"jobqueue/internal/tasks"
+	"jobqueue/internal/throttle"
+	"jobqueue/internal/usage"
+)
+
+const (
+	dlqKey = "queue:dlq"
+)
+
+// Lifecycle owns a job's state transitions: claiming it to run, and recording
+// its success or failure with retries and the DLQ. In-process workers and
+// remote workers both go through it so they behave identically.
+type Lifecycle struct {
+	deferDelay time.Duration
+	db         *gorm.DB
+	rdb        redis.UniversalClient
+	ai         *ai.AI
+	sem        *throttle.Semaphore
+	limiter    *throttle.RateLimiter
+	controls   *control.Store
+	meter      *usage.Meter
+	metrics    *monitoring.Metrics
+	logger     *zap.Logger
+}
+
+func NewLifecycle(deferDelay time.Duration, db *gorm.DB, rdb redis.UniversalClient, ai *ai.AI, sem *throttle.Semaphore, limiter *throttle.RateLimiter, controls *control.Store, meter *usage.Meter, metrics *monitoring.Metrics, logger *zap.Logger) *Lifecycle {
+	return &Lifecycle{
+		deferDelay: deferDelay,
+		db:         db,
+		rdb:        rdb,
+		ai:         ai,
+		sem:        sem,
+		limiter:    limiter,
+		controls:   controls,
+		meter:      meter,
+		metrics:    metrics,
+		logger:     logger,
+	}
+}
+
+// Claim moves a job popped from queueName to running on the named worker. It
+// returns false if the job must not run now: it is gone, already handled, or
+// was deferred because its type is paused or a concurrency or rate limit was
+// hit. A claimed job holds its concurrency slots until Release, and stays on
+// the processing list until the caller acks it; a job that is turned away is
+// acked here, unless it could not be put back in Redis, in which case it is
+// left on the processing list for the reaper to re-queue.
+func (l *Lifecycle) Claim(ctx context.Context, queueName, jobID, workerName string) (job models.Job, ok bool) {
+	logger := l.logger.With(zap.String("queue", queueName), zap.String("job_id", jobID))
+	keep := false
+	defer func() {
+		if ok || keep {
+			return
+		}
+		if err := queue.Ack(context.Background(), l.rdb, queueName, jobID); err != nil {
+			logger.Error("failed to ack unclaimed job", zap.Error(err))
+		}
+	}()
+
+	tx := l.db.Begin()
+	if tx.Error != nil {
+		logger.Error("failed to begin transaction", zap.Error(tx.Error))
+		return models.Job{}, false
+	}
+	defer tx.Rollback() // Rollback is ignored if tx is committed
+
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&job, "id = ?", jobID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			logger.Warn("job not found in db, maybe deleted")
+			return models.Job{}, false
+		}
+		logger.Error("failed to get job from db", zap.Error(err))
+		return models.Job{}, false
+	}
+
+	if job.Status != models.StatusQueued && job.Status != models.StatusScheduled {
+		logger.Warn("job was already processed", zap.String("status", job.Status))
+		return models.Job{}, false // Idempotency check
+	}
+
+	typeState, err := l.controls.Get(ctx, control.KindType, job.Type)
+	if err != nil {
+		logger.Warn("failed to read job type state", zap.Error(err), zap.String("job_type", job.Type))
+	}
+	if typeState == control.StatePaused {
+		keep = !l.deferJob(tx, queueName, job, "paused", config.PausedJobDelay)
+		return models.Job{}, false
+	}
+
+	// A concurrency limit guards something that breaks when overloaded, so
+	// a slot that cannot be confirmed is not taken and the job is deferred.
+	// A rate limit only paces a type, so below, an error lets the job run
+	// rather than stalling every job of the type.
+	acquired, err := l.sem.Acquire(ctx, job)
+	if err != nil {
+		logger.Error("failed to acquire concurrency slot", zap.Error(err))
+	}
+	if !acquired {
+		keep = !l.deferJob(tx, queueName, job, "concurrency", l.deferDelay)
+		return models.Job{}, false
+	}
+
+	wait, err := l.limiter.Take(ctx, job.Type)
+	if err != nil {
+		logger.Error("failed to consult rate limiter", zap.Error(err))
+	}
+	if wait > 0 {
+		l.Release(job)
+		keep = !l.deferJob(tx, queueName, job, "rate_limit", wait)
+		return models.Job{}, false
+	}
+
+	job.Status = models.StatusRunning
+	job.WorkerID = workerName
+	if err := tx.Save(&job).Error; err != nil {
+		logger.Error("failed to update job status to running", zap.Error(err))
+		l.Release(job)
+		return models.Job{}, false
+	}
+	if err := tx.Commit().Error; err != nil {
+		logger.Error("failed to commit transaction", zap.Error(err))
+		l.Release(job)
+		return models.Job{}, false
+	}
+	return job, true
+}
+
+// Release gives back the concurrency slots taken by Claim.
+func (l *Lifecycle) Release(job models.Job) {
+	if err := l.sem.Release(context.Background(), job); err != nil {
+		l.logger.Warn("failed to release concurrency slot", zap.Error(err), zap.String("job_id", job.ID))
+	}
+}
+
+// Refresh extends the concurrency slots of a running job.
+func (l *Lifecycle) Refresh(ctx context.Context, job models.Job) error {
+	return l.sem.Refresh(ctx, job)
+}
+
+// deferJob puts a job that cannot run yet back into the queue's scheduled set
+// for delay instead of failing it. The scheduled entry is written before the
+// status change commits, so a failed commit only means the job is retried as
+// queued. If neither the scheduled set nor the queue can be written, the
+// status is left as it was and deferJob returns false: the job is then only
+// on the processing list, and must not be acked.
+func (l *Lifecycle) deferJob(tx *gorm.DB, queueName string, job models.Job, reason string, delay time.Duration) bool {
+	job.Status = models.StatusScheduled
+	job.ExecuteAt = time.Now().Add(delay)
+
+	if err := queue.Schedule(context.Background(), l.rdb, queueName, job.ID, job.ExecuteAt); err != nil {
+		l.logger.Error("failed to defer job, putting it back on the queue", zap.Error(err), zap.String("job_id", job.ID))
+		if err := queue.Push(context.Background(), l.rdb, queueName, job.ID); err != nil {
+			l.logger.Error("failed to re-enqueue deferred job, leaving it to the reaper", zap.Error(err), zap.String("job_id", job.ID))
+			return false
+		}
+		return true
+	}
+	if err := tx.Save(&job).Error; err != nil {
+		l.logger.Error("failed to update job status to scheduled", zap.Error(err))
+		return true
+	}
+	if err := tx.Commit().Error; err != nil {
+		l.logger.Error("failed to commit transaction", zap.Error(err))
+		return true
+	}
+	l.metrics.JobsThrottledTotal.WithLabelValues(queueName, job.Type, reason).Inc()
+	l.logger.Debug("job deferred", zap.String("job_id", job.ID), zap.String("reason", reason))
+	return true
+}
+
+// Complete records a successful run along with the processor's result.
+func (l *Lifecycle) Complete(ctx context.Context, queueName string, job models.Job, duration int64, result []byte) {
+	l.logger.Info("job executed successfully", zap.String("job_id", job.ID), zap.String("queue", queueName))
+	l.recordAttempt(job, models.StatusCompleted, duration, nil)
+	l.meter.Executed(ctx, job, false, duration)
+	updates := models.Job{Status: models.StatusCompleted, Duration: duration, Result: string(result)}
+	if err := l.db.Model(&job).Updates(updates).Error; err != nil {
+		l.logger.Error("failed to update job to completed", zap.Error(err))
+	}
+	l.metrics.JobsProcessedTotal.WithLabelValues(queueName, models.StatusCompleted).Inc()
+	l.metrics.JobDurationSeconds.WithLabelValues(queueName, job.Type).Observe(float64(duration) / 1000)
+}
+
+// recordAttempt appends a run of job to its attempt history. The history is
+// informational, so failures to write it are only logged.
+func (l *Lifecycle) recordAttempt(job models.Job, status string, duration int64, jobErr error) {
+	finished := time.Now()
+	attempt := models.JobAttempt{
+		ID:         uuid.NewString(),
+		JobID:      job.ID,
+		Attempt:    job.RetryCount + 1,
+		Status:     status,
+		Duration:   duration,
+		StartedAt:  finished.Add(-time.Duration(duration) * time.Millisecond),
+		FinishedAt: finished,
+	}
+	if jobErr != nil {
+		attempt.Error = jobErr.Error()
+		var panicErr *tasks.PanicError
+		if errors.As(jobErr, &panicErr) {
+			attempt.Stack = string(panicErr.Stack)
+		}
+	}
+	if err := l.db.Create(&attempt).Error; err != nil {
+		l.logger.Error("failed to record job attempt", zap.Error(err), zap.String("job_id", job.ID))
+	}
+}
+
+// Fail records a failed run. The job is re-queued on queueName until it runs
+// out of retries, or moved to the DLQ at once if the error is permanent.
+func (l *Lifecycle) Fail(ctx context.Context, queueName string, job models.Job, duration int64, jobErr error) {
+	l.logger.Warn("job execution failed", zap.Error(jobErr), zap.String("job_id", job.ID), zap.String("queue", queueName))
+	l.metrics.JobFailuresTotal.WithLabelValues(queueName, job.Type).Inc()
+	var panicErr *tasks.PanicError
+	if errors.As(jobErr, &panicErr) {
+		l.metrics.JobPanicsTotal.WithLabelValues(queueName, job.Type).Inc()
+	}
+	l.recordAttempt(job, models.StatusFailed, duration, jobErr)
+	l.meter.Executed(ctx, job, true, duration)
+	l.metrics.JobDurationSeconds.WithLabelValues(queueName, job.Type).Observe(float64(duration) / 1000)
+
+	job.RetryCount++
+	job.Duration = duration
+	job.LastError = jobErr.Error()
+
+	if job.RetryCount > job.MaxRetries || tasks.IsPermanent(jobErr) {
+		l.logger.Warn("job failed permanently, moving to DLQ", zap.String("job_id", job.ID))
+		job.Status = models.StatusFailed
+		if err := l.db.Save(&job).Error; err != nil {
+			l.logger.Error("failed to update job status to failed", zap.Error(err))
+		}
+		l.metrics.JobsProcessedTotal.WithLabelValues(queueName, models.StatusFailed).Inc()
+
+		jobData, _ := json.Marshal(job)
+		if err := l.rdb.LPush(ctx, dlqKey, jobData).Err(); err != nil {
+			l.logger.Error("failed to push job to DLQ", zap.Error(err))
+		}
+
+		var payload map[string]interface{}
+		_ = json.Unmarshal([]byte(job.Payload), &payload)
+		go l.ai.HandleDLQWithAI(ctx, job.ID, job.Type, payload, job.RetryCount)
+	} else {
+		l.logger.Info("retrying job", zap.String("job_id", job.ID), zap.Int("retry_count", job.RetryCount))
+		job.Status = models.StatusQueued
+		if err := l.db.Save(&job).Error; err != nil {
+			l.logger.Error("failed to update job status for retry", zap.Error(err))
+			return
+		}
+
+		if err := queue.Push(ctx, l.rdb, queueName, job.ID); err != nil {
+			l.logger.Error("failed to re-enqueue job for retry", zap.Error(err))
+			// If this fails, the job is now in a failed state in the DB but not in a queue.
+			// A separate recovery process (reaper) would be needed for a truly robust system.
+		}
+	}
+}
+
+// attemptAborted marks an attempt cut short because its worker stopped.
+const attemptAborted = "aborted"
+
+// Abort puts a job that was interrupted because its worker was stopping back
+// on queueName. The run is recorded but does not count against its retries.
+func (l *Lifecycle) Abort(ctx context.Context, queueName string, job models.Job, duration int64, jobErr error) {
+	l.logger.Warn("job aborted by worker shutdown, requeueing", zap.Error(jobErr), zap.String("job_id", job.ID), zap.String("queue", queueName))
+	l.recordAttempt(job, attemptAborted, duration, jobErr)
+
+	res := l.db.Model(&models.Job{}).
+		Where("id = ? AND status = ?", job.ID, models.StatusRunning).
+		Update("status", models.StatusQueued)
+	if res.Error != nil {
+		l.logger.Error("failed to update aborted job to queued", zap.Error(res.Error), zap.String("job_id", job.ID))
+		return
+	}
+	if res.RowsAffected == 0 {
+		return // Someone else (e.g. the reaper) already moved it on.
+	}
+	if err := queue.Push(ctx, l.rdb, queueName, job.ID); err != nil {
+		l.logger.Error("failed to requeue aborted job", zap.Error(err), zap.String("job_id", job.ID))
+	}
+}
@@ -0,0 +1,230 @@
+package workers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"go.uber.org/zap"
+)
+
+const poolSettingsKey = "pool:settings"
+
+// PoolStatus is a snapshot of one pool in one process.
+type PoolStatus struct {
+	Instance string `json:"instance"`
+	Queue    string `json:"queue"`
+	Min      int    `json:"min"`
+	Max      int    `json:"max"`
+	// StartupMin and StartupMax are the bounds the pool started with, which
+	// runtime settings fall back to for whatever they leave unset.
+	StartupMin  int            `json:"startup_min"`
+	StartupMax  int            `json:"startup_max"`
+	Autoscaling ScalingConfig  `json:"autoscaling"`
+	Workers     []WorkerStatus `json:"workers"`
+}
+
+// WorkerStatus is what a single worker is doing.
+type WorkerStatus struct {
+	ID int `json:"id"`
+	// Name identifies the worker across the cluster; it is what running
+	// jobs record as their WorkerID.
+	Name      string     `json:"name"`
+	Draining  bool       `json:"draining,omitempty"`
+	JobID     string     `json:"job_id,omitempty"`
+	JobType   string     `json:"job_type,omitempty"`
+	StartedAt *time.Time `json:"started_at,omitempty"`
+	// RunningFor is filled in when the status is read back.
+	RunningFor Duration `json:"running_for,omitempty"`
+}
+
+// PoolSettings overrides a queue's pool size and autoscaling at runtime.
+// Unset fields keep each process's startup configuration.
+type PoolSettings struct {
+	Min         *int           `json:"min,omitempty"`
+	Max         *int           `json:"max,omitempty"`
+	Autoscaling *ScalingConfig `json:"autoscaling,omitempty"`
+}
+
+// Validate reports the first problem with s.
+func (s PoolSettings) Validate() error {
+	if s.Min != nil && *s.Min < 0 {
+		return fmt.Errorf("min must not be negative")
+	}
+	if s.Max != nil && *s.Max < 1 {
+		return fmt.Errorf("max must be at least 1")
+	}
+	if s.Min != nil && s.Max != nil && *s.Max < *s.Min {
+		return fmt.Errorf("max (%d) must not be less than min (%d)", *s.Max, *s.Min)
+	}
+	if s.Autoscaling != nil {
+		if err := s.Autoscaling.Validate(); err != nil {
+			return fmt.Errorf("autoscaling: %w", err)
+		}
+	}
+	return nil
+}
+
+// Bounds returns the size limits s gives a pool that started with min and max
+// workers.
+func (s PoolSettings) Bounds(min, max int) (int, int) {
+	if s.Min != nil {
+		min = *s.Min
+	}
+	if s.Max != nil {
+		max = *s.Max
+	}
+	return min, max
+}
+
+// ValidateBounds reports whether s would leave a pool that started with min
+// and max workers with max below min, e.g. by raising only min.
+func (s PoolSettings) ValidateBounds(min, max int) error {
+	if min, max := s.Bounds(min, max); max < min {
+		return fmt.Errorf("max (%d) must not be less than min (%d)", max, min)
+	}
+	return nil
+}
+
+// SetPoolSettings stores the runtime settings for queueName. Every process
+// running a pool for it picks them up within PoolSyncInterval.
+func SetPoolSettings(ctx context.Context, rdb redis.UniversalClient, queueName string, s PoolSettings) error {
+	data, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	return rdb.HSet(ctx, poolSettingsKey, queueName, data).Err()
+}
+
+// DeletePoolSettings drops the runtime settings for queueName, returning its
+// pools to their startup configuration.
+func DeletePoolSettings(ctx context.Context, rdb redis.UniversalClient, queueName string) error {
+	return rdb.HDel(ctx, poolSettingsKey, queueName).Err()
+}
+
+// GetPoolSettings returns the runtime settings of every queue that has them.
+func GetPoolSettings(ctx context.Context, rdb redis.UniversalClient) (map[string]PoolSettings, error) {
+	raw, err := rdb.HGetAll(ctx, poolSettingsKey).Result()
+	if err != nil {
+		return nil, err
+	}
+	settings := make(map[string]PoolSettings, len(raw))
+	for queueName, data := range raw {
+		var s PoolSettings
+		if err := json.Unmarshal([]byte(data), &s); err != nil {
+			return nil, fmt.Errorf("pool settings for %s: %w", queueName, err)
+		}
+		settings[queueName] = s
+	}
+	return settings, nil
+}
+
+// managedPool is a pool and its autoscaler along with the settings they
+// started with.
+type managedPool struct {
+	pool     *Pool
+	scaler   *AutoScaler
+	min, max int
+	scaling  ScalingConfig
+	applied  PoolSettings
+}
+
+// PoolManager applies runtime pool settings from Redis to the pools of this
+// process, so that the admin API can resize pools on every replica. Their
+// status is reported through the process Heartbeat.
+type PoolManager struct {
+	instance string
+	interval time.Duration
+	dryRun   bool
+	pools    []*managedPool
+	rdb      redis.UniversalClient
+	logger   *zap.Logger
+}
+
+// NewPoolManager manages the pools of this process. When dryRun is set every
+// autoscaler stays in dry-run mode whatever the settings.
+func NewPoolManager(interval time.Duration, dryRun bool, rdb redis.UniversalClient, logger *zap.Logger) *PoolManager {
+	return &PoolManager{
+		instance: InstanceID(),
+		interval: interval,
+		dryRun:   dryRun,
+		rdb:      rdb,
+		logger:   logger.With(zap.String("component", "pool_manager")),
+	}
+}
+
+// Add puts a pool and its autoscaler under management. It must be called
+// before Run.
+func (m *PoolManager) Add(pool *Pool, scaler *AutoScaler) {
+	min, max := pool.Bounds()
+	m.pools = append(m.pools, &managedPool{pool: pool, scaler: scaler, min: min, max: max, scaling: scaler.Config()})
+}
+
+// Run syncs settings every interval until ctx is done.
+func (m *PoolManager) Run(ctx context.Context) {
+	ticker := time.NewTicker(m.interval)
+	defer ticker.Stop()
+
+	m.sync(ctx)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			m.sync(ctx)
+		}
+	}
+}
+
+func (m *PoolManager) sync(ctx context.Context) {
+	settings, err := GetPoolSettings(ctx, m.rdb)
+	if err != nil {
+		m.logger.Error("failed to read pool settings", zap.Error(err))
+		return
+	}
+	for _, mp := range m.pools {
+		_, queueName := mp.pool.GetStats()
+		m.apply(mp, settings[queueName])
+	}
+}
+
+// apply brings a pool in line with s, falling back to its startup settings
+// for anything s leaves unset.
+func (m *PoolManager) apply(mp *managedPool, s PoolSettings) {
+	if reflect.DeepEqual(s, mp.applied) {
+		return
+	}
+
+	// The API rejects such settings, but a process may have started with
+	// different bounds from the ones it checked against.
+	min, max := s.Bounds(mp.min, mp.max)
+	if max < min {
+		m.logger.Error("ignoring pool settings with max below min", zap.Int("min", min), zap.Int("max", max))
+		return
+	}
+	scaling := mp.scaling
+	if s.Autoscaling != nil {
+		scaling = *s.Autoscaling
+	}
+	scaling.DryRun = scaling.DryRun || m.dryRun
+
+	mp.pool.SetBounds(min, max)
+	mp.scaler.SetConfig(scaling)
+	mp.applied = s
+}
+
+// Status reports every managed pool.
+func (m *PoolManager) Status() []PoolStatus {
+	statuses := make([]PoolStatus, 0, len(m.pools))
+	for _, mp := range m.pools {
+		status := mp.pool.Status()
+		status.Instance = m.instance
+		status.StartupMin, status.StartupMax = mp.min, mp.max
+		status.Autoscaling = mp.scaler.Config()
+		statuses = append(statuses, status)
+	}
+	return statuses
+}
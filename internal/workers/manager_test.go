@@ -0,0 +1,59 @@
+package workers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func intPtr(n int) *int { return &n }
+
+func TestPoolSettingsBounds(t *testing.T) {
+	tests := []struct {
+		settings PoolSettings
+		min, max int
+		valid    bool
+	}{
+		{PoolSettings{}, 1, 10, true},
+		{PoolSettings{Min: intPtr(4)}, 4, 10, true},
+		{PoolSettings{Max: intPtr(3)}, 1, 3, true},
+		{PoolSettings{Min: intPtr(12)}, 12, 10, false},
+		{PoolSettings{Max: intPtr(1), Min: intPtr(0)}, 0, 1, true},
+	}
+	for _, tt := range tests {
+		min, max := tt.settings.Bounds(1, 10)
+		assert.Equal(t, tt.min, min)
+		assert.Equal(t, tt.max, max)
+		assert.Equal(t, tt.valid, tt.settings.ValidateBounds(1, 10) == nil)
+	}
+}
+
+func TestPoolManagerApply(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	metrics := testMetrics()
+	// A pool with a min of zero starts no workers, so it needs no
+	// lifecycle or Redis.
+	pool := NewPool(ctx, "test", 0, 3, time.Second, nil, nil, nil, nil, metrics, zap.NewNop())
+	scaler := NewAutoScaler(pool, ScalingConfig{}, nil, nil, metrics, zap.NewNop())
+	m := NewPoolManager(time.Minute, false, nil, zap.NewNop())
+	m.Add(pool, scaler)
+	mp := m.pools[0]
+
+	m.apply(mp, PoolSettings{Min: intPtr(5)})
+	min, max := pool.Bounds()
+	assert.Equal(t, 0, min)
+	assert.Equal(t, 3, max, "settings with max below min must be ignored")
+
+	m.apply(mp, PoolSettings{Max: intPtr(2)})
+	min, max = pool.Bounds()
+	assert.Equal(t, 0, min)
+	assert.Equal(t, 2, max)
+
+	status := m.Status()
+	assert.Equal(t, 0, status[0].StartupMin)
+	assert.Equal(t, 3, status[0].StartupMax)
+}
@@ -0,0 +1,188 @@
+package workers
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"time"
+)
+
+// Sample is what the autoscaler knows about a queue and its pool when it asks
+// the policies for a decision.
+type Sample struct {
+	Now     time.Time
+	Queue   string
+	Workers int // workers in this pool
+
+	Length   int64 // jobs waiting on the queue
+	InFlight int64 // jobs being run by any worker, cluster-wide
+	// OldestWait is how long the job at the front of the queue has waited.
+	// It is only measured when a WaitTimePolicy is configured.
+	OldestWait time.Duration
+	// ArrivalRate and CompletionRate are in jobs per second, cluster-wide,
+	// over the last interval. HasRates is false until two samples exist.
+	ArrivalRate    float64
+	CompletionRate float64
+	HasRates       bool
+}
+
+// Policy recommends a number of workers for a pool. ok is false when the
+// policy has no opinion, e.g. because it lacks data.
+type Policy interface {
+	Name() string
+	Desired(s Sample) (workers int, ok bool)
+}
+
+// QueueLengthPolicy adds workers while the queue is longer than UpAbove and
+// removes them once it is shorter than DownBelow. Between the two it holds,
+// so the gap between them is its hysteresis band.
+type QueueLengthPolicy struct {
+	UpAbove   int64 `json:"up_above"`
+	DownBelow int64 `json:"down_below"`
+	UpStep    int   `json:"up_step"`
+	DownStep  int   `json:"down_step"`
+}
+
+func (p *QueueLengthPolicy) Name() string { return "queue_length" }
+
+func (p *QueueLengthPolicy) Desired(s Sample) (int, bool) {
+	switch {
+	case s.Length > p.UpAbove:
+		return s.Workers + p.UpStep, true
+	case s.Length < p.DownBelow:
+		return s.Workers - p.DownStep, true
+	default:
+		return s.Workers, true
+	}
+}
+
+// WaitTimePolicy adds workers while the oldest waiting job has waited longer
+// than MaxWait and removes them once it has waited less than half of that.
+type WaitTimePolicy struct {
+	MaxWait  Duration `json:"max_wait"`
+	UpStep   int      `json:"up_step"`
+	DownStep int      `json:"down_step"`
+}
+
+func (p *WaitTimePolicy) Name() string { return "wait_time" }
+
+func (p *WaitTimePolicy) Desired(s Sample) (int, bool) {
+	maxWait := time.Duration(p.MaxWait)
+	switch {
+	case s.OldestWait > maxWait:
+		return s.Workers + p.UpStep, true
+	case s.OldestWait < maxWait/2:
+		return s.Workers - p.DownStep, true
+	default:
+		return s.Workers, true
+	}
+}
+
+// ThroughputPolicy sizes the pool so that it keeps up with the arrival rate
+// and clears the current backlog within TargetLatency, using the observed
+// completion rate per busy worker as each worker's capacity. Rates are
+// cluster-wide, so with several replicas serving a queue each pool sizes
+// itself for the whole queue; set Share to the fraction this pool should
+// take (e.g. 0.5 with two replicas).
+type ThroughputPolicy struct {
+	TargetLatency Duration `json:"target_latency"`
+	Share         float64  `json:"share,omitempty"`
+}
+
+func (p *ThroughputPolicy) Name() string { return "throughput" }
+
+func (p *ThroughputPolicy) Desired(s Sample) (int, bool) {
+	if !s.HasRates || s.CompletionRate <= 0 || s.InFlight <= 0 {
+		return 0, false
+	}
+	perWorker := s.CompletionRate / float64(s.InFlight)
+	needed := s.ArrivalRate / perWorker
+	if latency := time.Duration(p.TargetLatency).Seconds(); latency > 0 {
+		needed += float64(s.Length) / (latency * perWorker)
+	}
+	if p.Share > 0 {
+		needed *= p.Share
+	}
+	return int(math.Ceil(needed)), true
+}
+
+// SchedulePolicy keeps a minimum number of workers during recurring time
+// windows, e.g. office hours. Outside every window it has no opinion.
+type SchedulePolicy struct {
+	// Timezone is an IANA name; empty means UTC.
+	Timezone string           `json:"timezone,omitempty"`
+	Windows  []ScheduleWindow `json:"windows"`
+}
+
+// ScheduleWindow is a daily window from Start to End ("15:04"), optionally
+// limited to some weekdays ("mon", "tue", ...). A window whose End is before
+// its Start runs past midnight.
+type ScheduleWindow struct {
+	Days  []string `json:"days,omitempty"`
+	Start string   `json:"start"`
+	End   string   `json:"end"`
+	Min   int      `json:"min"`
+}
+
+func (p *SchedulePolicy) Name() string { return "schedule" }
+
+func (p *SchedulePolicy) Desired(s Sample) (int, bool) {
+	loc := time.UTC
+	if p.Timezone != "" {
+		if l, err := time.LoadLocation(p.Timezone); err == nil {
+			loc = l
+		}
+	}
+	now := s.Now.In(loc)
+
+	desired, ok := 0, false
+	for _, w := range p.Windows {
+		if w.contains(now) && (!ok || w.Min > desired) {
+			desired, ok = w.Min, true
+		}
+	}
+	return desired, ok
+}
+
+func (w ScheduleWindow) contains(t time.Time) bool {
+	start, err1 := parseClock(w.Start)
+	end, err2 := parseClock(w.End)
+	if err1 != nil || err2 != nil {
+		return false
+	}
+	minute := t.Hour()*60 + t.Minute()
+	day := t.Weekday()
+	if end <= start && minute < end {
+		// The early part of a window that started the day before.
+		day = (day + 6) % 7
+	}
+	if !w.onDay(day) {
+		return false
+	}
+	if end > start {
+		return minute >= start && minute < end
+	}
+	return minute >= start || minute < end
+}
+
+func (w ScheduleWindow) onDay(day time.Weekday) bool {
+	if len(w.Days) == 0 {
+		return true
+	}
+	name := strings.ToLower(day.String()[:3])
+	for _, d := range w.Days {
+		if strings.ToLower(d) == name {
+			return true
+		}
+	}
+	return false
+}
+
+// parseClock parses "15:04" into minutes after midnight.
+func parseClock(s string) (int, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time of day %q, want HH:MM", s)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
@@ -0,0 +1,53 @@
+package workers
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQueueLengthPolicyHysteresis(t *testing.T) {
+	p := &QueueLengthPolicy{UpAbove: 20, DownBelow: 5, UpStep: 2, DownStep: 1}
+
+	n, _ := p.Desired(Sample{Workers: 3, Length: 21})
+	assert.Equal(t, 5, n)
+	n, _ = p.Desired(Sample{Workers: 3, Length: 10})
+	assert.Equal(t, 3, n)
+	n, _ = p.Desired(Sample{Workers: 3, Length: 4})
+	assert.Equal(t, 2, n)
+}
+
+func TestThroughputPolicy(t *testing.T) {
+	p := &ThroughputPolicy{TargetLatency: Duration(10 * time.Second)}
+
+	_, ok := p.Desired(Sample{Workers: 2})
+	assert.False(t, ok, "no opinion without rates")
+
+	// 4 busy workers complete 2 jobs/s, so each handles 0.5/s. Keeping up
+	// with 3 arrivals/s needs 6; clearing 20 waiting jobs in 10s needs 4 more.
+	n, ok := p.Desired(Sample{Workers: 4, InFlight: 4, Length: 20, ArrivalRate: 3, CompletionRate: 2, HasRates: true})
+	assert.True(t, ok)
+	assert.Equal(t, 10, n)
+}
+
+func TestSchedulePolicy(t *testing.T) {
+	p := &SchedulePolicy{Windows: []ScheduleWindow{
+		{Days: []string{"mon", "tue", "wed", "thu", "fri"}, Start: "08:00", End: "18:00", Min: 4},
+		{Days: []string{"fri"}, Start: "22:00", End: "02:00", Min: 2},
+	}}
+
+	monday := time.Date(2024, 1, 1, 9, 30, 0, 0, time.UTC)
+	n, ok := p.Desired(Sample{Now: monday})
+	assert.True(t, ok)
+	assert.Equal(t, 4, n)
+
+	_, ok = p.Desired(Sample{Now: monday.Add(10 * time.Hour)})
+	assert.False(t, ok)
+
+	// Saturday 01:00 is still inside Friday's overnight window.
+	saturday := time.Date(2024, 1, 6, 1, 0, 0, 0, time.UTC)
+	n, ok = p.Desired(Sample{Now: saturday})
+	assert.True(t, ok)
+	assert.Equal(t, 2, n)
+}
@@ -2,46 +2,71 @@ package workers
 
 import (
 	"context"
+	"sort"
 	"sync"
+	"time"
 
 	"github.com/go-redis/redis/v8"
 	"go.uber.org/zap"
-	"gorm.io/gorm"
-	"jobqueue/internal/ai"
+	"jobqueue/internal/control"
 	"jobqueue/internal/monitoring"
+	"jobqueue/internal/tasks"
 )
 
 type Pool struct {
 	ctx           context.Context
 	cancel        context.CancelFunc
+	runCtx        context.Context
+	abortAll      context.CancelFunc
 	jobQueue      string
 	min, max, num int
+	grace         time.Duration
 	nextWorkerID  int
 	mu            sync.Mutex
 	wg            sync.WaitGroup
-	workers       map[int]context.CancelFunc
+	workers       map[int]*poolWorker
+	draining      map[int]*poolWorker // stopped but still finishing a job
 
 	// Dependencies
-	db      *gorm.DB
-	rdb     *redis.Client
-	ai      *ai.AI
-	metrics *monitoring.Metrics
-	logger  *zap.Logger
+	lifecycle *Lifecycle
+	registry  *tasks.Registry
+	rdb       redis.UniversalClient
+	controls  *control.Store
+	metrics   *monitoring.Metrics
+	logger    *zap.Logger
 }
 
-func NewPool(ctx context.Context, queue string, min, max int, db *gorm.DB, rdb *redis.Client, ai *ai.AI, metrics *monitoring.Metrics, logger *zap.Logger) *Pool {
+// poolWorker is the handle a Pool keeps on a running worker.
+type poolWorker struct {
+	worker *Worker
+	stop   context.CancelFunc // stops it dequeuing
+	abort  context.CancelFunc // cancels its in-flight job
+	done   chan struct{}
+}
+
+// NewPool starts min workers on queue. Cancelling ctx stops them dequeuing;
+// jobs already running get up to grace to finish when the pool is scaled
+// down or shut down.
+func NewPool(ctx context.Context, queue string, min, max int, grace time.Duration, lifecycle *Lifecycle, registry *tasks.Registry, rdb redis.UniversalClient, controls *control.Store, metrics *monitoring.Metrics, logger *zap.Logger) *Pool {
 	pCtx, pCancel := context.WithCancel(ctx)
+	// Jobs must outlive ctx so that a shutdown signal does not abort them.
+	runCtx, abortAll := context.WithCancel(context.WithoutCancel(ctx))
 	pool := &Pool{
 		ctx:          pCtx,
 		cancel:       pCancel,
+		runCtx:       runCtx,
+		abortAll:     abortAll,
 		jobQueue:     queue,
 		min:          min,
 		max:          max,
-		db:           db,
+		grace:        grace,
+		lifecycle:    lifecycle,
+		registry:     registry,
 		rdb:          rdb,
-		ai:           ai,
+		controls:     controls,
 		metrics:      metrics,
-		workers:      make(map[int]context.CancelFunc),
+		workers:      make(map[int]*poolWorker),
+		draining:     make(map[int]*poolWorker),
 		logger:       logger.With(zap.String("queue", queue)),
 		nextWorkerID: 1,
 	}
@@ -57,38 +82,48 @@ func (p *Pool) ScaleUp(n int) {
 		workerID := p.nextWorkerID
 		p.nextWorkerID++
 
-		wCtx, wCancel := context.WithCancel(p.ctx)
-		p.workers[workerID] = wCancel
+		stopCtx, stop := context.WithCancel(p.ctx)
+		runCtx, abort := context.WithCancel(p.runCtx)
+		worker := NewWorker(workerID, p.jobQueue, p.lifecycle, p.registry, p.rdb, p.controls, p.logger)
+		pw := &poolWorker{worker: worker, stop: stop, abort: abort, done: make(chan struct{})}
+		p.workers[workerID] = pw
 		p.num++
 		p.wg.Add(1)
 
-		worker := NewWorker(workerID, p.jobQueue, p.db, p.rdb, p.ai, p.metrics, p.logger)
 		go func(id int) {
 			defer func() {
+				stop()
+				abort()
+				close(pw.done)
 				p.mu.Lock()
 				delete(p.workers, id)
+				delete(p.draining, id)
 				p.mu.Unlock()
 				p.wg.Done()
 			}()
-			worker.Loop(wCtx)
+			worker.Loop(stopCtx, runCtx)
 		}(workerID)
 	}
 	p.metrics.ActiveWorkers.WithLabelValues(p.jobQueue).Set(float64(p.num))
 	p.logger.Info("scaled up", zap.Int("total_workers", p.num))
 }
 
+// ScaleDown stops up to n workers, never going below min. They stop
+// dequeuing at once and finish their current job in the background.
 func (p *Pool) ScaleDown(n int) {
 	p.mu.Lock()
 	defer p.mu.Unlock()
 
 	p.logger.Info("attempting to scale down", zap.Int("n", n), zap.Int("current_workers", p.num))
 	i := 0
-	for id, cancel := range p.workers {
+	for id, pw := range p.workers {
 		if i >= n || p.num <= p.min {
 			break
 		}
-		cancel()
+		pw.stop()
+		go p.drain(id, pw)
 		delete(p.workers, id)
+		p.draining[id] = pw
 		p.num--
 		i++
 	}
@@ -96,11 +131,44 @@ func (p *Pool) ScaleDown(n int) {
 	p.logger.Info("scaled down", zap.Int("total_workers", p.num))
 }
 
+// drain waits up to the grace period for a stopped worker to finish its job,
+// then aborts the job so that the worker requeues it.
+func (p *Pool) drain(id int, pw *poolWorker) {
+	timer := time.NewTimer(p.grace)
+	defer timer.Stop()
+	select {
+	case <-pw.done:
+	case <-timer.C:
+		p.logger.Warn("grace period expired, aborting in-flight job", zap.Int("worker_id", id), zap.Duration("grace", p.grace))
+		pw.abort()
+	}
+}
+
+// Shutdown stops every worker dequeuing, waits up to the grace period for
+// in-flight jobs, then aborts whatever is still running and waits for those
+// jobs to be requeued.
 func (p *Pool) Shutdown() {
 	p.logger.Info("shutting down worker pool")
 	p.cancel()
-	p.wg.Wait()
-	p.logger.Info("worker pool shut down gracefully")
+
+	done := make(chan struct{})
+	go func() {
+		p.wg.Wait()
+		close(done)
+	}()
+
+	timer := time.NewTimer(p.grace)
+	defer timer.Stop()
+	select {
+	case <-done:
+		p.logger.Info("worker pool shut down gracefully")
+	case <-timer.C:
+		p.logger.Warn("grace period expired, aborting in-flight jobs", zap.Duration("grace", p.grace))
+		p.abortAll()
+		<-done
+		p.logger.Info("worker pool shut down")
+	}
+	p.abortAll()
 }
 
 func (p *Pool) GetStats() (numWorkers int, queueName string) {
@@ -108,3 +176,52 @@ func (p *Pool) GetStats() (numWorkers int, queueName string) {
 	defer p.mu.Unlock()
 	return p.num, p.jobQueue
 }
+
+// Bounds returns the smallest and largest size the pool may have.
+func (p *Pool) Bounds() (min, max int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.min, p.max
+}
+
+// SetBounds changes the pool's size limits and scales it into them.
+func (p *Pool) SetBounds(min, max int) {
+	p.mu.Lock()
+	p.min, p.max = min, max
+	num := p.num
+	p.mu.Unlock()
+
+	p.logger.Info("pool bounds changed", zap.Int("min", min), zap.Int("max", max))
+	if num < min {
+		p.ScaleUp(min - num)
+	} else if num > max {
+		p.ScaleDown(num - max)
+	}
+}
+
+// Status reports the pool's bounds and what each of its workers, including
+// those still draining, is running.
+func (p *Pool) Status() PoolStatus {
+	p.mu.Lock()
+	status := PoolStatus{Queue: p.jobQueue, Min: p.min, Max: p.max}
+	workers := make([]*Worker, 0, len(p.workers))
+	for _, pw := range p.workers {
+		workers = append(workers, pw.worker)
+	}
+	draining := make([]*Worker, 0, len(p.draining))
+	for _, pw := range p.draining {
+		draining = append(draining, pw.worker)
+	}
+	p.mu.Unlock()
+
+	for _, w := range workers {
+		status.Workers = append(status.Workers, w.Status())
+	}
+	for _, w := range draining {
+		ws := w.Status()
+		ws.Draining = true
+		status.Workers = append(status.Workers, ws)
+	}
+	sort.Slice(status.Workers, func(i, j int) bool { return status.Workers[i].ID < status.Workers[j].ID })
+	return status
+}
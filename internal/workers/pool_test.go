@@ -0,0 +1,88 @@
+package workers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"jobqueue/internal/models"
+	"jobqueue/internal/queue"
+	"jobqueue/internal/tasks"
+)
+
+// blockingPool starts a one-worker pool whose jobs run until release is
+// closed or their context is cancelled, and submits one job to it.
+func blockingPool(t *testing.T, e *testEnv, grace time.Duration) (*Pool, models.Job, chan struct{}) {
+	t.Helper()
+	jobType := "test-block-" + uuid.NewString()
+	release := make(chan struct{})
+	registry := tasks.NewRegistry()
+	registry.Register(jobType, tasks.ProcessorFunc(func(ctx context.Context, job models.Job) error {
+		select {
+		case <-release:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}))
+
+	// Submitted first so that the pool is shut down before the job is
+	// cleaned up.
+	job := e.submit(t, jobType)
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	pool := NewPool(ctx, e.queue, 0, 1, grace, e.lifecycle, registry, e.rdb, e.controls, testMetrics(), zap.NewNop())
+	t.Cleanup(pool.Shutdown)
+	pool.ScaleUp(1)
+	require.Eventually(t, func() bool {
+		return e.reload(t, job.ID).Status == models.StatusRunning
+	}, 10*time.Second, 20*time.Millisecond)
+	return pool, job, release
+}
+
+func TestPoolScaleDownFinishesJobWithinGrace(t *testing.T) {
+	e := newTestEnv(t)
+	pool, job, release := blockingPool(t, e, 10*time.Second)
+
+	pool.ScaleDown(1)
+	n, _ := pool.GetStats()
+	assert.Zero(t, n)
+	close(release)
+
+	require.Eventually(t, func() bool {
+		return e.reload(t, job.ID).Status == models.StatusCompleted
+	}, 5*time.Second, 20*time.Millisecond, "a draining worker must finish its job")
+	require.Eventually(t, func() bool { return len(pool.Status().Workers) == 0 }, 5*time.Second, 20*time.Millisecond)
+}
+
+func TestPoolScaleDownAbortsJobAfterGrace(t *testing.T) {
+	e := newTestEnv(t)
+	pool, job, _ := blockingPool(t, e, 200*time.Millisecond)
+
+	pool.ScaleDown(1)
+	require.Eventually(t, func() bool {
+		return e.reload(t, job.ID).Status == models.StatusQueued
+	}, 5*time.Second, 20*time.Millisecond, "a job still running after the grace period must be requeued")
+
+	assert.Zero(t, e.reload(t, job.ID).RetryCount, "an aborted run must not count against the retries")
+	attempts := e.attempts(t, job.ID)
+	require.Len(t, attempts, 1)
+	assert.Equal(t, attemptAborted, attempts[0].Status)
+	queued, err := e.rdb.LRange(context.Background(), queue.Key(e.queue), 0, -1).Result()
+	require.NoError(t, err)
+	assert.Contains(t, queued, job.ID)
+}
+
+func TestPoolShutdownAbortsJobAfterGrace(t *testing.T) {
+	e := newTestEnv(t)
+	pool, job, _ := blockingPool(t, e, 200*time.Millisecond)
+
+	pool.Shutdown()
+	stored := e.reload(t, job.ID)
+	assert.Equal(t, models.StatusQueued, stored.Status, "Shutdown must return only once the aborted job is requeued")
+	assert.Zero(t, stored.RetryCount)
+}
@@ -2,39 +2,55 @@ package workers
 
 import (
 	"context"
+	"errors"
 	"time"
 
 	"github.com/go-redis/redis/v8"
 	"go.uber.org/zap"
 	"gorm.io/gorm"
 	"jobqueue/internal/heuristics"
+	"jobqueue/internal/leader"
 	"jobqueue/internal/models"
 	"jobqueue/internal/monitoring"
+	"jobqueue/internal/queue"
 )
 
 type Reaper struct {
 	db          *gorm.DB
-	rdb         *redis.Client
+	rdb         redis.UniversalClient
+	queues      []string
 	metrics     *monitoring.Metrics
 	logger      *zap.Logger
 	interval    time.Duration
 	maxStuckAge time.Duration
+	// processTTL is how long a process may miss heartbeats before the jobs
+	// of its workers are reclaimed; they are checked every processTTL.
+	processTTL time.Duration
+
+	// inFlight remembers what was on each processing list at the previous
+	// pass; an entry still there a whole interval later was orphaned.
+	inFlight map[string]map[string]bool
 }
 
-func NewReaper(db *gorm.DB, rdb *redis.Client, metrics *monitoring.Metrics, logger *zap.Logger) *Reaper {
+func NewReaper(db *gorm.DB, rdb redis.UniversalClient, queues []string, processTTL time.Duration, metrics *monitoring.Metrics, logger *zap.Logger) *Reaper {
 	return &Reaper{
 		db:          db,
 		rdb:         rdb,
+		queues:      queues,
 		metrics:     metrics,
 		logger:      logger.With(zap.String("component", "reaper")),
 		interval:    5 * time.Minute,
 		maxStuckAge: 1 * time.Hour,
+		processTTL:  processTTL,
+		inFlight:    make(map[string]map[string]bool),
 	}
 }
 
 func (r *Reaper) Run(ctx context.Context) {
 	ticker := time.NewTicker(r.interval)
 	defer ticker.Stop()
+	deadTicker := time.NewTicker(r.processTTL)
+	defer deadTicker.Stop()
 
 	r.logger.Info("reaper started")
 
@@ -45,10 +61,65 @@ func (r *Reaper) Run(ctx context.Context) {
 			return
 		case <-ticker.C:
 			r.reapStuckJobs(ctx)
+			r.reapOrphans(ctx)
+		case <-deadTicker.C:
+			r.reapDeadWorkers(ctx)
 		}
 	}
 }
 
+// reapDeadWorkers requeues running jobs whose worker belongs to a process
+// that has stopped sending heartbeats, without waiting for maxStuckAge. Jobs
+// of remote workers are left to their lease expiry.
+func (r *Reaper) reapDeadWorkers(ctx context.Context) {
+	live, err := LiveInstances(ctx, r.rdb, r.processTTL)
+	if err != nil {
+		r.logger.Error("failed to list live processes", zap.Error(err))
+		return
+	}
+	alive := make(map[string]bool, len(live))
+	for _, instance := range live {
+		alive[instance] = true
+	}
+
+	// Jobs claimed within the TTL may belong to a process that has not sent
+	// its first heartbeat yet.
+	var jobs []models.Job
+	claimedBefore := time.Now().Add(-r.processTTL)
+	err = r.db.Where("status = ? AND worker_id <> '' AND updated_at < ?", models.StatusRunning, claimedBefore).Find(&jobs).Error
+	if err != nil {
+		r.logger.Error("failed to query running jobs", zap.Error(err))
+		return
+	}
+
+	for _, job := range jobs {
+		instance, queueName, ok := ParseWorkerName(job.WorkerID)
+		if !ok || instance == remoteInstance || alive[instance] {
+			continue
+		}
+		if !leader.Holds(ctx) {
+			return
+		}
+
+		res := r.db.Model(&models.Job{}).
+			Where("id = ? AND status = ?", job.ID, models.StatusRunning).
+			Update("status", models.StatusQueued)
+		if res.Error != nil {
+			r.logger.Error("failed to update job of dead worker", zap.Error(res.Error), zap.String("job_id", job.ID))
+			continue
+		}
+		if res.RowsAffected == 0 {
+			continue
+		}
+		if err := queue.Requeue(ctx, r.rdb, queueName, job.ID); err != nil {
+			r.logger.Error("failed to re-enqueue job of dead worker", zap.Error(err), zap.String("job_id", job.ID))
+			continue
+		}
+		r.metrics.JobsReapedTotal.WithLabelValues(queueName).Inc()
+		r.logger.Warn("reclaimed job from dead worker", zap.String("job_id", job.ID), zap.String("worker", job.WorkerID))
+	}
+}
+
 func (r *Reaper) reapStuckJobs(ctx context.Context) {
 	r.logger.Info("reaping stuck jobs")
 	var stuckJobs []models.Job
@@ -67,6 +138,12 @@ func (r *Reaper) reapStuckJobs(ctx context.Context) {
 	r.logger.Warn("found stuck jobs", zap.Int("count", len(stuckJobs)))
 
 	for _, job := range stuckJobs {
+		if !leader.Holds(ctx) {
+			return
+		}
+		if instance, _, ok := ParseWorkerName(job.WorkerID); ok && instance == remoteInstance && leaseLive(ctx, r.rdb, job.ID) {
+			continue
+		}
 		tx := r.db.Begin()
 		job.Status = models.StatusQueued
 		if err := tx.Save(&job).Error; err != nil {
@@ -76,7 +153,7 @@ func (r *Reaper) reapStuckJobs(ctx context.Context) {
 		}
 
 		queueName := heuristics.GetPriorityQueue(job.Type)
-		if err := r.rdb.LPush(ctx, queueName, job.ID).Err(); err != nil {
+		if err := queue.Requeue(ctx, r.rdb, queueName, job.ID); err != nil {
 			tx.Rollback()
 			r.logger.Error("failed to re-enqueue reaped job", zap.Error(err), zap.String("job_id", job.ID))
 			continue
@@ -89,4 +166,56 @@ func (r *Reaper) reapStuckJobs(ctx context.Context) {
 		r.metrics.JobsReapedTotal.WithLabelValues(queueName).Inc()
 		r.logger.Info("reaped and re-queued job", zap.String("job_id", job.ID))
 	}
-} 
\ No newline at end of file
+}
+
+// reapOrphans recovers jobs left on a processing list by a worker that died
+// after popping them. Jobs that are still running are left to reapStuckJobs;
+// jobs that already finished are simply dropped from the list.
+func (r *Reaper) reapOrphans(ctx context.Context) {
+	queues, err := withClusterQueues(ctx, r.rdb, r.queues, r.processTTL)
+	if err != nil {
+		r.logger.Error("failed to list cluster queues", zap.Error(err))
+	}
+	for _, queueName := range queues {
+		ids, err := queue.InFlight(ctx, r.rdb, queueName)
+		if err != nil {
+			r.logger.Error("failed to read processing list", zap.Error(err), zap.String("queue", queueName))
+			continue
+		}
+
+		current := make(map[string]bool, len(ids))
+		for _, id := range ids {
+			current[id] = true
+			if !r.inFlight[queueName][id] {
+				continue // first sighting; its worker may still be on it
+			}
+			if !leader.Holds(ctx) {
+				return
+			}
+
+			var job models.Job
+			err := r.db.Select("id", "status").First(&job, "id = ?", id).Error
+			switch {
+			case errors.Is(err, gorm.ErrRecordNotFound):
+				err = queue.Ack(ctx, r.rdb, queueName, id)
+			case err != nil:
+				r.logger.Error("failed to look up orphaned job", zap.Error(err), zap.String("job_id", id))
+				continue
+			case job.Status == models.StatusRunning:
+				continue
+			case job.Status == models.StatusQueued || job.Status == models.StatusScheduled:
+				err = queue.Requeue(ctx, r.rdb, queueName, id)
+				if err == nil {
+					r.metrics.JobsReapedTotal.WithLabelValues(queueName).Inc()
+					r.logger.Info("re-queued orphaned job", zap.String("job_id", id))
+				}
+			default:
+				err = queue.Ack(ctx, r.rdb, queueName, id)
+			}
+			if err != nil {
+				r.logger.Error("failed to clear orphaned job", zap.Error(err), zap.String("job_id", id))
+			}
+		}
+		r.inFlight[queueName] = current
+	}
+}
@@ -0,0 +1,276 @@
+package workers
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"jobqueue/internal/control"
+	"jobqueue/internal/heuristics"
+	"jobqueue/internal/models"
+	"jobqueue/internal/queue"
+	"jobqueue/internal/tasks"
+)
+
+const (
+	// leasesKey is a sorted set of leased job IDs scored by lease expiry in
+	// unix milliseconds.
+	leasesKey = "remote:leases"
+)
+
+func leaseKey(jobID string) string {
+	return "remote:lease:" + jobID
+}
+
+// ErrLeaseNotHeld is returned when a remote worker reports on a job it does
+// not hold a lease on, e.g. because the lease expired and the job was retried.
+var ErrLeaseNotHeld = errors.New("lease not held by this worker")
+
+// Lease is a job handed to a remote worker.
+type Lease struct {
+	Job       models.Job
+	Queue     string
+	Worker    string
+	ExpiresAt time.Time
+}
+
+// RemoteLeases lets workers outside this process take part in job processing.
+// A remote worker leases a job, heartbeats while working on it and reports the
+// outcome; every step goes through the same Lifecycle as in-process workers.
+// Leases that are not renewed in time are failed so the job is retried.
+type RemoteLeases struct {
+	lifecycle *Lifecycle
+	db        *gorm.DB
+	rdb       redis.UniversalClient
+	controls  *control.Store
+	logger    *zap.Logger
+	interval  time.Duration
+}
+
+func NewRemoteLeases(lifecycle *Lifecycle, db *gorm.DB, rdb redis.UniversalClient, controls *control.Store, logger *zap.Logger) *RemoteLeases {
+	return &RemoteLeases{
+		lifecycle: lifecycle,
+		db:        db,
+		rdb:       rdb,
+		controls:  controls,
+		logger:    logger.With(zap.String("component", "remote_leases")),
+		interval:  5 * time.Second,
+	}
+}
+
+// Acquire leases the next runnable job of one of the given types to worker
+// for ttl. It returns nil if there is nothing to do.
+func (r *RemoteLeases) Acquire(ctx context.Context, worker string, types []string, ttl time.Duration) (*Lease, error) {
+	for _, jobType := range types {
+		if !heuristics.IsRemote(jobType) {
+			continue
+		}
+		queueName := heuristics.RemoteQueue(jobType)
+		if state, _ := r.controls.Get(ctx, control.KindQueue, queueName); state == control.StatePaused {
+			continue
+		}
+
+		jobID, err := queue.TryPop(ctx, r.rdb, queueName)
+		if errors.Is(err, redis.Nil) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		job, ok := r.lifecycle.Claim(ctx, queueName, jobID, WorkerName(remoteInstance, queueName, worker))
+		if !ok {
+			continue
+		}
+
+		lease := &Lease{Job: job, Queue: queueName, Worker: worker, ExpiresAt: time.Now().Add(ttl)}
+		if err := r.record(ctx, lease); err != nil {
+			// The job is running in the DB but nobody holds it; hand it
+			// back so it is retried rather than left for the reaper.
+			r.lifecycle.Release(job)
+			r.lifecycle.Fail(ctx, queueName, job, 0, err)
+			queue.Ack(ctx, r.rdb, queueName, jobID)
+			return nil, err
+		}
+		r.logger.Info("job leased", zap.String("job_id", job.ID), zap.String("worker", worker))
+		return lease, nil
+	}
+	return nil, nil
+}
+
+func (r *RemoteLeases) record(ctx context.Context, lease *Lease) error {
+	_, err := r.rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HSet(ctx, leaseKey(lease.Job.ID),
+			"worker", lease.Worker,
+			"queue", lease.Queue,
+			"started", time.Now().UnixMilli(),
+		)
+		pipe.ZAdd(ctx, leasesKey, &redis.Z{Score: float64(lease.ExpiresAt.UnixMilli()), Member: lease.Job.ID})
+		return nil
+	})
+	return err
+}
+
+// leaseLive reports whether a remote worker holds an unexpired lease on
+// jobID.
+func leaseLive(ctx context.Context, rdb redis.UniversalClient, jobID string) bool {
+	expiry, err := rdb.ZScore(ctx, leasesKey, jobID).Result()
+	return err == nil && int64(expiry) > time.Now().UnixMilli()
+}
+
+// lookup returns the lease on jobID if worker holds it.
+func (r *RemoteLeases) lookup(ctx context.Context, worker, jobID string) (*Lease, time.Time, error) {
+	fields, err := r.rdb.HGetAll(ctx, leaseKey(jobID)).Result()
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	if len(fields) == 0 || fields["worker"] != worker {
+		return nil, time.Time{}, ErrLeaseNotHeld
+	}
+	started, _ := strconv.ParseInt(fields["started"], 10, 64)
+
+	var job models.Job
+	if err := r.db.First(&job, "id = ?", jobID).Error; err != nil {
+		return nil, time.Time{}, err
+	}
+	return &Lease{Job: job, Queue: fields["queue"], Worker: worker}, time.UnixMilli(started), nil
+}
+
+// Heartbeat extends worker's lease on jobID by ttl. It also touches the
+// job's updated_at so that the reaper does not take a long-running remote
+// job for a stuck one.
+func (r *RemoteLeases) Heartbeat(ctx context.Context, worker, jobID string, ttl time.Duration) (*Lease, error) {
+	lease, _, err := r.lookup(ctx, worker, jobID)
+	if err != nil {
+		return nil, err
+	}
+	lease.ExpiresAt = time.Now().Add(ttl)
+	n, err := r.rdb.ZAddXX(ctx, leasesKey, &redis.Z{Score: float64(lease.ExpiresAt.UnixMilli()), Member: jobID}).Result()
+	if err != nil {
+		return nil, err
+	}
+	if n == 0 {
+		// ZADD XX reports only additions; make sure the lease still exists.
+		if _, err := r.rdb.ZScore(ctx, leasesKey, jobID).Result(); errors.Is(err, redis.Nil) {
+			return nil, ErrLeaseNotHeld
+		}
+	}
+	err = r.db.WithContext(ctx).Model(&models.Job{}).
+		Where("id = ? AND status = ?", jobID, models.StatusRunning).
+		Update("updated_at", time.Now()).Error
+	if err != nil {
+		r.logger.Warn("failed to touch leased job", zap.Error(err), zap.String("job_id", jobID))
+	}
+	if err := r.lifecycle.Refresh(ctx, lease.Job); err != nil {
+		r.logger.Warn("failed to refresh concurrency slot", zap.Error(err), zap.String("job_id", jobID))
+	}
+	return lease, nil
+}
+
+// Complete records a successful run reported by worker.
+func (r *RemoteLeases) Complete(ctx context.Context, worker, jobID string, result []byte) error {
+	lease, started, err := r.take(ctx, worker, jobID)
+	if err != nil {
+		return err
+	}
+	r.lifecycle.Complete(ctx, lease.Queue, lease.Job, time.Since(started).Milliseconds(), result)
+	r.finish(ctx, lease)
+	return nil
+}
+
+// Fail records a failed run reported by worker. Non-retryable failures go to
+// the DLQ without further attempts.
+func (r *RemoteLeases) Fail(ctx context.Context, worker, jobID, message string, retryable bool) (models.Job, error) {
+	lease, started, err := r.take(ctx, worker, jobID)
+	if err != nil {
+		return models.Job{}, err
+	}
+	jobErr := errors.New(message)
+	if !retryable {
+		jobErr = tasks.Permanent(jobErr)
+	}
+	r.lifecycle.Fail(ctx, lease.Queue, lease.Job, time.Since(started).Milliseconds(), jobErr)
+	r.finish(ctx, lease)
+
+	var job models.Job
+	err = r.db.First(&job, "id = ?", jobID).Error
+	return job, err
+}
+
+// take ends worker's lease on jobID. Removing the job from the lease set is
+// the point of no return, so a report racing with lease expiry is applied
+// exactly once.
+func (r *RemoteLeases) take(ctx context.Context, worker, jobID string) (*Lease, time.Time, error) {
+	lease, started, err := r.lookup(ctx, worker, jobID)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	n, err := r.rdb.ZRem(ctx, leasesKey, jobID).Result()
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	if n == 0 {
+		return nil, time.Time{}, ErrLeaseNotHeld
+	}
+	return lease, started, nil
+}
+
+// finish cleans up after a lease has been taken and its outcome recorded.
+func (r *RemoteLeases) finish(ctx context.Context, lease *Lease) {
+	r.lifecycle.Release(lease.Job)
+	if err := r.rdb.Del(ctx, leaseKey(lease.Job.ID)).Err(); err != nil {
+		r.logger.Warn("failed to delete lease", zap.Error(err), zap.String("job_id", lease.Job.ID))
+	}
+	if err := queue.Ack(ctx, r.rdb, lease.Queue, lease.Job.ID); err != nil {
+		r.logger.Error("failed to ack job", zap.Error(err), zap.String("job_id", lease.Job.ID))
+	}
+}
+
+// Run fails leases whose worker stopped heartbeating.
+func (r *RemoteLeases) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	r.logger.Info("remote lease expiry started")
+
+	for {
+		select {
+		case <-ctx.Done():
+			r.logger.Info("remote lease expiry stopped")
+			return
+		case <-ticker.C:
+			r.expire(ctx)
+		}
+	}
+}
+
+func (r *RemoteLeases) expire(ctx context.Context) {
+	now := strconv.FormatInt(time.Now().UnixMilli(), 10)
+	ids, err := r.rdb.ZRangeByScore(ctx, leasesKey, &redis.ZRangeBy{Min: "-inf", Max: now, Count: 100}).Result()
+	if err != nil {
+		r.logger.Error("failed to read expired leases", zap.Error(err))
+		return
+	}
+
+	for _, jobID := range ids {
+		worker, err := r.rdb.HGet(ctx, leaseKey(jobID), "worker").Result()
+		if err != nil && !errors.Is(err, redis.Nil) {
+			r.logger.Error("failed to read lease", zap.Error(err), zap.String("job_id", jobID))
+			continue
+		}
+		lease, started, err := r.take(ctx, worker, jobID)
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) || errors.Is(err, ErrLeaseNotHeld) {
+				r.rdb.ZRem(ctx, leasesKey, jobID)
+			}
+			continue
+		}
+		r.logger.Warn("remote lease expired", zap.String("job_id", jobID), zap.String("worker", worker))
+		r.lifecycle.Fail(ctx, lease.Queue, lease.Job, time.Since(started).Milliseconds(), errors.New("remote worker lease expired"))
+		r.finish(ctx, lease)
+	}
+}
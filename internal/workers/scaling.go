@@ -0,0 +1,175 @@
+package workers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+)
+
+// Duration is a time.Duration written as a string such as "30s" in JSON.
+type Duration time.Duration
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("duration must be a string such as \"30s\": %w", err)
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+// ScalingConfig configures an AutoScaler. Each policy that is set recommends
+// a pool size; the largest recommendation wins, clamped to the pool's bounds,
+// and is applied only once the relevant cooldown has passed.
+type ScalingConfig struct {
+	Interval Duration `json:"interval"`
+	// UpCooldown is the minimum time between two scale-ups. DownCooldown is
+	// the minimum time after any change before scaling down.
+	UpCooldown   Duration `json:"up_cooldown"`
+	DownCooldown Duration `json:"down_cooldown"`
+	// DryRun logs decisions without resizing the pool.
+	DryRun bool `json:"dry_run,omitempty"`
+
+	QueueLength *QueueLengthPolicy `json:"queue_length,omitempty"`
+	WaitTime    *WaitTimePolicy    `json:"wait_time,omitempty"`
+	Throughput  *ThroughputPolicy  `json:"throughput,omitempty"`
+	Schedule    *SchedulePolicy    `json:"schedule,omitempty"`
+}
+
+// DefaultScalingConfig scales on queue length alone.
+func DefaultScalingConfig() ScalingConfig {
+	return ScalingConfig{
+		Interval:     Duration(5 * time.Second),
+		UpCooldown:   Duration(10 * time.Second),
+		DownCooldown: Duration(30 * time.Second),
+		QueueLength:  &QueueLengthPolicy{UpAbove: 20, DownBelow: 5, UpStep: 2, DownStep: 1},
+	}
+}
+
+// Policies returns the policies that are set.
+func (c ScalingConfig) Policies() []Policy {
+	var policies []Policy
+	if c.QueueLength != nil {
+		policies = append(policies, c.QueueLength)
+	}
+	if c.WaitTime != nil {
+		policies = append(policies, c.WaitTime)
+	}
+	if c.Throughput != nil {
+		policies = append(policies, c.Throughput)
+	}
+	if c.Schedule != nil {
+		policies = append(policies, c.Schedule)
+	}
+	return policies
+}
+
+// Validate reports the first problem with c.
+func (c ScalingConfig) Validate() error {
+	if c.Interval <= 0 {
+		return errors.New("interval must be positive")
+	}
+	if c.UpCooldown < 0 || c.DownCooldown < 0 {
+		return errors.New("cooldowns must not be negative")
+	}
+	if len(c.Policies()) == 0 {
+		return errors.New("at least one policy is required")
+	}
+	if p := c.QueueLength; p != nil && p.DownBelow > p.UpAbove {
+		return errors.New("queue_length: down_below must not exceed up_above")
+	}
+	if p := c.WaitTime; p != nil && p.MaxWait <= 0 {
+		return errors.New("wait_time: max_wait must be positive")
+	}
+	if p := c.Throughput; p != nil && (p.TargetLatency < 0 || p.Share < 0 || p.Share > 1) {
+		return errors.New("throughput: target_latency must not be negative and share must be within [0, 1]")
+	}
+	if p := c.Schedule; p != nil {
+		if p.Timezone != "" {
+			if _, err := time.LoadLocation(p.Timezone); err != nil {
+				return fmt.Errorf("schedule: %w", err)
+			}
+		}
+		for _, w := range p.Windows {
+			if _, err := parseClock(w.Start); err != nil {
+				return fmt.Errorf("schedule: %w", err)
+			}
+			if _, err := parseClock(w.End); err != nil {
+				return fmt.Errorf("schedule: %w", err)
+			}
+		}
+	}
+	return nil
+}
+
+// ScalingConfigs holds the scaling config of every queue. A queue listed in
+// Queues uses that config in full instead of Default.
+type ScalingConfigs struct {
+	Default ScalingConfig            `json:"default"`
+	Queues  map[string]ScalingConfig `json:"queues,omitempty"`
+}
+
+// For returns the config for queueName.
+func (c ScalingConfigs) For(queueName string) ScalingConfig {
+	if cfg, ok := c.Queues[queueName]; ok {
+		return cfg
+	}
+	return c.Default
+}
+
+// LoadScalingConfigs reads scaling configs from the JSON file at path, e.g.
+//
+//	{
+//	  "default": {"interval": "5s", "up_cooldown": "10s", "down_cooldown": "30s",
+//	              "queue_length": {"up_above": 20, "down_below": 5, "up_step": 2, "down_step": 1}},
+//	  "queues": {
+//	    "queue:high": {"interval": "5s", "down_cooldown": "1m",
+//	                   "wait_time": {"max_wait": "30s", "up_step": 2, "down_step": 1},
+//	                   "schedule": {"timezone": "Europe/Berlin",
+//	                                "windows": [{"days": ["mon", "tue", "wed", "thu", "fri"], "start": "08:00", "end": "18:00", "min": 4}]}}
+//	  }
+//	}
+//
+// An empty path, or a file without a default, uses DefaultScalingConfig.
+func LoadScalingConfigs(path string) (ScalingConfigs, error) {
+	configs := ScalingConfigs{Default: DefaultScalingConfig()}
+	if path == "" {
+		return configs, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return ScalingConfigs{}, fmt.Errorf("read autoscaling config: %w", err)
+	}
+	var file struct {
+		Default *ScalingConfig           `json:"default"`
+		Queues  map[string]ScalingConfig `json:"queues"`
+	}
+	if err := json.Unmarshal(data, &file); err != nil {
+		return ScalingConfigs{}, fmt.Errorf("parse autoscaling config: %w", err)
+	}
+	if file.Default != nil {
+		configs.Default = *file.Default
+	}
+	configs.Queues = file.Queues
+
+	if err := configs.Default.Validate(); err != nil {
+		return ScalingConfigs{}, fmt.Errorf("autoscaling config default: %w", err)
+	}
+	for name, cfg := range configs.Queues {
+		if err := cfg.Validate(); err != nil {
+			return ScalingConfigs{}, fmt.Errorf("autoscaling config %s: %w", name, err)
+		}
+	}
+	return configs, nil
+}
@@ -0,0 +1,80 @@
+package workers
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"go.uber.org/zap"
+	"jobqueue/internal/leader"
+	"jobqueue/internal/queue"
+)
+
+// Scheduler moves deferred jobs from each queue's scheduled set back onto the
+// queue once they are due. Besides its own queues it covers those of every
+// live process, refreshed every processTTL.
+type Scheduler struct {
+	rdb        redis.UniversalClient
+	queues     []string
+	processTTL time.Duration
+	logger     *zap.Logger
+	interval   time.Duration
+	batchSize  int
+
+	clusterQueues []string
+	refreshed     time.Time
+}
+
+func NewScheduler(rdb redis.UniversalClient, queues []string, processTTL time.Duration, logger *zap.Logger) *Scheduler {
+	return &Scheduler{
+		rdb:           rdb,
+		queues:        queues,
+		processTTL:    processTTL,
+		logger:        logger.With(zap.String("component", "scheduler")),
+		interval:      1 * time.Second,
+		batchSize:     100,
+		clusterQueues: queues,
+	}
+}
+
+func (s *Scheduler) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	s.logger.Info("scheduler started")
+
+	for {
+		select {
+		case <-ctx.Done():
+			s.logger.Info("scheduler stopped")
+			return
+		case <-ticker.C:
+			s.promote(ctx)
+		}
+	}
+}
+
+func (s *Scheduler) promote(ctx context.Context) {
+	if time.Since(s.refreshed) >= s.processTTL {
+		queues, err := withClusterQueues(ctx, s.rdb, s.queues, s.processTTL)
+		if err != nil {
+			s.logger.Error("failed to list cluster queues", zap.Error(err))
+		} else {
+			s.clusterQueues, s.refreshed = queues, time.Now()
+		}
+	}
+	if !leader.Holds(ctx) {
+		return
+	}
+
+	for _, queueName := range s.clusterQueues {
+		n, err := queue.PromoteDue(ctx, s.rdb, queueName, time.Now(), s.batchSize)
+		if err != nil {
+			s.logger.Error("failed to promote scheduled jobs", zap.Error(err), zap.String("queue", queueName))
+			continue
+		}
+		if n > 0 {
+			s.logger.Debug("promoted scheduled jobs", zap.Int("count", n), zap.String("queue", queueName))
+		}
+	}
+}
@@ -2,168 +2,180 @@ package workers
 
 import (
 	"context"
-	"encoding/json"
 	"errors"
+	"strconv"
+	"sync"
 	"time"
 
 	"github.com/go-redis/redis/v8"
 	"go.uber.org/zap"
-	"gorm.io/gorm"
-	"gorm.io/gorm/clause"
-	"jobqueue/internal/ai"
+	"jobqueue/internal/config"
+	"jobqueue/internal/control"
 	"jobqueue/internal/models"
-	"jobqueue/internal/monitoring"
+	"jobqueue/internal/queue"
 	"jobqueue/internal/tasks"
 )
 
-const (
-	dlqKey = "queue:dlq"
-)
-
 type Worker struct {
-	id      int
-	queue   string
-	db      *gorm.DB
-	rdb     *redis.Client
-	ai      *ai.AI
-	metrics *monitoring.Metrics
-	logger  *zap.Logger
+	id        int
+	name      string
+	queue     string
+	lifecycle *Lifecycle
+	registry  *tasks.Registry
+	rdb       redis.UniversalClient
+	controls  *control.Store
+	logger    *zap.Logger
+
+	mu      sync.Mutex
+	current *models.Job // the job being run, if any
+	started time.Time
 }
 
-func NewWorker(id int, queue string, db *gorm.DB, rdb *redis.Client, ai *ai.AI, metrics *monitoring.Metrics, logger *zap.Logger) *Worker {
+func NewWorker(id int, queue string, lifecycle *Lifecycle, registry *tasks.Registry, rdb redis.UniversalClient, controls *control.Store, logger *zap.Logger) *Worker {
 	return &Worker{
-		id:      id,
-		queue:   queue,
-		db:      db,
-		rdb:     rdb,
-		ai:      ai,
-		metrics: metrics,
-		logger:  logger.With(zap.Int("worker_id", id), zap.String("queue", queue)),
+		id:        id,
+		name:      WorkerName(InstanceID(), queue, strconv.Itoa(id)),
+		queue:     queue,
+		lifecycle: lifecycle,
+		registry:  registry,
+		rdb:       rdb,
+		controls:  controls,
+		logger:    logger.With(zap.Int("worker_id", id), zap.String("queue", queue)),
 	}
 }
 
-func (w *Worker) Loop(ctx context.Context) {
+// Loop dequeues and runs jobs until stop is cancelled. Jobs run under run, so
+// a job that is in flight when stop is cancelled carries on until it finishes
+// or run is cancelled too, in which case it is aborted and requeued.
+func (w *Worker) Loop(stop, run context.Context) {
 	w.logger.Info("worker loop started")
 	for {
 		select {
-		case <-ctx.Done():
+		case <-stop.Done():
 			w.logger.Info("worker loop stopping")
 			return
 		default:
-			result, err := w.rdb.BRPop(ctx, 5*time.Second, w.queue).Result()
+			if w.queuePaused(stop) {
+				select {
+				case <-stop.Done():
+				case <-time.After(config.PausedPollInterval):
+				}
+				continue
+			}
+
+			jobID, err := queue.Pop(stop, w.rdb, w.queue, 5*time.Second)
 			if err != nil {
-				if errors.Is(err, redis.Nil) {
-					continue // Timeout, no job received.
+				if errors.Is(err, redis.Nil) || stop.Err() != nil {
+					continue // Timeout, no job received, or stopping.
 				}
 				w.logger.Error("failed to pop job from queue", zap.Error(err))
 				time.Sleep(1 * time.Second)
 				continue
 			}
 
-			if len(result) < 2 {
-				continue
+			if w.processJob(run, jobID) {
+				if err := queue.Ack(context.Background(), w.rdb, w.queue, jobID); err != nil {
+					w.logger.Error("failed to ack job", zap.Error(err), zap.String("job_id", jobID))
+				}
 			}
-			w.processJob(ctx, result[1])
 		}
 	}
 }
 
-func (w *Worker) processJob(ctx context.Context, jobID string) {
+// queuePaused reports whether an operator has paused this worker's queue.
+func (w *Worker) queuePaused(ctx context.Context) bool {
+	state, err := w.controls.Get(ctx, control.KindQueue, w.queue)
+	if err != nil {
+		w.logger.Warn("failed to read queue state", zap.Error(err))
+	}
+	return state == control.StatePaused
+}
+
+// processJob claims and runs a popped job. It returns false if the job was not
+// claimed, in which case Claim has already dealt with the processing list.
+func (w *Worker) processJob(ctx context.Context, jobID string) bool {
 	w.logger.Info("processing job", zap.String("job_id", jobID))
 	startTime := time.Now()
 
-	tx := w.db.Begin()
-	if tx.Error != nil {
-		w.logger.Error("failed to begin transaction", zap.Error(tx.Error))
-		return
+	job, ok := w.lifecycle.Claim(ctx, w.queue, jobID, w.name)
+	if !ok {
+		return false
 	}
-	defer tx.Rollback() // Rollback is ignored if tx is committed
+	defer w.lifecycle.Release(job)
+	w.setCurrent(&job)
+	defer w.setCurrent(nil)
 
-	var job models.Job
-	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&job, "id = ?", jobID).Error; err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
-			w.logger.Warn("job not found in db, maybe deleted", zap.String("job_id", jobID))
-			return
-		}
-		w.logger.Error("failed to get job from db", zap.Error(err))
-		return
-	}
+	taskCtx, result := tasks.WithResult(ctx)
+	stopRefresh := w.keepSlot(ctx, job)
+	processingErr := w.executeTask(taskCtx, job)
+	stopRefresh()
 
-	if job.Status != models.StatusQueued {
-		w.logger.Warn("job was already processed", zap.String("job_id", jobID), zap.String("status", job.Status))
-		return // Idempotency check
+	// The outcome is recorded even if ctx has been cancelled meanwhile.
+	doneCtx := context.WithoutCancel(ctx)
+	duration := time.Since(startTime).Milliseconds()
+	switch {
+	case processingErr == nil:
+		w.lifecycle.Complete(doneCtx, w.queue, job, duration, result())
+	case ctx.Err() != nil:
+		w.lifecycle.Abort(doneCtx, w.queue, job, duration, processingErr)
+	default:
+		w.lifecycle.Fail(doneCtx, w.queue, job, duration, processingErr)
 	}
+	return true
+}
 
-	job.Status = models.StatusRunning
-	if err := tx.Save(&job).Error; err != nil {
-		w.logger.Error("failed to update job status to running", zap.Error(err))
-		return
-	}
-	if err := tx.Commit().Error; err != nil {
-		w.logger.Error("failed to commit transaction", zap.Error(err))
-		return
-	}
+func (w *Worker) setCurrent(job *models.Job) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.current, w.started = job, time.Now()
+}
 
-	processingErr := w.executeTask(ctx, job)
+// Status reports what the worker is running.
+func (w *Worker) Status() WorkerStatus {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	status := WorkerStatus{ID: w.id, Name: w.name}
+	if w.current != nil {
+		started := w.started
+		status.JobID = w.current.ID
+		status.JobType = w.current.Type
+		status.StartedAt = &started
+	}
+	return status
+}
 
-	duration := time.Since(startTime).Milliseconds()
-	if processingErr != nil {
-		w.logger.Warn("job execution failed", zap.Error(processingErr), zap.String("job_id", jobID))
-		w.metrics.JobFailuresTotal.WithLabelValues(w.queue, job.Type).Inc()
-		w.handleFailure(ctx, job, duration)
-	} else {
-		w.logger.Info("job executed successfully", zap.String("job_id", jobID))
-		if err := w.db.Model(&job).Updates(models.Job{Status: models.StatusCompleted, Duration: duration}).Error; err != nil {
-			w.logger.Error("failed to update job to completed", zap.Error(err))
+// keepSlot refreshes the job's concurrency slots while it runs so that long
+// jobs do not lose them when the lease expires. The returned func stops it.
+func (w *Worker) keepSlot(ctx context.Context, job models.Job) func() {
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(w.lifecycle.sem.Lease() / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := w.lifecycle.Refresh(ctx, job); err != nil {
+					w.logger.Warn("failed to refresh concurrency slot", zap.Error(err), zap.String("job_id", job.ID))
+				}
+			}
 		}
-		w.metrics.JobsProcessedTotal.WithLabelValues(w.queue, models.StatusCompleted).Inc()
-	}
-	w.metrics.JobDurationSeconds.WithLabelValues(w.queue, job.Type).Observe(float64(duration) / 1000)
+	}()
+	return func() { close(done) }
 }
 
-// executeTask finds the correct processor and executes the job.
+// executeTask finds the correct processor and executes the job. The processor
+// runs under tasks.Recover, so a panic fails only this job, as a
+// *tasks.PanicError, and the worker keeps serving.
 func (w *Worker) executeTask(ctx context.Context, job models.Job) error {
-	processor, err := tasks.Get(job.Type)
+	processor, err := w.registry.Get(job.Type)
 	if err != nil {
 		// This is a permanent failure, as the job type is unknown.
 		w.logger.Error("no processor for job type", zap.String("job_type", job.Type))
 		return err
 	}
-	return processor.Process(ctx, job)
+	return tasks.Chain(processor, tasks.Recover()).Process(ctx, job)
 }
-
-func (w *Worker) handleFailure(ctx context.Context, job models.Job, duration int64) {
-	job.RetryCount++
-	job.Duration = duration
-
-	if job.RetryCount > job.MaxRetries {
-		w.logger.Warn("job failed permanently, moving to DLQ", zap.String("job_id", job.ID))
-		job.Status = models.StatusFailed
-		if err := w.db.Save(&job).Error; err != nil {
-			w.logger.Error("failed to update job status to failed", zap.Error(err))
-		}
-		w.metrics.JobsProcessedTotal.WithLabelValues(w.queue, models.StatusFailed).Inc()
-
-		jobData, _ := json.Marshal(job)
-		if err := w.rdb.LPush(ctx, dlqKey, jobData).Err(); err != nil {
-			w.logger.Error("failed to push job to DLQ", zap.Error(err))
-		}
-
-		var payload map[string]interface{}
-		_ = json.Unmarshal([]byte(job.Payload), &payload)
-		go w.ai.HandleDLQWithAI(ctx, job.ID, job.Type, payload, job.RetryCount)
-	} else {
-		w.logger.Info("retrying job", zap.String("job_id", job.ID), zap.Int("retry_count", job.RetryCount))
-		job.Status = models.StatusQueued
-		if err := w.db.Save(&job).Error; err != nil {
-			w.logger.Error("failed to update job status for retry", zap.Error(err))
-			return
-		}
-
-		if err := w.rdb.LPush(ctx, w.queue, job.ID).Err(); err != nil {
-			w.logger.Error("failed to re-enqueue job for retry", zap.Error(err))
-			// If this fails, the job is now in a failed state in the DB but not in a queue.
-			// A separate recovery process (reaper) would be needed for a truly robust system.
-		}
-	}
-}
\ No newline at end of file
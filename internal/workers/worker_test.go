@@ -0,0 +1,161 @@
+package workers
+
+import (
+	"context"
+	"errors"
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+	"jobqueue/internal/control"
+	"jobqueue/internal/models"
+	"jobqueue/internal/monitoring"
+	"jobqueue/internal/queue"
+	"jobqueue/internal/tasks"
+	"jobqueue/internal/throttle"
+	"jobqueue/internal/usage"
+)
+
+// Metrics register globally, so every test shares one set.
+var testMetrics = sync.OnceValue(monitoring.NewMetrics)
+
+// testEnv is a Lifecycle wired to the Postgres and Redis named by
+// POSTGRES_DSN and REDIS_URL, with a queue of its own. Tests using it skip
+// when either is not set.
+type testEnv struct {
+	db        *gorm.DB
+	rdb       redis.UniversalClient
+	lifecycle *Lifecycle
+	controls  *control.Store
+	queue     string
+}
+
+func newTestEnv(t *testing.T) *testEnv {
+	t.Helper()
+	dsn, redisURL := os.Getenv("POSTGRES_DSN"), os.Getenv("REDIS_URL")
+	if dsn == "" || redisURL == "" {
+		t.Skip("POSTGRES_DSN and REDIS_URL environment variables not set, skipping test")
+	}
+
+	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{Logger: logger.Discard})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&models.Job{}, &models.JobAttempt{}, &models.DailyUsage{}))
+	opts, err := redis.ParseURL(redisURL)
+	require.NoError(t, err)
+	rdb := redis.NewClient(opts)
+	t.Cleanup(func() { rdb.Close() })
+
+	name := "test:queue:" + uuid.NewString()
+	t.Cleanup(func() {
+		rdb.Del(context.Background(), queue.Key(name), queue.ProcessingKey(name), queue.ScheduledKey(name), queue.AckedKey(name))
+	})
+	controls := control.NewStore(rdb, 0)
+	sem := throttle.NewSemaphore(rdb, time.Minute, nil, nil)
+	limiter := throttle.NewRateLimiter(rdb, nil)
+	meter := usage.NewMeter(db, rdb, nil, 0, zap.NewNop())
+	lifecycle := NewLifecycle(time.Second, db, rdb, nil, sem, limiter, controls, meter, testMetrics(), zap.NewNop())
+	return &testEnv{db: db, rdb: rdb, lifecycle: lifecycle, controls: controls, queue: name}
+}
+
+// submit creates a queued job of jobType and pushes it onto the queue.
+func (e *testEnv) submit(t *testing.T, jobType string) models.Job {
+	t.Helper()
+	job := models.Job{
+		ID:         uuid.NewString(),
+		Type:       jobType,
+		Payload:    "{}",
+		Status:     models.StatusQueued,
+		ProjectID:  uuid.NewString(),
+		MaxRetries: 3,
+	}
+	require.NoError(t, e.db.Create(&job).Error)
+	t.Cleanup(func() {
+		e.db.Where("job_id = ?", job.ID).Delete(&models.JobAttempt{})
+		e.db.Delete(&job)
+	})
+	require.NoError(t, queue.Push(context.Background(), e.rdb, e.queue, job.ID))
+	return job
+}
+
+// reload returns the job as it is stored now.
+func (e *testEnv) reload(t *testing.T, id string) models.Job {
+	t.Helper()
+	var job models.Job
+	require.NoError(t, e.db.First(&job, "id = ?", id).Error)
+	return job
+}
+
+func (e *testEnv) attempts(t *testing.T, id string) []models.JobAttempt {
+	t.Helper()
+	var attempts []models.JobAttempt
+	require.NoError(t, e.db.Where("job_id = ?", id).Order("attempt asc").Find(&attempts).Error)
+	return attempts
+}
+
+func TestWorkerRecoversProcessorPanic(t *testing.T) {
+	e := newTestEnv(t)
+	jobType := "test-panic-" + uuid.NewString()
+	var runs atomic.Int32
+	registry := tasks.NewRegistry()
+	registry.Register(jobType, tasks.ProcessorFunc(func(ctx context.Context, job models.Job) error {
+		if runs.Add(1) == 1 {
+			panic("boom")
+		}
+		return nil
+	}))
+	panics := testutil.ToFloat64(testMetrics().JobPanicsTotal.WithLabelValues(e.queue, jobType))
+
+	panicked := e.submit(t, jobType)
+	next := e.submit(t, jobType)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	w := NewWorker(1, e.queue, e.lifecycle, registry, e.rdb, e.controls, zap.NewNop())
+	go func() {
+		defer close(done)
+		w.Loop(ctx, ctx)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	require.Eventually(t, func() bool {
+		return e.reload(t, panicked.ID).Status == models.StatusCompleted &&
+			e.reload(t, next.ID).Status == models.StatusCompleted
+	}, 10*time.Second, 50*time.Millisecond, "the worker must keep serving after a panic")
+
+	assert.Equal(t, 1, e.reload(t, panicked.ID).RetryCount, "the panicked run must go through Fail")
+	attempts := e.attempts(t, panicked.ID)
+	require.Len(t, attempts, 2)
+	assert.Equal(t, models.StatusFailed, attempts[0].Status)
+	assert.Contains(t, attempts[0].Error, "boom")
+	assert.NotEmpty(t, attempts[0].Stack)
+	assert.Empty(t, attempts[1].Stack)
+	assert.Equal(t, panics+1, testutil.ToFloat64(testMetrics().JobPanicsTotal.WithLabelValues(e.queue, jobType)))
+}
+
+func TestExecuteTaskRecoversPanic(t *testing.T) {
+	registry := tasks.NewRegistry()
+	registry.Register("boom", tasks.ProcessorFunc(func(ctx context.Context, job models.Job) error {
+		panic("boom")
+	}))
+	w := NewWorker(1, "test", nil, registry, nil, nil, zap.NewNop())
+
+	err := w.executeTask(context.Background(), models.Job{ID: "j1", Type: "boom"})
+	var panicErr *tasks.PanicError
+	require.True(t, errors.As(err, &panicErr))
+	assert.Equal(t, "boom", panicErr.Value)
+	assert.NotEmpty(t, panicErr.Stack)
+}